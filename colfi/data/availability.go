@@ -0,0 +1,61 @@
+package data
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+// Availability is a bitmap over the items of a dataset marking those that
+// can currently be recommended. Serving processes rebuild it from the live
+// catalog more often than they retrain, so that items withdrawn since
+// training are left out. A nil Availability holds every item.
+type Availability struct {
+	bits []uint64
+}
+
+// NewAvailability returns the Availability of d holding items. Items that d
+// does not contain are ignored, as models cannot score them anyway.
+func NewAvailability(d *Dataset, items []string) *Availability {
+	a := &Availability{bits: make([]uint64, (len(d.ItemIDs)+63)/64)}
+	for _, i := range items {
+		if iid, ok := d.ItemMap[i]; ok {
+			a.bits[iid/64] |= 1 << uint(iid%64)
+		}
+	}
+	return a
+}
+
+// ReadAvailability reads one available item ID per line. Blank lines are
+// skipped.
+func ReadAvailability(d *Dataset, r io.Reader) (*Availability, error) {
+	var items []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if i := strings.TrimSpace(sc.Text()); i != "" {
+			items = append(items, i)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewAvailability(d, items), nil
+}
+
+// Has reports whether the item with internal ID iid is available.
+func (a *Availability) Has(iid int) bool {
+	if a == nil {
+		return true
+	}
+	return iid >= 0 && iid/64 < len(a.bits) && a.bits[iid/64]&(1<<uint(iid%64)) != 0
+}
+
+// Len returns the number of available items.
+func (a *Availability) Len() int {
+	var n int
+	for _, w := range a.bits {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
@@ -0,0 +1,176 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Bounds is a rating scale, from the lowest to the highest possible rating.
+// Step is the granularity of the scale, e.g. .5 for half stars, or 0 if
+// ratings are continuous.
+type Bounds struct {
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+// stepTolerance is how far, in steps, a rating may lie from the grid and
+// still count as on it, which absorbs float32 rounding of e.g. tenths.
+const stepTolerance = 1e-3
+
+// datasetBounds caches the RatingBounds of a dataset, together with its
+// number of ratings when they were computed.
+type datasetBounds struct {
+	numRatings int
+	bounds     Bounds
+}
+
+// RatingBounds returns the range of the ratings in d and the largest step
+// that every rating is a whole number of steps above the minimum by. The
+// result is cached until ratings are appended; changing existing ratings in
+// place is not detected.
+func (d *Dataset) RatingBounds() Bounds {
+	if c := d.bounds.Load(); c != nil && c.numRatings == len(d.Ratings) {
+		return c.bounds
+	}
+	c := &datasetBounds{numRatings: len(d.Ratings), bounds: ratingBounds(d.Ratings)}
+	d.bounds.Store(c)
+	return c.bounds
+}
+
+func ratingBounds(ratings []float32) Bounds {
+	// The bounds only depend on the distinct ratings, of which there are
+	// usually a handful, so only those are widened and sorted.
+	distinct := make(map[float32]struct{})
+	for _, r := range ratings {
+		distinct[r] = struct{}{}
+	}
+	// Ratings are widened through their shortest decimal form so that a
+	// rating of .1 is taken as .1 rather than its float32 approximation.
+	values := make([]float64, 0, len(distinct))
+	for r := range distinct {
+		v, _ := strconv.ParseFloat(strconv.FormatFloat(float64(r), 'g', -1, 32), 64)
+		values = append(values, v)
+	}
+	sort.Float64s(values)
+	b := Bounds{Min: math.Inf(1), Max: math.Inf(-1)}
+	if len(values) > 0 {
+		b.Min, b.Max = values[0], values[len(values)-1]
+	}
+
+	// The step divides the smallest gap between distinct ratings, so try
+	// that gap and its integer fractions.
+	gap := math.Inf(1)
+	for k := 1; k < len(values); k++ {
+		if diff := values[k] - values[k-1]; diff > 0 && diff < gap {
+			gap = diff
+		}
+	}
+	if math.IsInf(gap, 0) {
+		return b
+	}
+	for div := 1.; div <= 10; div++ {
+		step := gap / div
+		onGrid := true
+		for _, v := range values {
+			k := (v - b.Min) / step
+			if math.Abs(k-math.Round(k)) > stepTolerance {
+				onGrid = false
+				break
+			}
+		}
+		if onGrid {
+			b.Step = math.Round(step*1e6) / 1e6
+			return b
+		}
+	}
+	return b
+}
+
+// Rounding selects how Round maps a prediction onto the rating scale.
+type Rounding int
+
+const (
+	RoundNearest Rounding = iota
+	RoundDown
+	RoundUp
+)
+
+// Round clips p to the scale and moves it onto the nearest rating below,
+// above or either side of it, e.g. for display as stars. Predictions are
+// only clipped if the scale is continuous.
+func (b Bounds) Round(p float64, mode Rounding) float64 {
+	p = b.Clip(p)
+	if b.Step == 0 {
+		return p
+	}
+	k := (p - b.Min) / b.Step
+	switch mode {
+	case RoundDown:
+		k = math.Floor(k + stepTolerance)
+	case RoundUp:
+		k = math.Ceil(k - stepTolerance)
+	default:
+		k = math.Round(k)
+	}
+	return b.Clip(b.Min + k*b.Step)
+}
+
+func (b Bounds) Clip(p float64) float64 {
+	return math.Max(b.Min, math.Min(b.Max, p))
+}
+
+// Check reports the first rating of d that lies outside b, e.g. to make sure
+// a testset uses the scale a model was trained on.
+func (b Bounds) Check(d *Dataset) error {
+	for idx, r := range d.Ratings {
+		if r < float32(b.Min) || r > float32(b.Max) {
+			return fmt.Errorf("rating %d is %v, outside the scale %v to %v", idx, r, b.Min, b.Max)
+		}
+	}
+	return nil
+}
+
+// Validate reports whether b is a usable scale: finite, with Min <= Max and
+// a non-negative Step.
+func (b Bounds) Validate() error {
+	if math.IsNaN(b.Min) || math.IsNaN(b.Max) || math.IsInf(b.Min, 0) || math.IsInf(b.Max, 0) || b.Min > b.Max {
+		return fmt.Errorf("Bounds must be finite with Min <= Max, got %v to %v", b.Min, b.Max)
+	}
+	if math.IsNaN(b.Step) || math.IsInf(b.Step, 0) || b.Step < 0 {
+		return fmt.Errorf("Bounds.Step must be a non-negative number, got %v", b.Step)
+	}
+	return nil
+}
+
+// maxScaleShift is the Kolmogorov-Smirnov statistic between the ratings of
+// two datasets above which CheckScales takes them to be on different scales.
+// Random splits of the same ratings stay far below it.
+const maxScaleShift = .2
+
+// CheckScales reports whether validation, e.g. the testset of a grid search
+// or of early stopping, seems rated on a different scale than train: if its
+// ratings range beyond train's, are finer grained than train's or are
+// distributed too differently. A mismatch usually means the two were loaded
+// from different sources and makes the validation loss meaningless, so
+// callers warn about it before spending time on training.
+func CheckScales(train, validation *Dataset) error {
+	if len(train.Ratings) == 0 || len(validation.Ratings) == 0 {
+		return nil
+	}
+	tb, vb := train.RatingBounds(), validation.RatingBounds()
+	if vb.Min < tb.Min || vb.Max > tb.Max {
+		return fmt.Errorf("validation ratings range from %v to %v, outside the training scale %v to %v", vb.Min, vb.Max, tb.Min, tb.Max)
+	}
+	if tb.Step > 0 && vb.Step > 0 && vb.Step < tb.Step*(1-stepTolerance) {
+		return fmt.Errorf("validation ratings are in steps of %v, finer than the training steps of %v", vb.Step, tb.Step)
+	}
+	if shift := ksStatistic(ratingValues(train), ratingValues(validation)); shift > maxScaleShift {
+		tm, _ := meanStdDev(train.Ratings)
+		vm, _ := meanStdDev(validation.Ratings)
+		return fmt.Errorf("validation ratings are distributed unlike the training ratings (mean %.4f vs %.4f, shift %.4f)", vm, tm, shift)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package data
+
+// datasetCounts caches per-user and per-item statistics of a dataset,
+// together with its size when they were computed.
+type datasetCounts struct {
+	numRatings int
+	numUsers   int
+	numItems   int
+	users      []int
+	items      []int
+	itemMeans  []float64
+}
+
+// counts returns the cached statistics of d, recomputing them if ratings,
+// users or items were appended since. Changing existing ratings in place is
+// not detected.
+func (d *Dataset) counts() *datasetCounts {
+	if c := d.cache.Load(); c != nil && c.numRatings == len(d.Ratings) &&
+		c.numUsers == len(d.UserMap) && c.numItems == len(d.ItemMap) {
+		return c
+	}
+	c := &datasetCounts{
+		numRatings: len(d.Ratings),
+		numUsers:   len(d.UserMap),
+		numItems:   len(d.ItemMap),
+		users:      make([]int, len(d.UserMap)),
+		items:      make([]int, len(d.ItemMap)),
+		itemMeans:  make([]float64, len(d.ItemMap)),
+	}
+	for idx, r := range d.Ratings {
+		c.users[d.Users[idx]]++
+		c.items[d.Items[idx]]++
+		c.itemMeans[d.Items[idx]] += float64(r)
+	}
+	for i, n := range c.items {
+		if n > 0 {
+			c.itemMeans[i] /= float64(n)
+		}
+	}
+	d.cache.Store(c)
+	return c
+}
+
+// UserCounts returns the number of ratings of every user, indexed by
+// internal ID. The slice is cached and shared, so it must not be modified.
+func (d *Dataset) UserCounts() []int {
+	return d.counts().users
+}
+
+// ItemCounts returns the number of ratings of every item, i.e. its
+// popularity, indexed by internal ID. The slice is cached and shared, so it
+// must not be modified.
+func (d *Dataset) ItemCounts() []int {
+	return d.counts().items
+}
+
+// ItemMeanRating returns the mean rating of every item, indexed by internal
+// ID, or 0 for an item without ratings. The slice is cached and shared, so it
+// must not be modified.
+func (d *Dataset) ItemMeanRating() []float64 {
+	return d.counts().itemMeans
+}
+
+// GroupRatings returns the indices of the ratings of every row, given the
+// row of each rating.
+func GroupRatings(rowOf []int, numRows int) [][]int {
+	counts := make([]int, numRows)
+	for _, row := range rowOf {
+		counts[row]++
+	}
+	flat := make([]int, len(rowOf))
+	rows := make([][]int, numRows)
+	start := 0
+	for row, n := range counts {
+		rows[row] = flat[start : start : start+n]
+		start += n
+	}
+	for idx, row := range rowOf {
+		rows[row] = append(rows[row], idx)
+	}
+	return rows
+}
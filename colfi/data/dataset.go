@@ -0,0 +1,385 @@
+// Package data holds the ratings the models in package train learn from:
+// the Dataset with its user and item ID mappings, readers for CSV, JSONL and
+// other rating sources, train/test splits, item availability, and checks
+// of the data itself such as drift and shill detection.
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+
+	"main/colfi/internal/random"
+)
+
+type Dataset struct {
+	Users      []int
+	Items      []int
+	Ratings    []float32
+	UserMap    map[string]int
+	ItemMap    map[string]int
+	UserIDs    []string
+	ItemIDs    []string
+	Context    [][]FeatureValue
+	FeatureMap map[string]int
+	FieldMap   map[string]int
+	Fields     []int
+	// Propensities, if set, holds the probability with which the logging
+	// policy showed the item of every rating, as appended by AppendLogged,
+	// for inverse propensity weighting.
+	Propensities []float64
+	// cache holds the statistics behind UserCounts, ItemCounts and
+	// ItemMeanRating.
+	cache atomic.Pointer[datasetCounts]
+	// bounds holds the result of RatingBounds.
+	bounds atomic.Pointer[datasetBounds]
+}
+
+// Feature is a contextual signal attached to a single rating, such as the
+// device it was made on. Categorical features use Value 1.
+type Feature struct {
+	Field string
+	Name  string
+	Value float32
+}
+
+type FeatureValue struct {
+	ID    int
+	Value float32
+}
+
+func NewDataset() *Dataset {
+	return &Dataset{
+		UserMap:    make(map[string]int),
+		ItemMap:    make(map[string]int),
+		FeatureMap: make(map[string]int),
+		FieldMap:   make(map[string]int),
+	}
+}
+
+// DatasetsFromSlices splits the ratings r of items i by users u at random
+// into a trainset and a testset that holds a split fraction of them. The
+// split draws from src, or from the default source shared by the colfi
+// packages if src is nil.
+func DatasetsFromSlices(u, i []string, r []float32, split float64, src rand.Source) (*Dataset, *Dataset, error) {
+	trainset, testset, _, _, err := DatasetsFromSlicesIndexed(u, i, r, split, src)
+	return trainset, testset, err
+}
+
+// DatasetsFromSlicesIndexed splits like DatasetsFromSlices and also returns,
+// for every rating in the trainset and testset, the index of the row of the
+// input slices it came from, so results can be joined back to the source.
+func DatasetsFromSlicesIndexed(u, i []string, r []float32, split float64, src rand.Source) (*Dataset, *Dataset, []int, []int, error) {
+	n := len(u)
+	if n != len(i) || len(u) != len(r) {
+		return nil, nil, nil, nil, fmt.Errorf("u, i and r slices must be the same length")
+	}
+	if split < 0.0 || split > 1.0 {
+		return nil, nil, nil, nil, fmt.Errorf("split must be between 0 and 1")
+	}
+	p := random.Or(src).Perm(n)
+	trainNum := int(math.Round(float64(n) * (1. - split)))
+	trainRows := make([]int, 0, trainNum)
+	for _, j := range p[:trainNum] {
+		trainRows = append(trainRows, p[j])
+	}
+	testRows := make([]int, 0, n-trainNum)
+	for _, j := range p[trainNum:] {
+		testRows = append(testRows, p[j])
+	}
+	return datasetFromRows(u, i, r, trainRows), datasetFromRows(u, i, r, testRows), trainRows, testRows, nil
+}
+
+// UserDatasetsFromSlices places whole users in either the trainset or the
+// testset, with split the fraction of users held out, so that evaluation
+// measures how users unseen in training are scored. The users held out are
+// drawn as by DatasetsFromSlices.
+func UserDatasetsFromSlices(u, i []string, r []float32, split float64, src rand.Source) (*Dataset, *Dataset, error) {
+	trainset, testset, _, _, err := UserDatasetsFromSlicesIndexed(u, i, r, split, src)
+	return trainset, testset, err
+}
+
+// UserDatasetsFromSlicesIndexed is UserDatasetsFromSlices returning the
+// source rows as DatasetsFromSlicesIndexed does.
+func UserDatasetsFromSlicesIndexed(u, i []string, r []float32, split float64, src rand.Source) (*Dataset, *Dataset, []int, []int, error) {
+	n := len(u)
+	if n != len(i) || len(u) != len(r) {
+		return nil, nil, nil, nil, fmt.Errorf("u, i and r slices must be the same length")
+	}
+	if split < 0.0 || split > 1.0 {
+		return nil, nil, nil, nil, fmt.Errorf("split must be between 0 and 1")
+	}
+	userIdx := make(map[string]int)
+	for _, user := range u {
+		if _, ok := userIdx[user]; !ok {
+			userIdx[user] = len(userIdx)
+		}
+	}
+	numUsers := len(userIdx)
+	trainNum := int(math.Round(float64(numUsers) * (1. - split)))
+	inTest := make([]bool, numUsers)
+	for _, k := range random.Or(src).Perm(numUsers)[trainNum:] {
+		inTest[k] = true
+	}
+	var trainRows, testRows []int
+	for row, user := range u {
+		if inTest[userIdx[user]] {
+			testRows = append(testRows, row)
+		} else {
+			trainRows = append(trainRows, row)
+		}
+	}
+	return datasetFromRows(u, i, r, trainRows), datasetFromRows(u, i, r, testRows), trainRows, testRows, nil
+}
+
+// SplitLastInteraction holds out the latest rating of every user by ts, the
+// time of each rating, for leave-one-out evaluation. The testset holds one
+// rating per user, so it serves both Evaluate for rating error and Replay
+// without Update for the hit rate of the held-out item in the top N. Ties
+// go to the rating that comes last in the slices. Users with a single
+// rating stay entirely in the trainset, as holding it out would only test
+// unseen users.
+func SplitLastInteraction(u, i []string, r []float32, ts []int64) (*Dataset, *Dataset, error) {
+	trainset, testset, _, _, err := SplitLastInteractionIndexed(u, i, r, ts)
+	return trainset, testset, err
+}
+
+// SplitLastInteractionIndexed is SplitLastInteraction returning the source
+// rows as DatasetsFromSlicesIndexed does.
+func SplitLastInteractionIndexed(u, i []string, r []float32, ts []int64) (*Dataset, *Dataset, []int, []int, error) {
+	n := len(u)
+	if n != len(i) || n != len(r) || n != len(ts) {
+		return nil, nil, nil, nil, fmt.Errorf("u, i, r and ts slices must be the same length")
+	}
+	last := make(map[string]int)
+	count := make(map[string]int)
+	for row, user := range u {
+		count[user]++
+		if prev, ok := last[user]; !ok || ts[row] >= ts[prev] {
+			last[user] = row
+		}
+	}
+	var trainRows, testRows []int
+	for row, user := range u {
+		if count[user] > 1 && last[user] == row {
+			testRows = append(testRows, row)
+		} else {
+			trainRows = append(trainRows, row)
+		}
+	}
+	return datasetFromRows(u, i, r, trainRows), datasetFromRows(u, i, r, testRows), trainRows, testRows, nil
+}
+
+func datasetFromRows(u, i []string, r []float32, rows []int) *Dataset {
+	d := NewDataset()
+	for _, row := range rows {
+		d.Append(u[row], i[row], r[row])
+	}
+	return d
+}
+
+func (d *Dataset) Append(u, i string, r float32) {
+	uid, iid := d.getInternalIDs(u, i)
+	d.Users = append(d.Users, uid)
+	d.Items = append(d.Items, iid)
+	d.Ratings = append(d.Ratings, r)
+	if d.Context != nil {
+		d.Context = append(d.Context, nil)
+	}
+	if d.Propensities != nil {
+		d.Propensities = append(d.Propensities, 0)
+	}
+}
+
+func (d *Dataset) AppendContext(u, i string, r float32, ctx []Feature) {
+	if d.Context == nil {
+		d.Context = make([][]FeatureValue, len(d.Ratings))
+	}
+	fvs := make([]FeatureValue, len(ctx))
+	for k, f := range ctx {
+		fvs[k] = FeatureValue{d.getFeatureID(f.Field, f.Name), f.Value}
+	}
+	d.Append(u, i, r)
+	d.Context[len(d.Context)-1] = fvs
+}
+
+// AppendLogged appends a rating of an item that the logging policy, such as
+// an exploration policy, showed with the given propensity. Ratings appended
+// to the same dataset without one get propensity zero, which Validate
+// rejects.
+func (d *Dataset) AppendLogged(u, i string, r float32, propensity float64) {
+	if d.Propensities == nil {
+		d.Propensities = make([]float64, len(d.Ratings))
+	}
+	d.Append(u, i, r)
+	d.Propensities[len(d.Propensities)-1] = propensity
+}
+
+// Transpose returns a copy of the dataset with the roles of users and items
+// swapped, so that a model trained on it predicts how much an item "likes" a
+// user, e.g. to find the audience for an item. Internal IDs are preserved:
+// user u of d is item u of the result.
+func (d *Dataset) Transpose() *Dataset {
+	t := &Dataset{
+		Users:      append([]int(nil), d.Items...),
+		Items:      append([]int(nil), d.Users...),
+		Ratings:    append([]float32(nil), d.Ratings...),
+		UserMap:    make(map[string]int, len(d.ItemMap)),
+		ItemMap:    make(map[string]int, len(d.UserMap)),
+		UserIDs:    append([]string(nil), d.ItemIDs...),
+		ItemIDs:    append([]string(nil), d.UserIDs...),
+		FeatureMap: make(map[string]int, len(d.FeatureMap)),
+		FieldMap:   make(map[string]int, len(d.FieldMap)),
+		Fields:     append([]int(nil), d.Fields...),
+	}
+	for k, v := range d.ItemMap {
+		t.UserMap[k] = v
+	}
+	for k, v := range d.UserMap {
+		t.ItemMap[k] = v
+	}
+	for k, v := range d.FeatureMap {
+		t.FeatureMap[k] = v
+	}
+	for k, v := range d.FieldMap {
+		t.FieldMap[k] = v
+	}
+	if d.Context != nil {
+		t.Context = make([][]FeatureValue, len(d.Context))
+		for k, ctx := range d.Context {
+			t.Context[k] = append([]FeatureValue(nil), ctx...)
+		}
+	}
+	if d.Propensities != nil {
+		t.Propensities = append([]float64(nil), d.Propensities...)
+	}
+	return t
+}
+
+// AddItem registers i, which must be new, without any rating and returns
+// its internal ID.
+func (d *Dataset) AddItem(i string) int {
+	iid := len(d.ItemMap)
+	d.ItemMap[i] = iid
+	d.ItemIDs = append(d.ItemIDs, i)
+	return iid
+}
+
+// LookupIDs returns the internal IDs of u and i, or -1 for either if it is
+// not in the dataset.
+func (d *Dataset) LookupIDs(u, i string) (int, int) {
+	uid, ok := d.UserMap[u]
+	if !ok {
+		uid = -1
+	}
+	iid, ok := d.ItemMap[i]
+	if !ok {
+		iid = -1
+	}
+	return uid, iid
+}
+
+func (d *Dataset) getInternalIDs(u, i string) (int, int) {
+	uid, ok := d.UserMap[u]
+	if !ok {
+		uid = len(d.UserMap)
+		d.UserMap[u] = uid
+		d.UserIDs = append(d.UserIDs, u)
+	}
+	iid, ok := d.ItemMap[i]
+	if !ok {
+		iid = len(d.ItemMap)
+		d.ItemMap[i] = iid
+		d.ItemIDs = append(d.ItemIDs, i)
+	}
+	return uid, iid
+}
+
+func (d *Dataset) getFeatureID(field, name string) int {
+	key := field + "=" + name
+	id, ok := d.FeatureMap[key]
+	if !ok {
+		fid, ok := d.FieldMap[field]
+		if !ok {
+			fid = len(d.FieldMap)
+			d.FieldMap[field] = fid
+		}
+		id = len(d.FeatureMap)
+		d.FeatureMap[key] = id
+		d.Fields = append(d.Fields, fid)
+	}
+	return id
+}
+
+// Mean32 returns the mean of the finite values in s, or 0 if there are
+// none, so that a stray NaN cannot turn every prediction of a model into NaN.
+func Mean32(s []float32) float64 {
+	var sum float64
+	var n int
+	for _, x := range s {
+		if !math.IsNaN(float64(x)) && !math.IsInf(float64(x), 0) {
+			sum += float64(x)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// Restore recreates the maps gob leaves nil when they were saved empty.
+func (d *Dataset) Restore() {
+	if d.UserMap == nil {
+		d.UserMap = make(map[string]int)
+	}
+	if d.ItemMap == nil {
+		d.ItemMap = make(map[string]int)
+	}
+	if d.FeatureMap == nil {
+		d.FeatureMap = make(map[string]int)
+	}
+	if d.FieldMap == nil {
+		d.FieldMap = make(map[string]int)
+	}
+}
+
+var ErrEmptyDataset = errors.New("dataset has no ratings")
+
+// Validate checks that d can be trained on: it must hold at least one rating,
+// its parallel slices must agree, every rating must be a finite number and
+// every propensity, if any, must lie in (0, 1].
+func (d *Dataset) Validate() error {
+	if d == nil || len(d.Ratings) == 0 {
+		return ErrEmptyDataset
+	}
+	if len(d.Users) != len(d.Ratings) || len(d.Items) != len(d.Ratings) {
+		return fmt.Errorf("dataset has %d users, %d items and %d ratings, want the same number of each",
+			len(d.Users), len(d.Items), len(d.Ratings))
+	}
+	if d.Propensities != nil && len(d.Propensities) != len(d.Ratings) {
+		return fmt.Errorf("dataset has %d propensities and %d ratings, want the same number of each",
+			len(d.Propensities), len(d.Ratings))
+	}
+	if len(d.UserMap) == 0 || len(d.ItemMap) == 0 {
+		return fmt.Errorf("dataset has %d users and %d items, want at least one of each",
+			len(d.UserMap), len(d.ItemMap))
+	}
+	for idx, r := range d.Ratings {
+		if math.IsNaN(float64(r)) || math.IsInf(float64(r), 0) {
+			return fmt.Errorf("rating %d is %v", idx, r)
+		}
+		if d.Users[idx] < 0 || d.Users[idx] >= len(d.UserMap) {
+			return fmt.Errorf("rating %d has unknown user id %d", idx, d.Users[idx])
+		}
+		if d.Items[idx] < 0 || d.Items[idx] >= len(d.ItemMap) {
+			return fmt.Errorf("rating %d has unknown item id %d", idx, d.Items[idx])
+		}
+		if d.Propensities != nil && !(d.Propensities[idx] > 0 && d.Propensities[idx] <= 1) {
+			return fmt.Errorf("rating %d has propensity %v, want one in (0, 1]", idx, d.Propensities[idx])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DriftReport compares two snapshots of the training data. RatingShift and
+// ActivityShift are Kolmogorov-Smirnov statistics, the largest gap between
+// the cumulative distributions of the ratings and of the number of ratings
+// per user, from 0 for identical distributions to 1 for disjoint ones.
+type DriftReport struct {
+	Ratings       [2]int
+	Mean          [2]float64
+	StdDev        [2]float64
+	RatingShift   float64
+	NewUsers      int
+	DroppedUsers  int
+	NewItems      int
+	DroppedItems  int
+	PerUser       [2]float64
+	ActivityShift float64
+}
+
+// Drift reports how after differs from before, e.g. to decide whether a
+// model trained on before needs to be retrained or re-tuned. Index 0 of the
+// paired fields describes before and index 1 after.
+func Drift(before, after *Dataset) DriftReport {
+	var r DriftReport
+	for k, d := range [2]*Dataset{before, after} {
+		r.Ratings[k] = len(d.Ratings)
+		r.Mean[k], r.StdDev[k] = meanStdDev(d.Ratings)
+		if len(d.UserMap) > 0 {
+			r.PerUser[k] = float64(len(d.Ratings)) / float64(len(d.UserMap))
+		}
+	}
+	r.RatingShift = ksStatistic(ratingValues(before), ratingValues(after))
+	r.ActivityShift = ksStatistic(userActivity(before), userActivity(after))
+	r.NewUsers, r.DroppedUsers = keyChanges(before.UserMap, after.UserMap)
+	r.NewItems, r.DroppedItems = keyChanges(before.ItemMap, after.ItemMap)
+	return r
+}
+
+func (r DriftReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ratings:        %d -> %d\n", r.Ratings[0], r.Ratings[1])
+	fmt.Fprintf(&b, "mean rating:    %.4f -> %.4f (std dev %.4f -> %.4f, shift %.4f)\n",
+		r.Mean[0], r.Mean[1], r.StdDev[0], r.StdDev[1], r.RatingShift)
+	fmt.Fprintf(&b, "users:          %d new, %d dropped\n", r.NewUsers, r.DroppedUsers)
+	fmt.Fprintf(&b, "items:          %d new, %d dropped\n", r.NewItems, r.DroppedItems)
+	fmt.Fprintf(&b, "ratings/user:   %.2f -> %.2f (shift %.4f)", r.PerUser[0], r.PerUser[1], r.ActivityShift)
+	return b.String()
+}
+
+// meanStdDev returns the mean and standard deviation of the finite values
+// in s, both 0 if there are none.
+func meanStdDev(s []float32) (float64, float64) {
+	mean := Mean32(s)
+	var ss float64
+	var n int
+	for _, x := range s {
+		if d := float64(x) - mean; !math.IsNaN(d) && !math.IsInf(d, 0) {
+			ss += d * d
+			n++
+		}
+	}
+	if n == 0 {
+		return mean, 0
+	}
+	return mean, math.Sqrt(ss / float64(n))
+}
+
+// ratingValues returns the finite ratings of d, as ksStatistic cannot order
+// NaNs.
+func ratingValues(d *Dataset) []float64 {
+	v := make([]float64, 0, len(d.Ratings))
+	for _, r := range d.Ratings {
+		if !math.IsNaN(float64(r)) && !math.IsInf(float64(r), 0) {
+			v = append(v, float64(r))
+		}
+	}
+	return v
+}
+
+func userActivity(d *Dataset) []float64 {
+	counts := d.UserCounts()
+	v := make([]float64, len(counts))
+	for u, n := range counts {
+		v[u] = float64(n)
+	}
+	return v
+}
+
+func keyChanges(before, after map[string]int) (added, dropped int) {
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			added++
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			dropped++
+		}
+	}
+	return added, dropped
+}
+
+// ksStatistic returns the two-sample Kolmogorov-Smirnov statistic of a and
+// b, sorting both in place.
+func ksStatistic(a, b []float64) float64 {
+	sort.Float64s(a)
+	sort.Float64s(b)
+	var d float64
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		x := math.Min(a[i], b[j])
+		for i < len(a) && a[i] == x {
+			i++
+		}
+		for j < len(b) && b[j] == x {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/float64(len(a))-float64(j)/float64(len(b))))
+	}
+	return d
+}
@@ -0,0 +1,115 @@
+package data
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MaxLineBytes bounds the length of a single CSV or JSONL row, so that a
+// corrupt file without line breaks fails instead of exhausting memory.
+const MaxLineBytes = 1 << 20
+
+var (
+	ErrEmptyID       = errors.New("empty user or item ID")
+	ErrInvalidUTF8   = errors.New("user or item ID is not valid UTF-8")
+	ErrInvalidRating = errors.New("rating is NaN or infinite")
+)
+
+// AppendRating appends a rating after checking that the IDs are non-empty
+// valid UTF-8 and the rating is finite. On error the dataset is unchanged.
+func (d *Dataset) AppendRating(u, i string, r float32) error {
+	if u == "" || i == "" {
+		return ErrEmptyID
+	}
+	if !utf8.ValidString(u) || !utf8.ValidString(i) {
+		return ErrInvalidUTF8
+	}
+	if math.IsNaN(float64(r)) || math.IsInf(float64(r), 0) {
+		return ErrInvalidRating
+	}
+	d.Append(u, i, r)
+	return nil
+}
+
+// ReadCSV reads user,item,rating rows into a new dataset, skipping the first
+// row if header is set. Any malformed row aborts the read with an error
+// naming its line.
+func ReadCSV(r io.Reader, header bool) (*Dataset, error) {
+	return ReadSource(NewCSVSource(r, header))
+}
+
+// ReadLoggedCSV reads user,item,rating,propensity rows, such as feedback on
+// lists served under exploration joined with the propensities logged for
+// them, into a new dataset, skipping the first row if header is set. Any
+// malformed row, including one whose propensity is not in (0, 1], aborts
+// the read with an error naming its line.
+func ReadLoggedCSV(r io.Reader, header bool) (*Dataset, error) {
+	cr := csv.NewReader(&limitedLines{r: r})
+	cr.FieldsPerRecord = 4
+	cr.ReuseRecord = true
+	d := NewDataset()
+	d.Propensities = []float64{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if header {
+			header = false
+			continue
+		}
+		rating, err := strconv.ParseFloat(record[2], 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		p, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !(p > 0 && p <= 1) {
+			return nil, fmt.Errorf("line %d: propensity %v is not in (0, 1]", line, p)
+		}
+		if err := d.AppendRating(record[0], record[1], float32(rating)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		d.Propensities[len(d.Propensities)-1] = p
+	}
+	return d, nil
+}
+
+// ReadJSONL reads one {"user": ..., "item": ..., "rating": ...} object per
+// line into a new dataset. Blank lines are skipped.
+func ReadJSONL(r io.Reader) (*Dataset, error) {
+	return ReadSource(NewJSONLSource(r))
+}
+
+// limitedLines passes r through, failing once MaxLineBytes pass without a
+// newline.
+type limitedLines struct {
+	r   io.Reader
+	run int
+}
+
+func (l *limitedLines) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for k, b := range p[:n] {
+		if b == '\n' {
+			l.run = 0
+			continue
+		}
+		l.run++
+		if l.run > MaxLineBytes {
+			return k, fmt.Errorf("line longer than %d bytes", MaxLineBytes)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// checkConsistent fails t unless the ID maps of d agree with its ID slices
+// and its parallel rating slices line up with them.
+func checkConsistent(t *testing.T, d *Dataset) {
+	t.Helper()
+	if len(d.UserMap) != len(d.UserIDs) || len(d.ItemMap) != len(d.ItemIDs) {
+		t.Fatalf("%d users in UserMap, %d in UserIDs, %d items in ItemMap, %d in ItemIDs",
+			len(d.UserMap), len(d.UserIDs), len(d.ItemMap), len(d.ItemIDs))
+	}
+	for id, u := range d.UserIDs {
+		if d.UserMap[u] != id {
+			t.Fatalf("user %q has ID %d in UserIDs but %d in UserMap", u, id, d.UserMap[u])
+		}
+	}
+	for id, i := range d.ItemIDs {
+		if d.ItemMap[i] != id {
+			t.Fatalf("item %q has ID %d in ItemIDs but %d in ItemMap", i, id, d.ItemMap[i])
+		}
+	}
+	if len(d.Users) != len(d.Ratings) || len(d.Items) != len(d.Ratings) {
+		t.Fatalf("%d users, %d items and %d ratings", len(d.Users), len(d.Items), len(d.Ratings))
+	}
+	for k, r := range d.Ratings {
+		if d.Users[k] < 0 || d.Users[k] >= len(d.UserIDs) || d.Items[k] < 0 || d.Items[k] >= len(d.ItemIDs) {
+			t.Fatalf("rating %d refers to user %d and item %d", k, d.Users[k], d.Items[k])
+		}
+		if math.IsNaN(float64(r)) || math.IsInf(float64(r), 0) {
+			t.Fatalf("rating %d is %v", k, r)
+		}
+	}
+	for _, id := range append(append([]string(nil), d.UserIDs...), d.ItemIDs...) {
+		if id == "" || !utf8.ValidString(id) {
+			t.Fatalf("invalid ID %q", id)
+		}
+	}
+}
+
+// longRow is a row longer than MaxLineBytes.
+var longRow = strings.Repeat("u", MaxLineBytes+1) + ",i,3\n"
+
+func FuzzReadCSV(f *testing.F) {
+	for _, seed := range []string{
+		"u1,i1,4\nu2,i1,3.5\n",
+		"user,item,rating\nu1,i1,4\n",
+		"u1,i1,NaN\n",
+		"u1,i1,+Inf\n",
+		"u1,i1,-inf\n",
+		"\xff\xfe,i1,3\n",
+		"u1,\xc3\x28,3\n",
+		",i1,3\n",
+		"u1,i1\n",
+		"u1,i1,3,4\n",
+		"\"u1,i1,3\n",
+		longRow,
+	} {
+		f.Add([]byte(seed), false)
+		f.Add([]byte(seed), true)
+	}
+	f.Fuzz(func(t *testing.T, data []byte, header bool) {
+		d, err := ReadCSV(bytes.NewReader(data), header)
+		if err != nil {
+			return
+		}
+		checkConsistent(t, d)
+	})
+}
+
+func FuzzReadJSONL(f *testing.F) {
+	for _, seed := range []string{
+		`{"user": "u1", "item": "i1", "rating": 4}` + "\n\n" + `{"user": "u2", "item": "i1", "rating": 3.5}`,
+		`{"user": "u1", "item": "i1", "rating": "NaN"}`,
+		`{"user": "u1", "item": "i1", "rating": 1e400}`,
+		"{\"user\": \"\xff\", \"item\": \"i1\", \"rating\": 3}",
+		`{"user": "\ud800", "item": "i1", "rating": 3}`,
+		`{"user": "", "item": "i1", "rating": 3}`,
+		`{"user": "u1", "item": "i1"`,
+		`[1, 2, 3]`,
+		`{"user": "` + strings.Repeat("u", MaxLineBytes+1) + `", "item": "i1", "rating": 3}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := ReadJSONL(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		checkConsistent(t, d)
+	})
+}
+
+func FuzzAppendRating(f *testing.F) {
+	f.Add("u1", "i1", float32(4))
+	f.Add("u1", "i2", float32(math.NaN()))
+	f.Add("u2", "i1", float32(math.Inf(1)))
+	f.Add("u2", "i1", float32(math.Inf(-1)))
+	f.Add("\xff", "i1", float32(3))
+	f.Add("u1", "\xc3\x28", float32(3))
+	f.Add("", "i1", float32(3))
+	f.Add(strings.Repeat("u", MaxLineBytes+1), "i1", float32(3))
+	f.Fuzz(func(t *testing.T, u, i string, r float32) {
+		d := NewDataset()
+		d.Append("u1", "i1", 4)
+		before := len(d.Ratings)
+		if err := d.AppendRating(u, i, r); err != nil {
+			if len(d.Ratings) != before {
+				t.Fatalf("failed append changed the dataset: %v", err)
+			}
+		} else if len(d.Ratings) != before+1 || d.Ratings[before] != r {
+			t.Fatalf("appended %v, dataset has %v", r, d.Ratings)
+		}
+		checkConsistent(t, d)
+	})
+}
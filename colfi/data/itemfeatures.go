@@ -0,0 +1,181 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ItemFeatures holds metadata of items, such as genre or release year, for
+// filtering recommendations. Every attribute of an item has one or more
+// values, kept as strings.
+type ItemFeatures map[string]map[string][]string
+
+// Number returns the first value of attr of item as a number, and whether
+// there is one.
+func (f ItemFeatures) Number(item, attr string) (float64, bool) {
+	values := f[item][attr]
+	if len(values) == 0 {
+		return 0, false
+	}
+	x, err := strconv.ParseFloat(values[0], 64)
+	return x, err == nil
+}
+
+// ReadItemFeatures reads one JSON object per line, holding the item ID under
+// "item" and its attributes under any other keys, e.g.
+//
+//	{"item": "i1", "genre": ["sci-fi", "drama"], "year": 1999}
+func ReadItemFeatures(r io.Reader) (ItemFeatures, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), MaxLineBytes)
+	f := make(ItemFeatures)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(sc.Bytes(), &obj); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		var item string
+		if err := json.Unmarshal(obj["item"], &item); err != nil || item == "" {
+			return nil, fmt.Errorf("line %d: missing item", line)
+		}
+		delete(obj, "item")
+		attrs := make(map[string][]string, len(obj))
+		for k, raw := range obj {
+			values, err := attrValues(raw)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %w", line, k, err)
+			}
+			attrs[k] = values
+		}
+		f[item] = attrs
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, fmt.Errorf("line longer than %d bytes", MaxLineBytes)
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// attrValues converts a JSON string, number or bool, or an array of them, to
+// strings.
+func attrValues(raw json.RawMessage) ([]string, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		list = []json.RawMessage{raw}
+	}
+	values := make([]string, len(list))
+	for k, v := range list {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			values[k] = s
+			continue
+		}
+		var x interface{}
+		if err := json.Unmarshal(v, &x); err != nil {
+			return nil, err
+		}
+		switch x.(type) {
+		case float64, bool:
+			values[k] = string(bytes.TrimSpace(v))
+		default:
+			return nil, fmt.Errorf("unsupported value %s", v)
+		}
+	}
+	return values, nil
+}
+
+// ItemCondition is a test on one attribute of an item, such as genre=sci-fi
+// or year>=2000. = and != test whether any value equals Value; <, <=, > and
+// >= compare numerically if both sides are numbers and as strings otherwise.
+type ItemCondition struct {
+	Attr  string
+	Op    string
+	Value string
+}
+
+// Longer operators come first so that >= is not read as >.
+var conditionOps = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// ParseItemCondition parses a condition of the form attr<op>value.
+func ParseItemCondition(s string) (ItemCondition, error) {
+	best := -1
+	var op string
+	for _, o := range conditionOps {
+		if k := strings.Index(s, o); k > 0 && (best < 0 || k < best || k == best && len(o) > len(op)) {
+			best, op = k, o
+		}
+	}
+	if best < 0 {
+		return ItemCondition{}, fmt.Errorf("condition %q has no operator", s)
+	}
+	return ItemCondition{Attr: strings.TrimSpace(s[:best]), Op: op, Value: strings.TrimSpace(s[best+len(op):])}, nil
+}
+
+// Match reports whether item meets all of conds. Items without features, or
+// without an attribute a condition tests, do not match, except for !=.
+func (f ItemFeatures) Match(item string, conds []ItemCondition) bool {
+	attrs := f[item]
+	for _, c := range conds {
+		if !c.match(attrs[c.Attr]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c ItemCondition) match(values []string) bool {
+	if c.Op == "!=" {
+		for _, v := range values {
+			if v == c.Value {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if c.matchValue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c ItemCondition) matchValue(v string) bool {
+	if c.Op == "=" {
+		return v == c.Value
+	}
+	cmp := strings.Compare(v, c.Value)
+	a, errA := strconv.ParseFloat(v, 64)
+	b, errB := strconv.ParseFloat(c.Value, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		default:
+			cmp = 0
+		}
+	}
+	switch c.Op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
@@ -0,0 +1,112 @@
+package data
+
+import "sort"
+
+type ShillConfig struct {
+	// MinRatings is the number of ratings below which a user is never
+	// flagged.
+	MinRatings int
+	// MaxSameShare is the share of a user's ratings with one value above
+	// which the user is flagged.
+	MaxSameShare float64
+}
+
+type FlaggedUser struct {
+	User      string
+	Ratings   int
+	Value     float32
+	SameShare float64
+}
+
+// DetectShills flags users with an implausible rating pattern: many ratings
+// nearly all of the same value, as left by scripts pushing or burying items.
+// Datasets carry no timestamps, so bursts are recognized by volume alone.
+// Flagged users are returned with the most active first.
+func DetectShills(d *Dataset, config *ShillConfig) []FlaggedUser {
+	if config == nil {
+		config = &ShillConfig{}
+	}
+	if config.MinRatings == 0 {
+		config.MinRatings = 1000
+	}
+	if config.MaxSameShare == 0 {
+		config.MaxSameShare = .95
+	}
+	counts := make([]map[float32]int, len(d.UserMap))
+	for idx, u := range d.Users {
+		if counts[u] == nil {
+			counts[u] = make(map[float32]int)
+		}
+		counts[u][d.Ratings[idx]]++
+	}
+	var flagged []FlaggedUser
+	for uid, c := range counts {
+		f := FlaggedUser{User: d.UserIDs[uid]}
+		var top int
+		for v, n := range c {
+			f.Ratings += n
+			if n > top || n == top && v < f.Value {
+				top, f.Value = n, v
+			}
+		}
+		if f.Ratings < config.MinRatings {
+			continue
+		}
+		f.SameShare = float64(top) / float64(f.Ratings)
+		if f.SameShare > config.MaxSameShare {
+			flagged = append(flagged, f)
+		}
+	}
+	sort.Slice(flagged, func(a, b int) bool {
+		return flagged[a].Ratings > flagged[b].Ratings
+	})
+	return flagged
+}
+
+// WithoutUsers returns a copy of d without the ratings of the given users,
+// e.g. those flagged by DetectShills.
+func (d *Dataset) WithoutUsers(users []FlaggedUser) *Dataset {
+	drop := make(map[int]bool, len(users))
+	for _, f := range users {
+		if uid, ok := d.UserMap[f.User]; ok {
+			drop[uid] = true
+		}
+	}
+	return d.Filter(func(idx int) bool {
+		return !drop[d.Users[idx]]
+	})
+}
+
+// Filter returns a copy of d holding the ratings for which keep returns
+// true. Users and items left without ratings are dropped and internal IDs
+// are reassigned in order of first appearance. Contextual features keep
+// their IDs and propensities are kept.
+func (d *Dataset) Filter(keep func(idx int) bool) *Dataset {
+	f := NewDataset()
+	if d.Context != nil {
+		f.Context = [][]FeatureValue{}
+		for k, v := range d.FeatureMap {
+			f.FeatureMap[k] = v
+		}
+		for k, v := range d.FieldMap {
+			f.FieldMap[k] = v
+		}
+		f.Fields = append([]int(nil), d.Fields...)
+	}
+	if d.Propensities != nil {
+		f.Propensities = []float64{}
+	}
+	for idx, r := range d.Ratings {
+		if !keep(idx) {
+			continue
+		}
+		f.Append(d.UserIDs[d.Users[idx]], d.ItemIDs[d.Items[idx]], r)
+		if d.Context != nil {
+			f.Context[len(f.Context)-1] = d.Context[idx]
+		}
+		if d.Propensities != nil {
+			f.Propensities[len(f.Propensities)-1] = d.Propensities[idx]
+		}
+	}
+	return f
+}
@@ -0,0 +1,195 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// RatingSource yields ratings one at a time, so that datasets can be built
+// from files, databases or message queues alike. Next returns false at the
+// end of the source or on the first error, which Err then returns.
+type RatingSource interface {
+	Next() (u, i string, r float32, ok bool)
+	Err() error
+}
+
+// lineSource is implemented by sources that know the input line of the
+// rating last returned, for error messages.
+type lineSource interface {
+	line() int
+}
+
+// ReadSource reads all ratings of src into a new dataset. Ratings are
+// checked as by AppendRating and the first invalid one aborts the read.
+func ReadSource(src RatingSource) (*Dataset, error) {
+	d := NewDataset()
+	if err := d.AppendSource(src); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// AppendSource appends all ratings of src to d, stopping at the first
+// invalid one.
+func (d *Dataset) AppendSource(src RatingSource) error {
+	ls, _ := src.(lineSource)
+	for n := 1; ; n++ {
+		u, i, r, ok := src.Next()
+		if !ok {
+			return src.Err()
+		}
+		if err := d.AppendRating(u, i, r); err != nil {
+			if ls != nil {
+				return fmt.Errorf("line %d: %w", ls.line(), err)
+			}
+			return fmt.Errorf("rating %d: %w", n, err)
+		}
+	}
+}
+
+// ReadSlices drains src into parallel slices, e.g. for DatasetsFromSlices.
+func ReadSlices(src RatingSource) ([]string, []string, []float32, error) {
+	var us, is []string
+	var rs []float32
+	for {
+		u, i, r, ok := src.Next()
+		if !ok {
+			return us, is, rs, src.Err()
+		}
+		us = append(us, u)
+		is = append(is, i)
+		rs = append(rs, r)
+	}
+}
+
+type sliceSource struct {
+	u, i []string
+	r    []float32
+	next int
+}
+
+// NewSliceSource yields the ratings of parallel slices, which must have the
+// same length.
+func NewSliceSource(u, i []string, r []float32) RatingSource {
+	return &sliceSource{u: u, i: i, r: r}
+}
+
+func (s *sliceSource) Next() (string, string, float32, bool) {
+	if s.next >= len(s.u) || s.next >= len(s.i) || s.next >= len(s.r) {
+		return "", "", 0, false
+	}
+	k := s.next
+	s.next++
+	return s.u[k], s.i[k], s.r[k], true
+}
+
+func (s *sliceSource) Err() error {
+	if len(s.u) != len(s.i) || len(s.u) != len(s.r) {
+		return fmt.Errorf("u, i and r slices must be the same length")
+	}
+	return nil
+}
+
+type csvSource struct {
+	cr     *csv.Reader
+	header bool
+	pos    int
+	err    error
+}
+
+// NewCSVSource yields user,item,rating rows, skipping the first row if
+// header is set.
+func NewCSVSource(r io.Reader, header bool) RatingSource {
+	cr := csv.NewReader(&limitedLines{r: r})
+	cr.FieldsPerRecord = 3
+	cr.ReuseRecord = true
+	return &csvSource{cr: cr, header: header}
+}
+
+func (s *csvSource) Next() (string, string, float32, bool) {
+	if s.err != nil {
+		return "", "", 0, false
+	}
+	for {
+		record, err := s.cr.Read()
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			return "", "", 0, false
+		}
+		s.pos, _ = s.cr.FieldPos(0)
+		if s.header {
+			s.header = false
+			continue
+		}
+		rating, err := strconv.ParseFloat(record[2], 32)
+		if err != nil {
+			s.err = fmt.Errorf("line %d: %w", s.pos, err)
+			return "", "", 0, false
+		}
+		return record[0], record[1], float32(rating), true
+	}
+}
+
+func (s *csvSource) Err() error { return s.err }
+func (s *csvSource) line() int  { return s.pos }
+
+type jsonRating struct {
+	User   string
+	Item   string
+	Rating *float64
+}
+
+type jsonlSource struct {
+	sc  *bufio.Scanner
+	pos int
+	err error
+}
+
+// NewJSONLSource yields one {"user": ..., "item": ..., "rating": ...}
+// object per line, skipping blank lines.
+func NewJSONLSource(r io.Reader) RatingSource {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), MaxLineBytes)
+	return &jsonlSource{sc: sc}
+}
+
+func (s *jsonlSource) Next() (string, string, float32, bool) {
+	if s.err != nil {
+		return "", "", 0, false
+	}
+	for s.sc.Scan() {
+		s.pos++
+		b := s.sc.Bytes()
+		if len(b) == 0 {
+			continue
+		}
+		var jr jsonRating
+		if err := json.Unmarshal(b, &jr); err != nil {
+			s.err = fmt.Errorf("line %d: %w", s.pos, err)
+			return "", "", 0, false
+		}
+		if jr.Rating == nil {
+			s.err = fmt.Errorf("line %d: missing rating", s.pos)
+			return "", "", 0, false
+		}
+		return jr.User, jr.Item, float32(*jr.Rating), true
+	}
+	if err := s.sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			s.err = fmt.Errorf("line longer than %d bytes", MaxLineBytes)
+		} else {
+			s.err = err
+		}
+	}
+	return "", "", 0, false
+}
+
+func (s *jsonlSource) Err() error { return s.err }
+func (s *jsonlSource) line() int  { return s.pos }
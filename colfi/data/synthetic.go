@@ -0,0 +1,47 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// SyntheticRatings generates nRatings distinct ratings between 1 and 5 from a
+// rank-3 model with Gaussian noise, in the form DatasetsFromSlices takes. The
+// same seed always yields the same ratings.
+func SyntheticRatings(seed int64, nUsers, nItems, nRatings int) ([]string, []string, []float32, error) {
+	if nRatings > nUsers*nItems {
+		return nil, nil, nil, fmt.Errorf("cannot draw %d distinct ratings from %d users and %d items", nRatings, nUsers, nItems)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	const k = 3
+	pu := make([]float64, nUsers*k)
+	qi := make([]float64, nItems*k)
+	for f := range pu {
+		pu[f] = rng.NormFloat64()
+	}
+	for f := range qi {
+		qi[f] = rng.NormFloat64()
+	}
+	us := make([]string, 0, nRatings)
+	is := make([]string, 0, nRatings)
+	rs := make([]float32, 0, nRatings)
+	seen := make(map[[2]int]bool, nRatings)
+	for len(rs) < nRatings {
+		u, i := rng.Intn(nUsers), rng.Intn(nItems)
+		if seen[[2]int{u, i}] {
+			continue
+		}
+		seen[[2]int{u, i}] = true
+		var p float64
+		for f := 0; f < k; f++ {
+			p += pu[u*k+f] * qi[i*k+f]
+		}
+		r := 3 + .7*p + .3*rng.NormFloat64()
+		us = append(us, "u"+strconv.Itoa(u))
+		is = append(is, "i"+strconv.Itoa(i))
+		rs = append(rs, float32(math.Max(1, math.Min(5, r))))
+	}
+	return us, is, rs, nil
+}
@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+	"main/colfi/train"
+)
+
+// adviseTakeOff is the relative drop below the first epoch's loss taken as a
+// sign that training has left its initial plateau.
+const adviseTakeOff = .01
+
+type AdviseConfig struct {
+	// SampleRate is the fraction of the ratings used for the trial runs, a
+	// fifth of which is held out for validation.
+	SampleRate float64
+	LR         []float64
+	// MaxEpochs caps the suggested number of epochs for the full run.
+	MaxEpochs int
+	// Patience is the number of epochs without improvement after which a
+	// trial run stops.
+	Patience   int
+	NumWorkers int
+	Verbose    bool
+}
+
+type EpochAdvice struct {
+	NumEpochs int
+	LR        float64
+	Loss      float64
+}
+
+// AdviseEpochs trains an SVD with the given config on a sample of trainset
+// for each candidate learning rate, stopping each run early once validation
+// RMSE stops improving, and suggests the best learning rate with a number of
+// epochs for the full run. Sampling ratings leaves every user and item with
+// SampleRate times as many updates per epoch, so the epoch at which the
+// sample run peaked is scaled down by SampleRate. Loss is the validation RMSE
+// on the sample, which is typically worse than the full run will achieve.
+func AdviseEpochs(trainset *data.Dataset, config *train.SVDConfig, advise *AdviseConfig) (EpochAdvice, error) {
+	if advise == nil {
+		advise = &AdviseConfig{}
+	}
+	if advise.SampleRate == 0 {
+		advise.SampleRate = .1
+	}
+	if len(advise.LR) == 0 {
+		advise.LR = []float64{.002, .005, .01, .02}
+	}
+	if advise.MaxEpochs == 0 {
+		advise.MaxEpochs = 50
+	}
+	if advise.Patience == 0 {
+		advise.Patience = 3
+	}
+	if advise.SampleRate <= 0 || advise.SampleRate > 1 {
+		return EpochAdvice{}, fmt.Errorf("SampleRate must be between 0 and 1, got %v", advise.SampleRate)
+	}
+	if err := trainset.Validate(); err != nil {
+		return EpochAdvice{}, err
+	}
+	if config == nil {
+		config = &train.SVDConfig{}
+	}
+
+	// The sample and its split draw from config's Source, as the trial runs
+	// do.
+	rng := random.Or(config.Source)
+	n := int(math.Round(float64(len(trainset.Ratings)) * advise.SampleRate))
+	u := make([]string, n)
+	i := make([]string, n)
+	r := make([]float32, n)
+	for k, idx := range rng.Perm(len(trainset.Ratings))[:n] {
+		u[k] = trainset.UserIDs[trainset.Users[idx]]
+		i[k] = trainset.ItemIDs[trainset.Items[idx]]
+		r[k] = trainset.Ratings[idx]
+	}
+	sample, validation, err := data.DatasetsFromSlices(u, i, r, .2, rng)
+	if err != nil {
+		return EpochAdvice{}, err
+	}
+
+	best := EpochAdvice{Loss: math.Inf(1)}
+	for _, lr := range advise.LR {
+		c := *config
+		c.LR = lr
+		c.Instrument = false
+		c.Verbose = false
+		m, err := train.NewSVD(sample, &c)
+		if err != nil {
+			return EpochAdvice{}, err
+		}
+		runBest := EpochAdvice{LR: lr, Loss: math.Inf(1)}
+		// SGD from a small random init often sits on a plateau for a while
+		// before the factors break symmetry, so patience only starts to count
+		// once the loss has dropped clearly below that of the first epoch.
+		var first float64
+		converging := false
+		maxEpochs := int(math.Ceil(float64(advise.MaxEpochs) / advise.SampleRate))
+		for epoch := 1; epoch <= maxEpochs; epoch++ {
+			m.Fit(1)
+			loss := Evaluate(m, validation, advise.NumWorkers, NewRMSE).All
+			if epoch == 1 {
+				first = loss
+			}
+			if loss < runBest.Loss {
+				runBest.Loss = loss
+				runBest.NumEpochs = epoch
+			}
+			if loss < first*(1-adviseTakeOff) {
+				converging = true
+			}
+			if converging && epoch-runBest.NumEpochs >= advise.Patience {
+				break
+			}
+		}
+		if advise.Verbose {
+			log.Printf("LR %v: best loss %.4f at epoch %d", lr, runBest.Loss, runBest.NumEpochs)
+		}
+		if runBest.Loss < best.Loss {
+			best = runBest
+		}
+	}
+	best.NumEpochs = int(math.Ceil(float64(best.NumEpochs) * advise.SampleRate))
+	return best, nil
+}
@@ -0,0 +1,87 @@
+package eval
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+type CheckpointConfig struct {
+	// Every is the number of epochs between checkpoints.
+	Every      int
+	Testset    *data.Dataset
+	NumWorkers int
+	NewMetric  func() Metric
+	Precision  Precision
+	// Dir, if set, receives a snapshot of the model at every checkpoint,
+	// named epoch-<n>.gob.
+	Dir     string
+	Verbose bool
+}
+
+type Checkpoint struct {
+	Epoch   int
+	Eval    EvalResult
+	Path    string
+	Runtime time.Duration
+}
+
+// FitCheckpoints trains m for numEpochs, evaluating it on the testset every
+// config.Every epochs and after the last one, so that a single run yields the
+// whole epochs-vs-quality curve. Runtime is the training time up to each
+// checkpoint, excluding evaluation and snapshots.
+func FitCheckpoints(m train.Model, numEpochs int, config *CheckpointConfig) ([]Checkpoint, error) {
+	if config == nil {
+		config = &CheckpointConfig{}
+	}
+	if config.Every == 0 {
+		config.Every = 1
+	}
+	if config.NewMetric == nil {
+		config.NewMetric = NewRMSE
+	}
+	if config.Every < 0 {
+		return nil, fmt.Errorf("Every must be positive, got %d", config.Every)
+	}
+	if config.Testset == nil {
+		return nil, fmt.Errorf("no testset to evaluate checkpoints on")
+	}
+	if err := data.CheckScales(m.GetDataset(), config.Testset); err != nil {
+		log.Printf("FitCheckpoints: warning: %v", err)
+	}
+
+	var checkpoints []Checkpoint
+	var trained time.Duration
+	for epoch := 0; epoch < numEpochs; {
+		n := config.Every
+		if epoch+n > numEpochs {
+			n = numEpochs - epoch
+		}
+		start := time.Now()
+		m.Fit(n)
+		trainedAt := time.Now()
+		trained += trainedAt.Sub(start)
+		epoch += n
+
+		c := Checkpoint{
+			Epoch:   epoch,
+			Eval:    EvaluatePrecision(m, config.Testset, config.NumWorkers, config.NewMetric, config.Precision),
+			Runtime: trained,
+		}
+		if config.Dir != "" {
+			c.Path = filepath.Join(config.Dir, fmt.Sprintf("epoch-%d.gob", epoch))
+			if err := train.SaveFileMetadata(c.Path, m, train.Metadata{TrainedAt: trainedAt.UTC()}); err != nil {
+				return checkpoints, err
+			}
+		}
+		if config.Verbose {
+			log.Printf("checkpoint at epoch %d: loss %.4f (known %.4f)", epoch, c.Eval.All, c.Eval.Known)
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, nil
+}
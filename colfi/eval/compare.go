@@ -0,0 +1,371 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+	"main/colfi/train"
+)
+
+// CompareFamily is a model family Compare can tune: the grid of parameters
+// it is tuned over and how to build a model from one point of it.
+type CompareFamily struct {
+	Grid CompareGrid
+	// New builds a model of the family on d, given a value for every
+	// parameter of the grid.
+	New func(d *data.Dataset, params CompareParams) (train.Model, error)
+}
+
+// CompareGrid lists the values tried for each parameter, by name.
+type CompareGrid map[string][]float64
+
+// CompareParams is one point of a CompareGrid.
+type CompareParams map[string]float64
+
+// String lists the parameters in name order, e.g. "NumFactors=10 Reg=0.02".
+func (p CompareParams) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for k, name := range names {
+		names[k] = fmt.Sprintf("%s=%v", name, p[name])
+	}
+	return strings.Join(names, " ")
+}
+
+// points returns every point of g, in a fixed order.
+func (g CompareGrid) points() []CompareParams {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	points := []CompareParams{{}}
+	for _, name := range names {
+		next := make([]CompareParams, 0, len(points)*len(g[name]))
+		for _, p := range points {
+			for _, v := range g[name] {
+				q := CompareParams{name: v}
+				for n, x := range p {
+					q[n] = x
+				}
+				next = append(next, q)
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// factorGrid is the grid of the latent factor families.
+var factorGrid = CompareGrid{
+	"NumFactors": {10, 25, 50},
+	"Reg":        {.02, .05},
+}
+
+// svdFamily tunes NumFactors and Reg of a model built from an SVDConfig.
+func svdFamily(newModel func(*data.Dataset, *train.SVDConfig) (train.Model, error), solver train.SVDSolver, reg []float64) CompareFamily {
+	return CompareFamily{
+		Grid: CompareGrid{"NumFactors": factorGrid["NumFactors"], "Reg": reg},
+		New: func(d *data.Dataset, params CompareParams) (train.Model, error) {
+			return newModel(d, &train.SVDConfig{
+				NumFactors: int(params["NumFactors"]),
+				Reg:        params["Reg"],
+				Solver:     solver,
+			})
+		},
+	}
+}
+
+// CompareFamilies are the model families Compare can tune, by name.
+var CompareFamilies = map[string]CompareFamily{
+	"svd":     svdFamily(train.NewSVD, train.SGDSolver, factorGrid["Reg"]),
+	"svdpp":   svdFamily(train.NewSVDpp, train.SGDSolver, factorGrid["Reg"]),
+	"asvd":    svdFamily(train.NewAsymSVD, train.SGDSolver, factorGrid["Reg"]),
+	"hashsvd": svdFamily(train.NewHashedSVD, train.SGDSolver, factorGrid["Reg"]),
+	// ALS scales Reg by the number of ratings of a row, so it takes larger
+	// values.
+	"als": svdFamily(train.NewSVD, train.ALSSolver, []float64{.05, .1}),
+	"itemknn": {
+		Grid: CompareGrid{
+			"K":          {20, 40, 80},
+			"MinSupport": {1, 5},
+		},
+		New: func(d *data.Dataset, params CompareParams) (train.Model, error) {
+			return train.NewKNNItemBaseline(d, &train.KNNConfig{
+				K:          int(params["K"]),
+				MinSupport: int(params["MinSupport"]),
+				Similarity: train.PearsonSimilarity,
+			})
+		},
+	},
+}
+
+type CompareConfig struct {
+	// Grids replaces the grid of the families it names.
+	Grids map[string]CompareGrid
+	// TuneEpochs is the length of a tuning trial and TuneSampleRate the
+	// fraction of the trainset trials use, a fifth of it for validation.
+	TuneEpochs     int
+	TuneSampleRate float64
+	// NumEpochs is the length of the final run of each family's best
+	// configuration on the full trainset.
+	NumEpochs  int
+	NumWorkers int
+	// State, if set, is a file the result of every finished family is saved
+	// to, so that an interrupted comparison skips them when run again. A
+	// family is run again if its grid or epochs changed, and all of them
+	// are if the trainset did.
+	State   string
+	Verbose bool
+}
+
+type CompareResult struct {
+	Family string
+	// Params is the chosen point of the family's grid.
+	Params CompareParams
+	// TuneLoss is the validation RMSE of the chosen configuration on the
+	// tuning sample.
+	TuneLoss float64
+	Eval     EvalResult
+	Runtime  time.Duration
+}
+
+// Compare tunes each of the named families briefly on a sample of trainset,
+// trains the best configuration of each on all of it and evaluates it on
+// testset. Results are in the order of families.
+func Compare(trainset, testset *data.Dataset, families []string, config *CompareConfig) ([]CompareResult, error) {
+	if config == nil {
+		config = &CompareConfig{}
+	}
+	if config.TuneEpochs == 0 {
+		config.TuneEpochs = 5
+	}
+	if config.TuneSampleRate == 0 {
+		config.TuneSampleRate = .2
+	}
+	if config.NumEpochs == 0 {
+		config.NumEpochs = 20
+	}
+	if config.TuneSampleRate <= 0 || config.TuneSampleRate > 1 {
+		return nil, fmt.Errorf("TuneSampleRate must be between 0 and 1, got %v", config.TuneSampleRate)
+	}
+	for _, f := range families {
+		if _, ok := CompareFamilies[f]; !ok {
+			return nil, fmt.Errorf("unknown model family %q, want one of %s", f, strings.Join(compareFamilyNames(), ", "))
+		}
+	}
+	if err := trainset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := data.CheckScales(trainset, testset); err != nil {
+		log.Printf("Compare: warning: %v", err)
+	}
+
+	for f, grid := range config.Grids {
+		if _, ok := CompareFamilies[f]; !ok {
+			return nil, fmt.Errorf("grid of unknown model family %q", f)
+		}
+		if len(grid.points()) == 0 {
+			return nil, fmt.Errorf("grid of %s is empty", f)
+		}
+	}
+
+	state, err := readCompareState(config.State, trainsetHash(trainset))
+	if err != nil {
+		return nil, err
+	}
+	sample, validation, err := tuningSample(trainset, config.TuneSampleRate)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]CompareResult, 0, len(families))
+	for _, f := range families {
+		run := compareRun{
+			Grid:           config.grid(f),
+			TuneEpochs:     config.TuneEpochs,
+			TuneSampleRate: config.TuneSampleRate,
+			NumEpochs:      config.NumEpochs,
+		}
+		if done, ok := state.Families[f]; ok && done.sameRun(run) {
+			if config.Verbose {
+				log.Printf("%s: resumed from %s", f, config.State)
+			}
+			results = append(results, done.Result)
+			continue
+		}
+		r, err := compareFamily(f, run.Grid, sample, validation, trainset, testset, config)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", f, err)
+		}
+		results = append(results, r)
+		run.Result = r
+		state.Families[f] = run
+		if err := writeCompareState(config.State, state); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// grid returns the grid family f is tuned over.
+func (config *CompareConfig) grid(f string) CompareGrid {
+	if grid, ok := config.Grids[f]; ok {
+		return grid
+	}
+	return CompareFamilies[f].Grid
+}
+
+func compareFamily(f string, grid CompareGrid, sample, validation, trainset, testset *data.Dataset, config *CompareConfig) (CompareResult, error) {
+	newModel := CompareFamilies[f].New
+	best := CompareResult{Family: f, TuneLoss: math.Inf(1)}
+	for _, params := range grid.points() {
+		m, err := newModel(sample, params)
+		if err != nil {
+			return CompareResult{}, err
+		}
+		m.Fit(config.TuneEpochs)
+		loss := Evaluate(m, validation, config.NumWorkers, NewRMSE).All
+		if config.Verbose {
+			log.Printf("%s: %v: validation loss %.4f", f, params, loss)
+		}
+		if loss < best.TuneLoss {
+			best.Params, best.TuneLoss = params, loss
+		}
+	}
+	start := time.Now()
+	m, err := newModel(trainset, best.Params)
+	if err != nil {
+		return CompareResult{}, err
+	}
+	m.Fit(config.NumEpochs)
+	best.Runtime = time.Since(start)
+	best.Eval = Evaluate(m, testset, config.NumWorkers, NewRMSE)
+	if config.Verbose {
+		log.Printf("%s: loss %.4f (known %.4f) with %v", f, best.Eval.All, best.Eval.Known, best.Params)
+	}
+	return best, nil
+}
+
+// tuningSample splits a random sampleRate of d's ratings into a training
+// and a validation set, as AdviseEpochs does.
+func tuningSample(d *data.Dataset, sampleRate float64) (*data.Dataset, *data.Dataset, error) {
+	n := int(math.Round(float64(len(d.Ratings)) * sampleRate))
+	u := make([]string, n)
+	i := make([]string, n)
+	r := make([]float32, n)
+	rng := random.Or(nil)
+	for k, idx := range rng.Perm(len(d.Ratings))[:n] {
+		u[k] = d.UserIDs[d.Users[idx]]
+		i[k] = d.ItemIDs[d.Items[idx]]
+		r[k] = d.Ratings[idx]
+	}
+	return data.DatasetsFromSlices(u, i, r, .2, rng)
+}
+
+func compareFamilyNames() []string {
+	names := make([]string, 0, len(CompareFamilies))
+	for name := range CompareFamilies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compareState is what the state file of Compare holds: the finished
+// families of a comparison on the trainset with the given hash.
+type compareState struct {
+	Trainset uint64
+	Families map[string]compareRun
+}
+
+// compareRun is a finished family, with the settings it was run with.
+type compareRun struct {
+	Grid           CompareGrid
+	TuneEpochs     int
+	TuneSampleRate float64
+	NumEpochs      int
+	Result         CompareResult
+}
+
+// sameRun reports whether r was run with the settings of run.
+func (r compareRun) sameRun(run compareRun) bool {
+	r.Result, run.Result = CompareResult{}, CompareResult{}
+	return reflect.DeepEqual(r, run)
+}
+
+// trainsetHash hashes the ratings of d, in order.
+func trainsetHash(d *data.Dataset) uint64 {
+	h := fnv.New64a()
+	var b [4]byte
+	for k, r := range d.Ratings {
+		io.WriteString(h, d.UserIDs[d.Users[k]])
+		h.Write([]byte{0})
+		io.WriteString(h, d.ItemIDs[d.Items[k]])
+		h.Write([]byte{0})
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(r))
+		h.Write(b[:])
+	}
+	return h.Sum64()
+}
+
+// readCompareState reads the state file at path, if there is one. The state
+// of another trainset than the one with the given hash is discarded.
+func readCompareState(path string, trainset uint64) (*compareState, error) {
+	state := &compareState{Trainset: trainset, Families: make(map[string]compareRun)}
+	if path == "" {
+		return state, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved compareState
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if saved.Trainset != trainset {
+		log.Printf("Compare: %s is of another trainset, starting over", path)
+		return state, nil
+	}
+	if saved.Families != nil {
+		state.Families = saved.Families
+	}
+	return state, nil
+}
+
+// writeCompareState replaces the gob state file through a rename, so that
+// an interruption leaves either the old or the new state.
+func writeCompareState(path string, state *compareState) error {
+	if path == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(state); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,70 @@
+package eval
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// TestCompareState checks that Compare resumes the families of its state
+// file and runs again those whose grid or trainset changed.
+func TestCompareState(t *testing.T) {
+	u, i, r, err := data.SyntheticRatings(1, 100, 50, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	train.Seed(1)
+	defer train.SetRand(nil)
+	trainset, testset, err := data.DatasetsFromSlices(u, i, r, .2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	families := []string{"svd", "als", "itemknn"}
+	state := filepath.Join(t.TempDir(), "state")
+	compare := func(trainset *data.Dataset, grids map[string]CompareGrid) []CompareResult {
+		t.Helper()
+		results, err := Compare(trainset, testset, families, &CompareConfig{
+			Grids:      grids,
+			TuneEpochs: 2,
+			NumEpochs:  2,
+			State:      state,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	first := compare(trainset, nil)
+	for k, f := range families {
+		if first[k].Family != f || len(first[k].Params) != len(CompareFamilies[f].Grid) {
+			t.Fatalf("result %d is %s with %v, want %s with a value of each of %v", k, first[k].Family, first[k].Params, f, CompareFamilies[f].Grid)
+		}
+	}
+	// A resumed result is the saved one, down to its runtime.
+	if again := compare(trainset, nil); !reflect.DeepEqual(again, first) {
+		t.Errorf("rerun gave %v, want the saved %v", again, first)
+	}
+
+	grids := map[string]CompareGrid{"svd": {"NumFactors": {5}, "Reg": {.1}}}
+	regridded := compare(trainset, grids)
+	if want := (CompareParams{"NumFactors": 5, "Reg": .1}); !reflect.DeepEqual(regridded[0].Params, want) {
+		t.Errorf("svd with a new grid chose %v, want %v", regridded[0].Params, want)
+	}
+	if !reflect.DeepEqual(regridded[1:], first[1:]) {
+		t.Errorf("families whose grid is unchanged gave %v, want the saved %v", regridded[1:], first[1:])
+	}
+
+	other, _, err := data.DatasetsFromSlices(u, i, r, .3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, res := range compare(other, grids) {
+		if res.Runtime == regridded[k].Runtime {
+			t.Errorf("%s was resumed on another trainset", res.Family)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"fmt"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+	"main/colfi/train"
+)
+
+// DryRunEstimate is the expected cost of a full training run, extrapolated
+// from one epoch on a sample of the ratings.
+type DryRunEstimate struct {
+	Ratings        int
+	SampledRatings int
+	// Setup is the time to build the model, Epoch the time of one epoch and
+	// Total the two together for all epochs, on the full dataset.
+	Setup  time.Duration
+	Epoch  time.Duration
+	Total  time.Duration
+	Memory int64
+}
+
+func (e DryRunEstimate) String() string {
+	return fmt.Sprintf("estimated %v for %d ratings (setup %v, %v per epoch), %.1f MiB, from %d sampled ratings",
+		e.Total.Round(time.Millisecond), e.Ratings, e.Setup.Round(time.Millisecond), e.Epoch.Round(time.Millisecond),
+		float64(e.Memory)/(1<<20), e.SampledRatings)
+}
+
+// DryRun builds a model with newModel on a sample of sampleRate of d's
+// ratings, 5% if 0, trains it for one epoch and scales the times linearly
+// in the number of ratings to estimate a run of numEpochs on all of d. The
+// memory estimate is that of EstimateMemory for the factors config ends up
+// with.
+func DryRun(newModel func(*data.Dataset, *train.SVDConfig) (train.Model, error), d *data.Dataset, config *train.SVDConfig, numEpochs int, sampleRate float64) (DryRunEstimate, error) {
+	if sampleRate == 0 {
+		sampleRate = .05
+	}
+	if sampleRate < 0 || sampleRate > 1 {
+		return DryRunEstimate{}, fmt.Errorf("sample rate must be between 0 and 1, got %v", sampleRate)
+	}
+	if config == nil {
+		config = &train.SVDConfig{}
+	}
+	rng := random.Or(config.Source)
+	sample := d.Filter(func(int) bool {
+		return rng.Float64() < sampleRate
+	})
+	if len(sample.Ratings) == 0 {
+		return DryRunEstimate{}, data.ErrEmptyDataset
+	}
+	// Train the sample quietly; config is shared with the caller so that
+	// its defaults are filled in as they would be for the real run.
+	verbose, instrument := config.Verbose, config.Instrument
+	config.Verbose, config.Instrument = false, false
+	defer func() {
+		config.Verbose, config.Instrument = verbose, instrument
+	}()
+
+	start := time.Now()
+	m, err := newModel(sample, config)
+	if err != nil {
+		return DryRunEstimate{}, err
+	}
+	setup := time.Since(start)
+	start = time.Now()
+	m.Fit(1)
+	epoch := time.Since(start)
+
+	scale := float64(len(d.Ratings)) / float64(len(sample.Ratings))
+	e := DryRunEstimate{
+		Ratings:        len(d.Ratings),
+		SampledRatings: len(sample.Ratings),
+		Setup:          time.Duration(float64(setup) * scale),
+		Epoch:          time.Duration(float64(epoch) * scale),
+		Memory:         train.EstimateMemory(len(d.UserMap), len(d.ItemMap), len(d.Ratings), config.NumFactors),
+	}
+	e.Total = e.Setup + time.Duration(numEpochs)*e.Epoch
+	return e, nil
+}
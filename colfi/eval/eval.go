@@ -0,0 +1,538 @@
+// Package eval measures the models of package train on held-out ratings,
+// online and off-policy, and builds the tuning on top of that: grid search,
+// model family comparison, epoch advice and golden regression runs.
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// Metric accumulates prediction errors one rating at a time so that test
+// sets can be scored without materializing every prediction.
+type Metric interface {
+	Add(pred, actual float64)
+	// Merge folds in another accumulator of the same type, e.g. one filled
+	// by a different worker.
+	Merge(other Metric)
+	// Result is NaN if nothing was added.
+	Result() float64
+}
+
+// Metric32 is implemented by metrics that can take float32 predictions and
+// ratings directly, used when evaluating with Float32 precision.
+type Metric32 interface {
+	Add32(pred, actual float32)
+}
+
+// RatingMetric is implemented by metrics that need to know which test rating
+// a prediction is for, such as per-user or weighted metrics. Evaluate calls
+// AddRating with the rating's index in the testset instead of Add.
+type RatingMetric interface {
+	AddRating(idx int, pred, actual float64)
+}
+
+// Precision selects the width predictions are handed to metrics in. Ratings
+// are stored as float32, so Float32 compares them with predictions at their
+// own precision and skips widening every rating.
+type Precision int
+
+const (
+	Float64 Precision = iota
+	Float32
+)
+
+// ParsePrecision parses the name of a precision, float64 or float32.
+func ParsePrecision(s string) (Precision, error) {
+	switch s {
+	case "float64":
+		return Float64, nil
+	case "float32":
+		return Float32, nil
+	}
+	return 0, fmt.Errorf("unknown precision %q, want float64 or float32", s)
+}
+
+type RMSEMetric struct {
+	sum float64
+	n   int
+}
+
+func NewRMSE() Metric {
+	return &RMSEMetric{}
+}
+
+func (a *RMSEMetric) Add(pred, actual float64) {
+	d := pred - actual
+	a.sum += d * d
+	a.n++
+}
+
+func (a *RMSEMetric) Add32(pred, actual float32) {
+	d := pred - actual
+	a.sum += float64(d * d)
+	a.n++
+}
+
+func (a *RMSEMetric) Merge(other Metric) {
+	o := other.(*RMSEMetric)
+	a.sum += o.sum
+	a.n += o.n
+}
+
+func (a *RMSEMetric) Result() float64 {
+	return math.Sqrt(a.sum / float64(a.n))
+}
+
+type MAEMetric struct {
+	sum float64
+	n   int
+}
+
+func NewMAE() Metric {
+	return &MAEMetric{}
+}
+
+func (a *MAEMetric) Add(pred, actual float64) {
+	a.sum += math.Abs(pred - actual)
+	a.n++
+}
+
+func (a *MAEMetric) Add32(pred, actual float32) {
+	d := pred - actual
+	if d < 0 {
+		d = -d
+	}
+	a.sum += float64(d)
+	a.n++
+}
+
+func (a *MAEMetric) Merge(other Metric) {
+	o := other.(*MAEMetric)
+	a.sum += o.sum
+	a.n += o.n
+}
+
+func (a *MAEMetric) Result() float64 {
+	return a.sum / float64(a.n)
+}
+
+// UserRMSEMetric is the RMSE of every user averaged over users, so that
+// heavy users count no more than light ones.
+type UserRMSEMetric struct {
+	users []int
+	sums  map[int]*RMSEMetric
+}
+
+// NewUserRMSE returns a constructor for UserRMSEMetric on testset. Ratings
+// added through Add, without their index, are pooled as a single user.
+func NewUserRMSE(testset *data.Dataset) func() Metric {
+	return func() Metric {
+		return &UserRMSEMetric{users: testset.Users, sums: make(map[int]*RMSEMetric)}
+	}
+}
+
+func (a *UserRMSEMetric) Add(pred, actual float64) {
+	a.add(-1, pred, actual)
+}
+
+func (a *UserRMSEMetric) AddRating(idx int, pred, actual float64) {
+	a.add(a.users[idx], pred, actual)
+}
+
+func (a *UserRMSEMetric) add(u int, pred, actual float64) {
+	s, ok := a.sums[u]
+	if !ok {
+		s = &RMSEMetric{}
+		a.sums[u] = s
+	}
+	s.Add(pred, actual)
+}
+
+func (a *UserRMSEMetric) Merge(other Metric) {
+	for u, o := range other.(*UserRMSEMetric).sums {
+		if s, ok := a.sums[u]; ok {
+			s.Merge(o)
+		} else {
+			a.sums[u] = o
+		}
+	}
+}
+
+func (a *UserRMSEMetric) Result() float64 {
+	var sum float64
+	for _, s := range a.sums {
+		sum += s.Result()
+	}
+	return sum / float64(len(a.sums))
+}
+
+// WeightedRMSEMetric is the RMSE with every squared error weighted by the
+// sample weight of its rating.
+type WeightedRMSEMetric struct {
+	weights []float64
+	sum     float64
+	total   float64
+}
+
+// NewWeightedRMSE returns a constructor for WeightedRMSEMetric with one
+// weight per testset rating, in testset order. Ratings added through Add,
+// without their index, have weight 1.
+func NewWeightedRMSE(weights []float64) func() Metric {
+	return func() Metric {
+		return &WeightedRMSEMetric{weights: weights}
+	}
+}
+
+func (a *WeightedRMSEMetric) Add(pred, actual float64) {
+	a.add(1, pred, actual)
+}
+
+func (a *WeightedRMSEMetric) AddRating(idx int, pred, actual float64) {
+	a.add(a.weights[idx], pred, actual)
+}
+
+func (a *WeightedRMSEMetric) add(w, pred, actual float64) {
+	d := pred - actual
+	a.sum += w * d * d
+	a.total += w
+}
+
+func (a *WeightedRMSEMetric) Merge(other Metric) {
+	o := other.(*WeightedRMSEMetric)
+	a.sum += o.sum
+	a.total += o.total
+}
+
+func (a *WeightedRMSEMetric) Result() float64 {
+	return math.Sqrt(a.sum / a.total)
+}
+
+// SquaredError and AbsoluteError are per-rating losses for IPSMetric.
+func SquaredError(pred, actual float64) float64 {
+	d := pred - actual
+	return d * d
+}
+
+func AbsoluteError(pred, actual float64) float64 {
+	return math.Abs(pred - actual)
+}
+
+// IPSMetric estimates the mean of a per-rating loss over all user-item
+// pairs, rated or not, from test ratings observed under a logging policy
+// with known propensities, such as feedback on lists served with
+// exploration. Each loss is weighted by the inverse of its rating's
+// propensity, so that the items the policy showed most often do not
+// dominate the estimate (Schnabel et al., 2016). With SquaredError it
+// estimates the MSE.
+type IPSMetric struct {
+	propensities []float64
+	loss         func(pred, actual float64) float64
+	// population is the number of pairs the IPS estimate averages over,
+	// zero for the self-normalized estimate.
+	population float64
+	sum        float64
+	total      float64
+}
+
+// NewIPS returns a constructor for the inverse propensity scoring estimate
+// on testset, whose Propensities give the weights: the weighted sum of the
+// losses divided by population, the number of user-item pairs the logging
+// policy could have shown. It is unbiased if the propensities are right,
+// but has a high variance when some are small. Ratings added through Add,
+// without their index, and ratings of a testset without propensities have
+// propensity 1.
+func NewIPS(testset *data.Dataset, loss func(pred, actual float64) float64, population int) func() Metric {
+	return func() Metric {
+		return &IPSMetric{propensities: testset.Propensities, loss: loss, population: float64(population)}
+	}
+}
+
+// NewSNIPS is NewIPS with the self-normalized estimate, which divides the
+// weighted sum of the losses by the sum of the weights instead. It is
+// slightly biased but much less variable, and needs no population.
+func NewSNIPS(testset *data.Dataset, loss func(pred, actual float64) float64) func() Metric {
+	return func() Metric {
+		return &IPSMetric{propensities: testset.Propensities, loss: loss}
+	}
+}
+
+func (a *IPSMetric) Add(pred, actual float64) {
+	a.add(1, pred, actual)
+}
+
+func (a *IPSMetric) AddRating(idx int, pred, actual float64) {
+	p := 1.0
+	if a.propensities != nil {
+		p = a.propensities[idx]
+	}
+	a.add(p, pred, actual)
+}
+
+func (a *IPSMetric) add(p, pred, actual float64) {
+	a.sum += a.loss(pred, actual) / p
+	a.total += 1 / p
+}
+
+func (a *IPSMetric) Merge(other Metric) {
+	o := other.(*IPSMetric)
+	a.sum += o.sum
+	a.total += o.total
+}
+
+func (a *IPSMetric) Result() float64 {
+	if a.total == 0 {
+		return math.NaN()
+	}
+	if a.population > 0 {
+		return a.sum / a.population
+	}
+	return a.sum / a.total
+}
+
+// EvalStats describes how a test set related to the training data of the
+// model evaluated on it.
+type EvalStats struct {
+	N int
+	// UnknownUsers and UnknownItems count the test ratings whose user or item
+	// does not appear in the training data.
+	UnknownUsers int
+	UnknownItems int
+	// Unseen counts the test ratings whose user or item (or both) does not
+	// appear in the training data.
+	Unseen int
+}
+
+// UnseenMode selects how test ratings involving a user or item that was not
+// seen in training are treated when a single loss is reported.
+type UnseenMode int
+
+const (
+	// FallbackUnseen scores unseen pairs with the model's cold-start
+	// fallback, typically the global mean plus whichever bias is known.
+	FallbackUnseen UnseenMode = iota
+	// SkipUnseen leaves unseen pairs out of the loss.
+	SkipUnseen
+)
+
+// EvalResult reports a metric both over the whole test set and over the
+// ratings whose user and item were both seen in training, so the effect of
+// the cold-start fallback on the headline number is visible. Known is NaN if
+// no such rating exists, and All if the test set is empty.
+type EvalResult struct {
+	All   float64
+	Known float64
+	Stats EvalStats
+}
+
+func (r EvalResult) Loss(mode UnseenMode) float64 {
+	if mode == SkipUnseen {
+		return r.Known
+	}
+	return r.All
+}
+
+// Evaluate scores m on testset with the metric built by newMetric, streaming
+// predictions into accumulators held per worker.
+func Evaluate(m train.Model, testset *data.Dataset, numWorkers int, newMetric func() Metric) EvalResult {
+	return EvaluatePrecision(m, testset, numWorkers, newMetric, Float64)
+}
+
+// EvaluatePrecision is Evaluate with the precision predictions are scored
+// at. With Float32, metrics implementing Metric32 are fed float32 values.
+func EvaluatePrecision(m train.Model, testset *data.Dataset, numWorkers int, newMetric func() Metric, prec Precision) EvalResult {
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	all := make([]Metric, numWorkers)
+	known := make([]Metric, numWorkers)
+	for w := range all {
+		all[w] = newMetric()
+		known[w] = newMetric()
+	}
+	add := func(w, idx int, pred float64, seen bool) {
+		actual := float64(testset.Ratings[idx])
+		all[w].Add(pred, actual)
+		if seen {
+			known[w].Add(pred, actual)
+		}
+	}
+	_, byRating := all[0].(RatingMetric)
+	_, is32 := all[0].(Metric32)
+	switch {
+	case byRating:
+		add = func(w, idx int, pred float64, seen bool) {
+			if prec == Float32 {
+				pred = float64(float32(pred))
+			}
+			actual := float64(testset.Ratings[idx])
+			all[w].(RatingMetric).AddRating(idx, pred, actual)
+			if seen {
+				known[w].(RatingMetric).AddRating(idx, pred, actual)
+			}
+		}
+	case prec == Float32 && is32:
+		add = func(w, idx int, pred float64, seen bool) {
+			p, actual := float32(pred), testset.Ratings[idx]
+			all[w].(Metric32).Add32(p, actual)
+			if seen {
+				known[w].(Metric32).Add32(p, actual)
+			}
+		}
+	case prec == Float32:
+		add = func(w, idx int, pred float64, seen bool) {
+			p, actual := float64(float32(pred)), float64(testset.Ratings[idx])
+			all[w].Add(p, actual)
+			if seen {
+				known[w].Add(p, actual)
+			}
+		}
+	}
+	stats := forEachPrediction(m, testset, numWorkers, add)
+	for w := 1; w < numWorkers; w++ {
+		all[0].Merge(all[w])
+		known[0].Merge(known[w])
+	}
+	return EvalResult{
+		All:   all[0].Result(),
+		Known: known[0].Result(),
+		Stats: stats,
+	}
+}
+
+// PredictDataset predicts every rating in testset with m, split across
+// numWorkers goroutines (all CPUs if numWorkers <= 0).
+func PredictDataset(m train.Model, testset *data.Dataset, numWorkers int) []float64 {
+	pred := make([]float64, len(testset.Ratings))
+	forEachPrediction(m, testset, numWorkers, func(w, idx int, p float64, seen bool) {
+		pred[idx] = p
+	})
+	return pred
+}
+
+// PredictDataset32 is PredictDataset returning float32 predictions, which
+// take half the memory and match the precision of the ratings.
+func PredictDataset32(m train.Model, testset *data.Dataset, numWorkers int) []float32 {
+	pred := make([]float32, len(testset.Ratings))
+	forEachPrediction(m, testset, numWorkers, func(w, idx int, p float64, seen bool) {
+		pred[idx] = float32(p)
+	})
+	return pred
+}
+
+// forEachPrediction calls fn with the prediction for every rating in testset
+// and whether its user and item were both seen in training.
+// Ratings are split into contiguous chunks, one per worker, and fn is only
+// called concurrently for different values of w. The testset's IDs are
+// translated once into the model's vocabulary so models implementing
+// IDPredictor are scored without any per-rating string lookups.
+func forEachPrediction(m train.Model, testset *data.Dataset, numWorkers int, fn func(w, idx int, pred float64, seen bool)) EvalStats {
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	n := len(testset.Ratings)
+	trainset := m.GetDataset()
+	users := translateIDs(testset.UserIDs, trainset.UserMap)
+	items := translateIDs(testset.ItemIDs, trainset.ItemMap)
+	idp, _ := m.(train.IDPredictor)
+
+	stats := EvalStats{N: n}
+	for idx := range testset.Ratings {
+		uid, iid := users[testset.Users[idx]], items[testset.Items[idx]]
+		if uid < 0 {
+			stats.UnknownUsers++
+		}
+		if iid < 0 {
+			stats.UnknownItems++
+		}
+		if uid < 0 || iid < 0 {
+			stats.Unseen++
+		}
+	}
+
+	chunk := (n + numWorkers - 1) / numWorkers
+	var wg sync.WaitGroup
+	for w := 0; w*chunk < n; w++ {
+		start := w * chunk
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			for idx := start; idx < end; idx++ {
+				uid, iid := users[testset.Users[idx]], items[testset.Items[idx]]
+				var pred float64
+				if idp != nil {
+					pred = idp.PredictID(uid, iid)
+				} else {
+					pred = m.Predict(testset.UserIDs[testset.Users[idx]], testset.ItemIDs[testset.Items[idx]])
+				}
+				fn(w, idx, pred, uid >= 0 && iid >= 0)
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+	return stats
+}
+
+var ErrLengthMismatch = errors.New("pred and actual slices must be the same length")
+
+// RMSE returns the root mean squared error of pred against actual, or an
+// error if the slices differ in length or are empty.
+func RMSE(pred, actual []float64) (float64, error) {
+	if len(pred) != len(actual) {
+		return math.NaN(), ErrLengthMismatch
+	}
+	if len(pred) == 0 {
+		return math.NaN(), data.ErrEmptyDataset
+	}
+	acc := NewRMSE()
+	for i := range pred {
+		acc.Add(pred[i], actual[i])
+	}
+	return acc.Result(), nil
+}
+
+// RMSE32 is RMSE for float32 predictions, e.g. from PredictDataset32, and
+// ratings such as Dataset.Ratings.
+func RMSE32(pred, actual []float32) (float64, error) {
+	if len(pred) != len(actual) {
+		return math.NaN(), ErrLengthMismatch
+	}
+	if len(pred) == 0 {
+		return math.NaN(), data.ErrEmptyDataset
+	}
+	acc := &RMSEMetric{}
+	for i := range pred {
+		acc.Add32(pred[i], actual[i])
+	}
+	return acc.Result(), nil
+}
+
+// FitLinear returns the Linear calibration that minimizes the squared error
+// of m's predictions on d, which should be ratings m was not trained on.
+func FitLinear(m train.Model, d *data.Dataset) (train.Linear, error) {
+	var n, sx, sy, sxx, sxy float64
+	for idx, p := range PredictDataset(m, d, 0) {
+		y := float64(d.Ratings[idx])
+		n++
+		sx += p
+		sy += y
+		sxx += p * p
+		sxy += p * y
+	}
+	v := n*sxx - sx*sx
+	if n < 2 || v <= 0 || math.IsNaN(v) {
+		return train.Linear{}, fmt.Errorf("cannot calibrate on %v ratings with constant predictions", n)
+	}
+	scale := (n*sxy - sx*sy) / v
+	return train.Linear{Scale: scale, Offset: (sy - scale*sx) / n}, nil
+}
@@ -0,0 +1,56 @@
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+func TestParsePrecision(t *testing.T) {
+	for s, want := range map[string]Precision{"float64": Float64, "float32": Float32} {
+		if got, err := ParsePrecision(s); err != nil || got != want {
+			t.Errorf("ParsePrecision(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "f32", "Float32"} {
+		if _, err := ParsePrecision(s); err == nil {
+			t.Errorf("ParsePrecision(%q) accepted", s)
+		}
+	}
+}
+
+// TestEvaluatePrecision checks that scoring at float32 changes the RMSE by
+// no more than the rounding of the predictions.
+func TestEvaluatePrecision(t *testing.T) {
+	u, i, r, err := data.SyntheticRatings(1, 100, 50, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	train.Seed(1)
+	defer train.SetRand(nil)
+	trainset, testset, err := data.DatasetsFromSlices(u, i, r, .2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := train.NewSVD(trainset, &train.SVDConfig{NumFactors: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(5)
+	rmse := EvaluatePrecision(m, testset, 2, NewRMSE, Float64)
+	for _, newMetric := range []func() Metric{NewRMSE, NewMAE} {
+		want := EvaluatePrecision(m, testset, 2, newMetric, Float64)
+		got := EvaluatePrecision(m, testset, 2, newMetric, Float32)
+		if math.Abs(got.All-want.All) > 1e-5 || math.Abs(got.Known-want.Known) > 1e-5 {
+			t.Errorf("%T at float32: got %v and %v, want %v and %v", newMetric(), got.All, got.Known, want.All, want.Known)
+		}
+		if got.Stats != want.Stats {
+			t.Errorf("%T at float32: got stats %+v, want %+v", newMetric(), got.Stats, want.Stats)
+		}
+	}
+	if got := Evaluate(m, testset, 2, NewRMSE); got != rmse {
+		t.Errorf("Evaluate: got %+v, want the float64 result %+v", got, rmse)
+	}
+}
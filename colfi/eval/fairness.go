@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"math"
+	"sort"
+
+	"main/colfi/train"
+)
+
+// ItemGroups tags items with the group they belong to, such as their
+// provider. Items without a tag are in group "".
+type ItemGroups map[string]string
+
+// Exposure returns the share of all impressions in lists that goes to each
+// group, counting every listed item as one impression.
+func Exposure(lists [][]train.ScoredItem, groups ItemGroups) map[string]float64 {
+	shares := make(map[string]float64)
+	var total float64
+	for _, l := range lists {
+		for _, s := range l {
+			shares[groups[s.Item]]++
+			total++
+		}
+	}
+	for g := range shares {
+		shares[g] /= total
+	}
+	return shares
+}
+
+// ExposureLimits bounds the share of a top-N list given to a group. Max 0
+// means no upper bound.
+type ExposureLimits struct {
+	Min float64
+	Max float64
+}
+
+// FairRerank picks n items from scored, greedily by score, such that every
+// prefix of the result gives each group with limits at least Min of its
+// positions, as far as the group has candidates, and no group more than Max
+// of the whole list. The result may be shorter than n if the caps leave too
+// few candidates.
+func FairRerank(scored []train.ScoredItem, n int, groups ItemGroups, limits map[string]ExposureLimits) []train.ScoredItem {
+	sorted := append([]train.ScoredItem(nil), scored...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Score > sorted[b].Score
+	})
+	used := make([]bool, len(sorted))
+	count := make(map[string]int)
+	capped := func(g string) bool {
+		l, ok := limits[g]
+		return ok && l.Max > 0 && count[g] >= int(math.Floor(l.Max*float64(n)))
+	}
+
+	out := make([]train.ScoredItem, 0, n)
+	for k := 1; k <= n; k++ {
+		pick := -1
+		for idx, s := range sorted {
+			g := groups[s.Item]
+			if l, ok := limits[g]; !used[idx] && ok && count[g] < int(math.Floor(l.Min*float64(k))) && !capped(g) {
+				pick = idx
+				break
+			}
+		}
+		if pick < 0 {
+			for idx, s := range sorted {
+				if !used[idx] && !capped(groups[s.Item]) {
+					pick = idx
+					break
+				}
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		used[pick] = true
+		count[groups[sorted[pick].Item]]++
+		out = append(out, sorted[pick])
+	}
+	return out
+}
@@ -0,0 +1,165 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// Golden records the outcome of a fixed-seed training run so that later
+// changes to a model can be checked against it.
+type Golden struct {
+	Seed        int64
+	NumEpochs   int
+	Loss        float64
+	Predictions []GoldenPrediction
+}
+
+type GoldenPrediction struct {
+	User  string
+	Item  string
+	Score float64
+}
+
+// GoldenTolerance is the relative tolerance golden runs are checked to by
+// default. Runs are deterministic, so it only absorbs differences in
+// floating point code generation between platforms.
+const GoldenTolerance = 1e-9
+
+const (
+	goldenUsers       = 200
+	goldenItems       = 100
+	goldenRatings     = 6000
+	goldenPredictions = 20
+)
+
+// GoldenRun trains a model built by newModel for numEpochs on synthetic
+// ratings and reports its RMSE on a held-out fifth of it together with its
+// predictions for the first held-out pairs. The package's random source is
+// seeded with seed before the model is built and restored afterwards, see
+// Seed, so runs are reproducible as long as nothing else draws from it
+// concurrently.
+func GoldenRun(newModel func(*data.Dataset) (train.Model, error), numEpochs int, seed int64) (Golden, error) {
+	u, i, r, err := data.SyntheticRatings(seed, goldenUsers, goldenItems, goldenRatings)
+	if err != nil {
+		return Golden{}, err
+	}
+	train.Seed(seed)
+	defer train.SetRand(nil)
+	trainset, test, err := data.DatasetsFromSlices(u, i, r, .2, nil)
+	if err != nil {
+		return Golden{}, err
+	}
+	m, err := newModel(trainset)
+	if err != nil {
+		return Golden{}, err
+	}
+	m.Fit(numEpochs)
+
+	g := Golden{
+		Seed:      seed,
+		NumEpochs: numEpochs,
+		Loss:      Evaluate(m, test, 1, NewRMSE).All,
+	}
+	for idx := 0; idx < goldenPredictions && idx < len(test.Ratings); idx++ {
+		u := test.UserIDs[test.Users[idx]]
+		i := test.ItemIDs[test.Items[idx]]
+		g.Predictions = append(g.Predictions, GoldenPrediction{u, i, m.Predict(u, i)})
+	}
+	return g, nil
+}
+
+// Check reports the first value in g that differs from want by more than
+// tol, relative to the magnitude of the expected value (absolute below 1).
+func (g Golden) Check(want Golden, tol float64) error {
+	if g.Seed != want.Seed || g.NumEpochs != want.NumEpochs {
+		return fmt.Errorf("golden run mismatch: seed %d, %d epochs; want seed %d, %d epochs",
+			g.Seed, g.NumEpochs, want.Seed, want.NumEpochs)
+	}
+	if !withinTolerance(g.Loss, want.Loss, tol) {
+		return fmt.Errorf("loss %v, want %v", g.Loss, want.Loss)
+	}
+	if len(g.Predictions) != len(want.Predictions) {
+		return fmt.Errorf("%d predictions, want %d", len(g.Predictions), len(want.Predictions))
+	}
+	for k, p := range g.Predictions {
+		w := want.Predictions[k]
+		if p.User != w.User || p.Item != w.Item {
+			return fmt.Errorf("prediction %d is for (%s, %s), want (%s, %s)", k, p.User, p.Item, w.User, w.Item)
+		}
+		if !withinTolerance(p.Score, w.Score, tol) {
+			return fmt.Errorf("prediction for (%s, %s) %v, want %v", p.User, p.Item, p.Score, w.Score)
+		}
+	}
+	return nil
+}
+
+func WriteGolden(w io.Writer, g Golden) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+func ReadGolden(r io.Reader) (Golden, error) {
+	var g Golden
+	err := json.NewDecoder(r).Decode(&g)
+	return g, err
+}
+
+func withinTolerance(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol*math.Max(1, math.Abs(want))
+}
+
+// GoldenModels builds the models the golden regression tests and the
+// golden command cover, by name.
+var GoldenModels = map[string]func(*data.Dataset) (train.Model, error){
+	"svd": func(d *data.Dataset) (train.Model, error) { return train.NewSVD(d, nil) },
+	"svdals": func(d *data.Dataset) (train.Model, error) {
+		return train.NewSVD(d, &train.SVDConfig{Solver: train.ALSSolver})
+	},
+	"svddsgd": func(d *data.Dataset) (train.Model, error) {
+		return train.NewSVD(d, &train.SVDConfig{Solver: train.DSGDSolver, NumWorkers: 4})
+	},
+	"svdnonneg": func(d *data.Dataset) (train.Model, error) {
+		return train.NewSVD(d, &train.SVDConfig{NonNegative: true})
+	},
+	"svdpp":    func(d *data.Dataset) (train.Model, error) { return train.NewSVDpp(d, nil) },
+	"hashsvd":  func(d *data.Dataset) (train.Model, error) { return train.NewHashedSVD(d, nil) },
+	"asvd":     func(d *data.Dataset) (train.Model, error) { return train.NewAsymSVD(d, nil) },
+	"eals":     func(d *data.Dataset) (train.Model, error) { return train.NewEALS(d, nil) },
+	"ials":     func(d *data.Dataset) (train.Model, error) { return train.NewImplicitALS(d, nil) },
+	"bpr":      func(d *data.Dataset) (train.Model, error) { return train.NewBPR(d, nil) },
+	"nmf":      func(d *data.Dataset) (train.Model, error) { return train.NewNMF(d, nil) },
+	"knnuser":  func(d *data.Dataset) (train.Model, error) { return train.NewKNNUser(d, nil) },
+	"knnitem":  func(d *data.Dataset) (train.Model, error) { return train.NewKNNItemBaseline(d, nil) },
+	"slopeone": func(d *data.Dataset) (train.Model, error) { return train.NewSlopeOne(d, nil) },
+	"baseline": func(d *data.Dataset) (train.Model, error) { return train.NewBaselineOnly(d, nil) },
+	"integrated": func(d *data.Dataset) (train.Model, error) {
+		return train.NewIntegrated(d, nil)
+	},
+	"ensemble": func(d *data.Dataset) (train.Model, error) {
+		svd, err := train.NewSVD(d, nil)
+		if err != nil {
+			return nil, err
+		}
+		knn, err := train.NewKNNItemBaseline(d, nil)
+		if err != nil {
+			return nil, err
+		}
+		return train.NewEnsemble([]train.Model{svd, knn}, &train.EnsembleConfig{Weights: []float64{.7, .3}})
+	},
+	"baselineals": func(d *data.Dataset) (train.Model, error) {
+		return train.NewBaselineOnly(d, &train.BaselineConfig{Solver: train.ALSSolver})
+	},
+	"ffm":      func(d *data.Dataset) (train.Model, error) { return train.NewFFM(d, nil) },
+	"fm":       func(d *data.Dataset) (train.Model, error) { return train.NewFM(d, nil) },
+	"ncf":      func(d *data.Dataset) (train.Model, error) { return train.NewNCF(d, nil) },
+	"logmf":    func(d *data.Dataset) (train.Model, error) { return train.NewLogisticMF(d, nil) },
+	"ease":     func(d *data.Dataset) (train.Model, error) { return train.NewEASE(d, nil) },
+	"pmf":      func(d *data.Dataset) (train.Model, error) { return train.NewPMF(d, nil) },
+	"item2vec": func(d *data.Dataset) (train.Model, error) { return train.NewItem2Vec(d, nil) },
+}
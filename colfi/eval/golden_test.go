@@ -0,0 +1,41 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestGolden retrains every model of GoldenModels and checks it against its
+// recording in testdata/golden. After an intended change of results,
+// re-record a model from the repository root with
+//
+//	go run . golden -model <name> -record colfi/eval/testdata/golden/<name>.json
+func TestGolden(t *testing.T) {
+	names := make([]string, 0, len(GoldenModels))
+	for name := range GoldenModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "golden", name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			want, err := ReadGolden(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := GoldenRun(GoldenModels[name], want.NumEpochs, want.Seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := got.Check(want, GoldenTolerance); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+type GridSearchParams struct {
+	NumEpochs  []int
+	NumFactors []int
+	Reg        []float64
+	LR         []float64
+	InitStdDev []float64
+	NumWorkers int
+	Unseen     UnseenMode
+	// SampleRate subsamples the ratings each trial trains on per epoch, see
+	// SVDConfig.SampleRate. RetrainBest fits the winner on all of them.
+	SampleRate float64
+	// FitWorkers, if above one, trains every trial with Hogwild SGD on that
+	// many goroutines, see train.SVDConfig.NumWorkers.
+	FitWorkers int
+}
+
+type GridSearchTestResult struct {
+	NumEpochs  int
+	NumFactors int
+	Reg        float64
+	LR         float64
+	InitStdDev float64
+	Loss       float64
+	Eval       EvalResult
+	Runtime    time.Duration
+}
+
+func GridSearch(
+	trainset *data.Dataset,
+	testset *data.Dataset,
+	p GridSearchParams) []GridSearchTestResult {
+	return GridSearchContext(context.Background(), trainset, testset, p)
+}
+
+// GridSearchContext is GridSearch with every trial traced as a child span of
+// ctx.
+func GridSearchContext(
+	ctx context.Context,
+	trainset *data.Dataset,
+	testset *data.Dataset,
+	p GridSearchParams) []GridSearchTestResult {
+	numTests := (len(p.NumEpochs) * len(p.NumFactors) * len(p.Reg) * len(p.LR) * len(p.InitStdDev))
+	if numTests < 1 {
+		log.Fatalln("GridSearch: all parameters must have at least one test value")
+	}
+	if err := data.CheckScales(trainset, testset); err != nil {
+		log.Printf("GridSearch: warning: %v", err)
+	}
+	tests := make([]GridSearchTestResult, 0, numTests)
+	i := 0
+	for _, numEpochs := range p.NumEpochs {
+		for _, numFactors := range p.NumFactors {
+			for _, reg := range p.Reg {
+				for _, lr := range p.LR {
+					for _, initStdDev := range p.InitStdDev {
+						i++
+						log.Printf("running grid search test %d / %d", i, numTests)
+						config := &train.SVDConfig{
+							NumFactors: numFactors,
+							Reg:        reg,
+							LR:         lr,
+							InitStdDev: initStdDev,
+							SampleRate: p.SampleRate,
+							NumWorkers: p.FitWorkers,
+						}
+						trialCtx, span := train.StartSpan(ctx, "colfi.trial",
+							train.Attr{Key: "epochs", Value: numEpochs},
+							train.Attr{Key: "factors", Value: numFactors},
+							train.Attr{Key: "reg", Value: reg},
+							train.Attr{Key: "lr", Value: lr},
+							train.Attr{Key: "init_std_dev", Value: initStdDev})
+						start := time.Now()
+						eval, err := testModel(trialCtx, trainset, testset, numEpochs, config, p.NumWorkers)
+						if err != nil {
+							log.Fatalf("GridSearch: %v", err)
+						}
+						elapsed := time.Since(start)
+						span.SetAttrs(train.Attr{Key: "loss", Value: eval.Loss(p.Unseen)})
+						span.End()
+						test := GridSearchTestResult{
+							NumEpochs:  numEpochs,
+							NumFactors: numFactors,
+							Reg:        reg,
+							LR:         lr,
+							InitStdDev: initStdDev,
+							Loss:       eval.Loss(p.Unseen),
+							Eval:       eval,
+							Runtime:    elapsed,
+						}
+						tests = append(tests, test)
+					}
+				}
+			}
+		}
+	}
+	return tests
+}
+
+// RetrainBest fits an SVD with the hyperparameters of the lowest-loss grid
+// search result on the full trainset, without subsampling.
+func RetrainBest(trainset *data.Dataset, results []GridSearchTestResult) (train.Model, GridSearchTestResult, error) {
+	if len(results) == 0 {
+		return nil, GridSearchTestResult{}, fmt.Errorf("no grid search results to choose from")
+	}
+	best := results[0]
+	for _, r := range results[1:] {
+		if r.Loss < best.Loss {
+			best = r
+		}
+	}
+	m, err := train.NewSVD(trainset, &train.SVDConfig{
+		NumFactors: best.NumFactors,
+		Reg:        best.Reg,
+		LR:         best.LR,
+		InitStdDev: best.InitStdDev,
+	})
+	if err != nil {
+		return nil, best, err
+	}
+	m.Fit(best.NumEpochs)
+	return m, best, nil
+}
+
+func testModel(ctx context.Context, trainset, testset *data.Dataset, numEpochs int, config *train.SVDConfig, numWorkers int) (EvalResult, error) {
+	m, err := train.NewSVD(trainset, config)
+	if err != nil {
+		return EvalResult{}, err
+	}
+	train.FitContext(ctx, m, numEpochs)
+	return Evaluate(m, testset, numWorkers, NewRMSE), nil
+}
+
+// translateIDs maps each internal ID of a dataset, given by its list of
+// original IDs, to the internal ID of the same original ID in the vocabulary
+// to, or -1 if to does not contain it.
+func translateIDs(ids []string, to map[string]int) []int {
+	t := make([]int, len(ids))
+	for id, k := range ids {
+		if toID, ok := to[k]; ok {
+			t[id] = toID
+		} else {
+			t[id] = -1
+		}
+	}
+	return t
+}
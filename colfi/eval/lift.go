@@ -0,0 +1,37 @@
+package eval
+
+import (
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// baselineEpochs is how long BaselineEval fits its baseline; ALS has
+// converged on the biases well before.
+const baselineEpochs = 10
+
+// BaselineEval fits a BaselineOnly model on trainset with ALS and evaluates
+// it on testset, giving the reference that LiftOver compares models with.
+func BaselineEval(trainset, testset *data.Dataset, numWorkers int, newMetric func() Metric) (EvalResult, error) {
+	b, err := train.NewBaselineOnly(trainset, &train.BaselineConfig{Solver: train.ALSSolver})
+	if err != nil {
+		return EvalResult{}, err
+	}
+	b.Fit(baselineEpochs)
+	return Evaluate(b, testset, numWorkers, newMetric), nil
+}
+
+// Lift is the share of a baseline's loss a model removes: 0.05 is 5% lower
+// loss than the baseline and a negative lift is a model worse than it.
+type Lift struct {
+	All   float64
+	Known float64
+}
+
+// LiftOver returns the lift of r over base, which must come from the same
+// testset and metric.
+func (r EvalResult) LiftOver(base EvalResult) Lift {
+	return Lift{
+		All:   1 - r.All/base.All,
+		Known: 1 - r.Known/base.Known,
+	}
+}
@@ -0,0 +1,75 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// PolicyValue estimates the average reward per item that recommending a
+// model's lists would have earned, from feedback logged under another
+// policy.
+type PolicyValue struct {
+	// Events counts the logged ratings, Listed the items of the model's
+	// lists for their users and Matches the logged ratings whose item is in
+	// the model's list for their user.
+	Events  int
+	Listed  int
+	Matches int
+	// IPS is the unbiased inverse propensity scoring estimate and SNIPS
+	// its self-normalized, less variable form, NaN without matches.
+	IPS   float64
+	SNIPS float64
+}
+
+// EstimatePolicyValue estimates the value of recommending m's n best items
+// under opts to the users of logged, whose ratings are the rewards of items
+// shown by a logging policy, such as RecommendExplore, with the logged
+// Propensities. Every logged item that m would also have listed counts with
+// the inverse of its propensity: IPS divides the weighted sum of their
+// ratings by the number of items listed and SNIPS by the sum of their
+// weights. Items are treated as shown independently of each other and of
+// their position, and the estimate can only credit items the logging policy
+// showed with a positive propensity.
+func EstimatePolicyValue(ctx context.Context, m train.Model, logged *data.Dataset, n int, opts *train.RecommendOptions) (PolicyValue, error) {
+	if logged.Propensities == nil {
+		return PolicyValue{}, errors.New("logged dataset has no propensities")
+	}
+	if err := logged.Validate(); err != nil {
+		return PolicyValue{}, err
+	}
+	res := PolicyValue{Events: len(logged.Ratings)}
+	var sum, weights float64
+	for uid, idxs := range data.GroupRatings(logged.Users, len(logged.UserMap)) {
+		if len(idxs) == 0 {
+			continue
+		}
+		recs, err := train.RecommendContext(ctx, m, logged.UserIDs[uid], n, opts)
+		if err != nil {
+			return PolicyValue{}, err
+		}
+		res.Listed += len(recs)
+		listed := make(map[string]bool, len(recs))
+		for _, it := range recs {
+			listed[it.Item] = true
+		}
+		for _, idx := range idxs {
+			if !listed[logged.ItemIDs[logged.Items[idx]]] {
+				continue
+			}
+			w := 1 / logged.Propensities[idx]
+			sum += w * float64(logged.Ratings[idx])
+			weights += w
+			res.Matches++
+		}
+	}
+	res.IPS = sum / float64(res.Listed)
+	res.SNIPS = math.NaN()
+	if weights > 0 {
+		res.SNIPS = sum / weights
+	}
+	return res, nil
+}
@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+type ReplayConfig struct {
+	// N is the length of the list requested before every event.
+	N int
+	// MinRating is the lowest rating counted as a hit opportunity. Events
+	// rated lower are still fed to the model when Update is set.
+	MinRating float32
+	// Update feeds every event to the model through PartialFit once it has
+	// been scored.
+	Update  bool
+	Verbose bool
+}
+
+type ReplayResult struct {
+	// Events counts the events that were hit opportunities, Hits those whose
+	// item was in the list requested just before.
+	Events  int
+	Hits    int
+	HitRate float64
+}
+
+// Replay walks the ratings of events in order, which should be
+// chronological, and for each asks m for its top N items for the user,
+// leaving out items the user has already rated, then checks whether the
+// rated item was among them. With Update the model learns from every event
+// after it has been scored, approximating how it would perform online. The
+// model's dataset grows with the replayed events in that case.
+func Replay(m train.Model, events *data.Dataset, config *ReplayConfig) (ReplayResult, error) {
+	if config == nil {
+		config = &ReplayConfig{}
+	}
+	if config.N == 0 {
+		config.N = 10
+	}
+	pf, ok := m.(train.PartialFitter)
+	if config.Update && !ok {
+		return ReplayResult{}, fmt.Errorf("%T does not support PartialFit", m)
+	}
+
+	d := m.GetDataset()
+	seen := make(map[int]map[int]bool, len(d.UserMap))
+	markSeen := func(uid, iid int) {
+		if seen[uid] == nil {
+			seen[uid] = make(map[int]bool)
+		}
+		seen[uid][iid] = true
+	}
+	for idx, uid := range d.Users {
+		markSeen(uid, d.Items[idx])
+	}
+
+	var res ReplayResult
+	for idx, r := range events.Ratings {
+		u := events.UserIDs[events.Users[idx]]
+		i := events.ItemIDs[events.Items[idx]]
+		uid, iid := d.LookupIDs(u, i)
+		if r >= config.MinRating && !(uid >= 0 && iid >= 0 && seen[uid][iid]) {
+			res.Events++
+			rated := seen[uid]
+			top, _ := train.RankItems(context.Background(), m, u, config.N, func(iid int) bool {
+				return !rated[iid]
+			})
+			for _, s := range top {
+				if s.Item == i {
+					res.Hits++
+					break
+				}
+			}
+		}
+		if config.Update {
+			pf.PartialFit(u, i, r)
+			uid, iid = d.LookupIDs(u, i)
+			markSeen(uid, iid)
+		}
+		if config.Verbose && (idx+1)%10000 == 0 {
+			log.Printf("replayed %d events, hit rate %.4f", idx+1, float64(res.Hits)/float64(res.Events))
+		}
+	}
+	if res.Events > 0 {
+		res.HitRate = float64(res.Hits) / float64(res.Events)
+	}
+	return res, nil
+}
@@ -0,0 +1,126 @@
+package infer
+
+import (
+	"encoding/gob"
+	"io"
+	"sort"
+)
+
+// Index is a random-hyperplane LSH index over item vectors augmented with
+// their biases, for maximum inner product search. Each table hashes a vector
+// to the signs of its dot products with the rows of one matrix of Planes;
+// probes look at the query's bucket and those at Hamming distance one.
+// Indexes are built by train.NewBundle and train.NewANNCandidates.
+type Index struct {
+	Planes  []*Factors
+	Buckets []map[uint64][]int
+}
+
+// NewIndex returns an empty index hashing with planes, one matrix of
+// NumBits rows of item factors plus one per table.
+func NewIndex(planes []*Factors) *Index {
+	ix := &Index{Planes: planes, Buckets: make([]map[uint64][]int, len(planes))}
+	for t := range ix.Buckets {
+		ix.Buckets[t] = make(map[uint64][]int)
+	}
+	return ix
+}
+
+// Insert indexes item iid with factors qi and bias b.
+func (ix *Index) Insert(iid int, qi []float64, b float64) {
+	vec := append(append(make([]float64, 0, len(qi)+1), qi...), b)
+	for t := range ix.Planes {
+		h := ix.hash(t, vec)
+		ix.Buckets[t][h] = append(ix.Buckets[t][h], iid)
+	}
+}
+
+// Probe returns the items colliding with user vector pu in any table, in
+// increasing order.
+func (ix *Index) Probe(pu []float64) []int {
+	query := append(append(make([]float64, 0, len(pu)+1), pu...), 1)
+	seen := make(map[int]bool)
+	for t, planes := range ix.Planes {
+		h := ix.hash(t, query)
+		for _, i := range ix.Buckets[t][h] {
+			seen[i] = true
+		}
+		for b := 0; b < planes.Rows; b++ {
+			for _, i := range ix.Buckets[t][h^(1<<uint(b))] {
+				seen[i] = true
+			}
+		}
+	}
+	items := make([]int, 0, len(seen))
+	for i := range seen {
+		items = append(items, i)
+	}
+	sort.Ints(items)
+	return items
+}
+
+func (ix *Index) hash(t int, vec []float64) uint64 {
+	planes := ix.Planes[t]
+	var h uint64
+	for b := 0; b < planes.Rows; b++ {
+		var dot float64
+		for f, p := range planes.Row(b) {
+			dot += p * vec[f]
+		}
+		if dot > 0 {
+			h |= 1 << uint(b)
+		}
+	}
+	return h
+}
+
+// Bundle is a compact model together with an ANN index over its items, so
+// that serving processes load both in one call instead of rebuilding the
+// index at startup.
+type Bundle struct {
+	Model *Model
+	Index *Index
+}
+
+// Recommend is Model.Recommend, scoring only the items the index finds for
+// u. It falls back to scoring the whole catalog for unknown users, when the
+// index finds fewer than n items and when n asks for all of them.
+func (b *Bundle) Recommend(u string, n int, exclude []string) []ScoredItem {
+	m := b.Model
+	uid, _ := m.LookupIDs(u, "")
+	if uid < 0 || b.Index == nil {
+		return m.Recommend(u, n, exclude)
+	}
+	skip := make(map[int]bool, len(exclude))
+	for _, i := range exclude {
+		if _, iid := m.LookupIDs("", i); iid >= 0 {
+			skip[iid] = true
+		}
+	}
+	candidates := b.Index.Probe(m.PU.Row(uid))
+	scores := make([]ScoredItem, 0, len(candidates))
+	for _, iid := range candidates {
+		if !skip[iid] {
+			scores = append(scores, ScoredItem{m.ItemIDs[iid], m.PredictID(uid, iid)})
+		}
+	}
+	if n <= 0 || len(scores) < n {
+		return m.Recommend(u, n, exclude)
+	}
+	sort.Slice(scores, func(a, b int) bool {
+		return scores[a].Score > scores[b].Score
+	})
+	return scores[:n]
+}
+
+func (b *Bundle) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(b)
+}
+
+func LoadBundle(r io.Reader) (*Bundle, error) {
+	b := new(Bundle)
+	if err := gob.NewDecoder(r).Decode(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,216 @@
+// Package infer scores compact models written by train.SaveCompact. It
+// depends on the standard library only, so that serving binaries such as
+// the WebAssembly and mobile builds stay small and do not pull in gonum or
+// the training code. Models are built and exported by package train.
+package infer
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Model is the scoring part of a factor model without the training data.
+// Its predictions equal those of the model it was made from.
+type Model struct {
+	UserIDs    []string
+	ItemIDs    []string
+	PU         *Factors
+	QI         *Factors
+	BU         []float64
+	BI         []float64
+	GlobalMean float64
+	// Clip, if set, is the rating scale predictions are limited to.
+	Clip *Bounds
+
+	index   sync.Once
+	userMap map[string]int
+	itemMap map[string]int
+}
+
+// Factors is a row-major matrix of latent vectors, laid out as colfi's.
+// After ToBF16 the vectors are held in BF16 instead of Data.
+type Factors struct {
+	Rows   int
+	Cols   int
+	Stride int
+	Data   []float64
+	BF16   []uint16
+}
+
+// Row returns row i, widened into a new slice if it is stored as bfloat16.
+func (f *Factors) Row(i int) []float64 {
+	start := i * f.Stride
+	if f.Data == nil && f.BF16 != nil {
+		row := make([]float64, f.Cols)
+		for k, b := range f.BF16[start : start+f.Cols] {
+			row[k] = widenBF16(b)
+		}
+		return row
+	}
+	return f.Data[start : start+f.Cols : start+f.Cols]
+}
+
+// dotRows is the dot product of row i of f and row j of g, widening
+// bfloat16 values as it goes.
+func dotRows(f *Factors, i int, g *Factors, j int) float64 {
+	fs, gs := i*f.Stride, j*g.Stride
+	var dot float64
+	switch {
+	case f.Data != nil && g.Data != nil:
+		a, b := f.Data[fs:fs+f.Cols], g.Data[gs:gs+f.Cols]
+		for k := range a {
+			dot += a[k] * b[k]
+		}
+	case f.Data != nil:
+		a, b := f.Data[fs:fs+f.Cols], g.BF16[gs:gs+f.Cols]
+		for k := range a {
+			dot += a[k] * widenBF16(b[k])
+		}
+	case g.Data != nil:
+		a, b := f.BF16[fs:fs+f.Cols], g.Data[gs:gs+f.Cols]
+		for k := range a {
+			dot += widenBF16(a[k]) * b[k]
+		}
+	default:
+		a, b := f.BF16[fs:fs+f.Cols], g.BF16[gs:gs+f.Cols]
+		for k := range a {
+			dot += widenBF16(a[k]) * widenBF16(b[k])
+		}
+	}
+	return dot
+}
+
+// ToBF16 replaces the factors of m by bfloat16 copies, quartering their
+// memory. Biases and the global mean keep full precision. bfloat16 keeps
+// the exponent range of float32 with 8 bits of mantissa, so every factor is
+// off by at most 0.4% of its value.
+func (m *Model) ToBF16() {
+	for _, f := range []*Factors{m.PU, m.QI} {
+		if f == nil || f.Data == nil {
+			continue
+		}
+		f.BF16 = make([]uint16, len(f.Data))
+		for k, x := range f.Data {
+			f.BF16[k] = narrowBF16(x)
+		}
+		f.Data = nil
+	}
+}
+
+// narrowBF16 rounds x to the nearest bfloat16, ties to even.
+func narrowBF16(x float64) uint16 {
+	bits := math.Float32bits(float32(x))
+	if bits&0x7fffffff > 0x7f800000 {
+		// Keep NaNs NaN rather than letting rounding carry into infinity.
+		return uint16(bits>>16) | 0x40
+	}
+	bits += 0x7fff + (bits>>16)&1
+	return uint16(bits >> 16)
+}
+
+func widenBF16(b uint16) float64 {
+	return float64(math.Float32frombits(uint32(b) << 16))
+}
+
+// Bounds is a rating scale, laid out as colfi's.
+type Bounds struct {
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+func (b Bounds) Clip(p float64) float64 {
+	return math.Max(b.Min, math.Min(b.Max, p))
+}
+
+type ScoredItem struct {
+	Item  string
+	Score float64
+}
+
+func (m *Model) buildIndex() {
+	m.userMap = make(map[string]int, len(m.UserIDs))
+	for uid, u := range m.UserIDs {
+		m.userMap[u] = uid
+	}
+	m.itemMap = make(map[string]int, len(m.ItemIDs))
+	for iid, i := range m.ItemIDs {
+		m.itemMap[i] = iid
+	}
+}
+
+// LookupIDs returns the internal IDs of u and i, or -1 for either if the
+// model does not know it.
+func (m *Model) LookupIDs(u, i string) (int, int) {
+	m.index.Do(m.buildIndex)
+	uid, ok := m.userMap[u]
+	if !ok {
+		uid = -1
+	}
+	iid, ok := m.itemMap[i]
+	if !ok {
+		iid = -1
+	}
+	return uid, iid
+}
+
+func (m *Model) Predict(u, i string) float64 {
+	return m.PredictID(m.LookupIDs(u, i))
+}
+
+func (m *Model) PredictID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 && m.BU != nil {
+		p += m.BU[uid]
+	}
+	if iid >= 0 && m.BI != nil {
+		p += m.BI[iid]
+	}
+	if uid >= 0 && iid >= 0 {
+		p += dotRows(m.PU, uid, m.QI, iid)
+	}
+	if m.Clip != nil {
+		p = m.Clip.Clip(p)
+	}
+	return p
+}
+
+// Recommend returns the n highest scoring items for u, leaving out the items
+// in exclude, typically the ones the user has already rated.
+func (m *Model) Recommend(u string, n int, exclude []string) []ScoredItem {
+	uid, _ := m.LookupIDs(u, "")
+	skip := make(map[int]bool, len(exclude))
+	for _, i := range exclude {
+		if _, iid := m.LookupIDs("", i); iid >= 0 {
+			skip[iid] = true
+		}
+	}
+	scores := make([]ScoredItem, 0, len(m.ItemIDs))
+	for iid, i := range m.ItemIDs {
+		if !skip[iid] {
+			scores = append(scores, ScoredItem{i, m.PredictID(uid, iid)})
+		}
+	}
+	sort.Slice(scores, func(a, b int) bool {
+		return scores[a].Score > scores[b].Score
+	})
+	if n > 0 && n < len(scores) {
+		scores = scores[:n]
+	}
+	return scores
+}
+
+func (m *Model) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(m)
+}
+
+func Load(r io.Reader) (*Model, error) {
+	m := new(Model)
+	if err := gob.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,64 @@
+// Package random is the default source of the random draws in the colfi
+// packages, for dataset splits, factor initialization, SGD sampling,
+// negative sampling and random candidates, which draw from it unless they
+// are given a rand.Source of their own. Seeding it makes a whole pipeline
+// reproducible. Without Set it draws from the global math/rand source.
+package random
+
+import (
+	"math/rand"
+	"sync"
+)
+
+var (
+	mu     sync.Mutex
+	source *rand.Rand
+)
+
+// Set makes r the default source, or restores the global math/rand source
+// if r is nil. r is used under a lock.
+func Set(r *rand.Rand) {
+	mu.Lock()
+	source = r
+	mu.Unlock()
+}
+
+// Or returns a Rand drawing from src, or from the default source if src is
+// nil. Unlike src, the default source is safe for concurrent use. Its draws
+// are the same as those of the *rand.Rand passed to Set.
+func Or(src rand.Source) *rand.Rand {
+	switch r := src.(type) {
+	case nil:
+		return shared
+	case *rand.Rand:
+		return r
+	}
+	return rand.New(src)
+}
+
+var shared = rand.New(lockedSource{})
+
+// lockedSource draws from the default source under its lock.
+type lockedSource struct{}
+
+func (lockedSource) Int63() int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if source == nil {
+		return rand.Int63()
+	}
+	return source.Int63()
+}
+
+func (lockedSource) Uint64() uint64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if source == nil {
+		return rand.Uint64()
+	}
+	return source.Uint64()
+}
+
+func (lockedSource) Seed(int64) {
+	panic("random: the default source is seeded through Set")
+}
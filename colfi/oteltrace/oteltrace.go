@@ -0,0 +1,76 @@
+// Package oteltrace adapts an OpenTelemetry tracer to train.Tracer, so that
+// the spans of data loading, training, grid search and serving go to any
+// OpenTelemetry exporter:
+//
+//	train.SetTracer(oteltrace.New(otel.Tracer("colfi")))
+//
+// It is a package of its own so that only programs importing it depend on
+// OpenTelemetry.
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"main/colfi/train"
+)
+
+// New returns a train.Tracer starting its spans with t.
+func New(t trace.Tracer) train.Tracer {
+	return tracer{t}
+}
+
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t tracer) Start(ctx context.Context, name string, attrs ...train.Attr) (context.Context, train.Span) {
+	ctx, s := t.t.Start(ctx, name, trace.WithAttributes(keyValues(attrs)...))
+	return ctx, span{s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s span) SetAttrs(attrs ...train.Attr) {
+	s.s.SetAttributes(keyValues(attrs)...)
+}
+
+// RecordError records err as an event of the span and marks the span as
+// failed.
+func (s span) RecordError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.s.End()
+}
+
+// keyValues converts attrs to OpenTelemetry attributes. Values of a type
+// train.Attr does not list are formatted as strings.
+func keyValues(attrs []train.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for k, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs[k] = attribute.String(a.Key, v)
+		case int:
+			kvs[k] = attribute.Int(a.Key, v)
+		case int64:
+			kvs[k] = attribute.Int64(a.Key, v)
+		case float64:
+			kvs[k] = attribute.Float64(a.Key, v)
+		case bool:
+			kvs[k] = attribute.Bool(a.Key, v)
+		default:
+			kvs[k] = attribute.String(a.Key, fmt.Sprint(v))
+		}
+	}
+	return kvs
+}
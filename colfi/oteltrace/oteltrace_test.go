@@ -0,0 +1,32 @@
+package oteltrace
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"main/colfi/train"
+)
+
+func TestKeyValues(t *testing.T) {
+	got := keyValues([]train.Attr{
+		{Key: "path", Value: "/recommend"},
+		{Key: "epochs", Value: 20},
+		{Key: "loss", Value: .85},
+		{Key: "cached", Value: true},
+		{Key: "timeout", Value: time.Second},
+	})
+	want := []attribute.KeyValue{
+		attribute.String("path", "/recommend"),
+		attribute.Int("epochs", 20),
+		attribute.Float64("loss", .85),
+		attribute.Bool("cached", true),
+		attribute.String("timeout", "1s"),
+	}
+	for k := range want {
+		if got[k] != want[k] {
+			t.Errorf("attribute %d: got %v, want %v", k, got[k], want[k])
+		}
+	}
+}
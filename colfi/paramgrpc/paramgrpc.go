@@ -0,0 +1,141 @@
+// Package paramgrpc serves a train.ParamServer over gRPC and connects
+// train.Workers on other machines to it.
+//
+// The messages are the train package's own types, encoded with gob under
+// the content subtype "gob", so the service needs no .proto file or
+// generated code. Clients made by NewClient ask for that subtype on every
+// call.
+package paramgrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+
+	"main/colfi/train"
+)
+
+const serviceName = "colfi.ParamServer"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (codec) Name() string {
+	return "gob"
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*train.ParamClient)(nil),
+	Methods: []grpc.MethodDesc{
+		method("Vocabulary", func() interface{} { return new(int) }, func(s *train.ParamServer, _ interface{}) (interface{}, error) {
+			return s.Vocabulary()
+		}),
+		method("Pull", func() interface{} { return new(int) }, func(s *train.ParamServer, _ interface{}) (interface{}, error) {
+			return s.Pull()
+		}),
+		method("Push", func() interface{} { return new(train.ItemParams) }, func(s *train.ParamServer, req interface{}) (interface{}, error) {
+			epoch, err := s.Push(req.(*train.ItemParams))
+			if err != nil {
+				return nil, err
+			}
+			return &epoch, nil
+		}),
+		method("Abort", func() interface{} { return new(string) }, func(s *train.ParamServer, req interface{}) (interface{}, error) {
+			return new(int), s.Abort(*req.(*string))
+		}),
+	},
+	Metadata: "colfi/paramgrpc",
+}
+
+// method describes the unary method name, which decodes its request into
+// what newReq returns and answers it with call.
+func method(name string, newReq func() interface{}, call func(*train.ParamServer, interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			s := srv.(*train.ParamServer)
+			if interceptor == nil {
+				return call(s, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + name}
+			return interceptor(ctx, req, info, func(_ context.Context, req interface{}) (interface{}, error) {
+				return call(s, req)
+			})
+		},
+	}
+}
+
+// Register registers s with g, to be called by the clients NewClient
+// returns.
+func Register(g grpc.ServiceRegistrar, s *train.ParamServer) {
+	g.RegisterService(&serviceDesc, s)
+}
+
+// NewClient returns a client for the ParamServer registered with the gRPC
+// server at the other end of conn, to pass to train.NewWorker:
+//
+//	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	w, err := train.NewWorker(paramgrpc.NewClient(conn), u, i, r)
+//
+// Push waits for the other workers without a deadline of its own; the
+// server's timeout bounds it.
+func NewClient(conn grpc.ClientConnInterface) train.ParamClient {
+	return client{conn}
+}
+
+type client struct {
+	conn grpc.ClientConnInterface
+}
+
+func (c client) invoke(name string, req, reply interface{}) error {
+	return c.conn.Invoke(context.Background(), "/"+serviceName+"/"+name, req, reply, grpc.CallContentSubtype(codec{}.Name()))
+}
+
+func (c client) Vocabulary() (*train.Vocabulary, error) {
+	vocab := new(train.Vocabulary)
+	if err := c.invoke("Vocabulary", new(int), vocab); err != nil {
+		return nil, err
+	}
+	return vocab, nil
+}
+
+func (c client) Pull() (*train.ItemParams, error) {
+	params := new(train.ItemParams)
+	if err := c.invoke("Pull", new(int), params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func (c client) Push(update *train.ItemParams) (int, error) {
+	var epoch int
+	err := c.invoke("Push", update, &epoch)
+	return epoch, err
+}
+
+func (c client) Abort(reason string) error {
+	return c.invoke("Abort", &reason, new(int))
+}
@@ -0,0 +1,257 @@
+package paramgrpc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+func TestWorkersConverge(t *testing.T) {
+	u, i, r, err := data.SyntheticRatings(1, 80, 30, 1500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := func() *train.SVDConfig {
+		return &train.SVDConfig{NumFactors: 4, LR: .01, Source: rand.New(rand.NewSource(1))}
+	}
+	const epochs = 30
+
+	d, _, err := data.DatasetsFromSlices(u, i, r, 0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := train.NewSVD(d, config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	single.Fit(epochs)
+
+	srv, err := train.NewParamServer(vocabulary(i), data.Mean32(r), 2, time.Minute, config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := serve(t, srv)
+	shards := shard(u, i, r, 2)
+	workers := make([]*train.Worker, len(shards))
+	for k, s := range shards {
+		if workers[k], err = train.NewWorker(dial(), s.u, s.i, s.r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errs := make(chan error, len(workers))
+	for _, w := range workers {
+		go func(w *train.Worker) { errs <- w.Fit(epochs) }(w)
+	}
+	for range workers {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var want, got, base float64
+	mean := data.Mean32(r)
+	for k := range r {
+		w := workers[shardOf(u[k], 2)]
+		want += sq(single.Predict(u[k], i[k]) - float64(r[k]))
+		got += sq(w.Model.Predict(u[k], i[k]) - float64(r[k]))
+		base += sq(mean - float64(r[k]))
+	}
+	want, got, base = math.Sqrt(want/float64(len(r))), math.Sqrt(got/float64(len(r))), math.Sqrt(base/float64(len(r)))
+	t.Logf("training RMSE: global mean %.4f, single process %.4f, two workers %.4f", base, want, got)
+	if got > 1.1*want || got >= base {
+		t.Errorf("two workers reached RMSE %.4f, single process %.4f, global mean %.4f", got, want, base)
+	}
+	// Both workers end on the server's final item parameters.
+	a, b := workers[0].Model, workers[1].Model
+	for k, v := range a.QI.Data {
+		if b.QI.Data[k] != v {
+			t.Fatalf("QI.Data[%d]: workers ended with %v and %v", k, v, b.QI.Data[k])
+		}
+	}
+}
+
+func TestMissingWorkerTimesOut(t *testing.T) {
+	u, i, r, err := data.SyntheticRatings(1, 20, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := train.NewParamServer(vocabulary(i), data.Mean32(r), 2, 100*time.Millisecond, &train.SVDConfig{NumFactors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := serve(t, srv)
+	shards := shard(u, i, r, 2)
+	pushing, err := train.NewWorker(dial(), shards[0].u, shards[0].i, shards[0].r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silent, err := train.NewWorker(dial(), shards[1].u, shards[1].i, shards[1].r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- pushing.Fit(3) }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "only 1 of 2 workers pushed") {
+			t.Errorf("pushing worker: got %v, want a timeout", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the pushing worker is still waiting after the timeout")
+	}
+	if err := silent.Fit(1); err == nil || !strings.Contains(err.Error(), "only 1 of 2 workers pushed") {
+		t.Errorf("silent worker: got %v, want the timeout", err)
+	}
+}
+
+func TestAbortReleasesPush(t *testing.T) {
+	u, i, r, err := data.SyntheticRatings(1, 20, 10, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No timeout: only Abort can release the first worker.
+	srv, err := train.NewParamServer(vocabulary(i), data.Mean32(r), 2, 0, &train.SVDConfig{NumFactors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := serve(t, srv)
+	shards := shard(u, i, r, 2)
+	pushed := make(chan struct{})
+	blocked, err := train.NewWorker(notifyPush{dial(), pushed}, shards[0].u, shards[0].i, shards[0].r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := train.NewWorker(dial(), shards[1].u, shards[1].i, shards[1].r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- blocked.Fit(3) }()
+	<-pushed
+	time.Sleep(50 * time.Millisecond)
+	if err := failing.Abort(errors.New("out of memory")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "aborted by a worker: out of memory") {
+			t.Errorf("got %v, want the abort", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Abort did not release the worker waiting in Push")
+	}
+}
+
+func TestPushRejected(t *testing.T) {
+	srv, err := train.NewParamServer([]string{"a", "b"}, 3, 2, 0, &train.SVDConfig{NumFactors: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := serve(t, srv)()
+	params, err := c.Pull()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name   string
+		update *train.ItemParams
+	}{
+		{"no factors", &train.ItemParams{}},
+		{"stale epoch", &train.ItemParams{Epoch: 1, QI: params.QI, BI: params.BI}},
+		{"wrong size", &train.ItemParams{QI: &train.Factors{Rows: 1, Cols: 2, Stride: 2, Data: []float64{0, 0}}, BI: []float64{0}}},
+	} {
+		if _, err := c.Push(tc.update); err == nil {
+			t.Errorf("%s: push accepted", tc.name)
+		}
+	}
+}
+
+// serve serves s over an in-memory listener for the duration of the test
+// and returns a function that connects a new client to it.
+func serve(t *testing.T, s *train.ParamServer) func() train.ParamClient {
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	Register(g, s)
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+	return func() train.ParamClient {
+		conn, err := grpc.Dial("bufconn",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return NewClient(conn)
+	}
+}
+
+// notifyPush closes pushed when its worker first pushes.
+type notifyPush struct {
+	train.ParamClient
+	pushed chan struct{}
+}
+
+func (c notifyPush) Push(update *train.ItemParams) (int, error) {
+	select {
+	case <-c.pushed:
+	default:
+		close(c.pushed)
+	}
+	return c.ParamClient.Push(update)
+}
+
+type ratings struct {
+	u, i []string
+	r    []float32
+}
+
+// shard splits ratings into n shards by user.
+func shard(u, i []string, r []float32, n int) []ratings {
+	shards := make([]ratings, n)
+	for k := range r {
+		s := &shards[shardOf(u[k], n)]
+		s.u = append(s.u, u[k])
+		s.i = append(s.i, i[k])
+		s.r = append(s.r, r[k])
+	}
+	return shards
+}
+
+func shardOf(user string, n int) int {
+	var h int
+	for _, c := range user {
+		h = 31*h + int(c)
+	}
+	return h % n
+}
+
+func vocabulary(items []string) []string {
+	seen := make(map[string]bool)
+	var vocab []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			vocab = append(vocab, item)
+		}
+	}
+	sort.Strings(vocab)
+	return vocab
+}
+
+func sq(x float64) float64 {
+	return x * x
+}
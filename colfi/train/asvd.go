@@ -0,0 +1,289 @@
+package train
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// AsymSVD is Koren's Asymmetric-SVD. Users have no factor vector of their
+// own and are instead represented through the items they rated, so a user
+// unseen during training can be scored from their ratings alone.
+type AsymSVD struct {
+	Dataset *data.Dataset
+	QI      *Factors
+	XJ      *Factors
+	YJ      *Factors
+	BU      *[]float64
+	BI      *[]float64
+	// RU holds the indices of the ratings of every user, by internal ID.
+	RU         [][]int
+	GlobalMean float64
+	Bounds     data.Bounds
+	Config     *SVDConfig
+}
+
+func NewAsymSVD(dataset *data.Dataset, config *SVDConfig) (Model, error) {
+	if config == nil {
+		config = &SVDConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .02
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	globalMean := data.Mean32(dataset.Ratings)
+	bu, bi := initBiases(dataset, globalMean, config)
+
+	if config.Verbose {
+		log.Println("caching user ratings")
+	}
+	ru := data.GroupRatings(dataset.Users, len(dataset.UserMap))
+
+	// Fit draws nothing, so only the initial factors come from the Source.
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	svd := &AsymSVD{
+		Dataset:    dataset,
+		QI:         config.randFactors(rng, len(dataset.ItemMap)),
+		XJ:         config.randFactors(rng, len(dataset.ItemMap)),
+		YJ:         config.randFactors(rng, len(dataset.ItemMap)),
+		BU:         &bu,
+		BI:         &bi,
+		RU:         ru,
+		GlobalMean: globalMean,
+		Bounds:     config.ratingBounds(dataset),
+		Config:     &saved,
+	}
+	return svd, nil
+}
+
+// Fit processes ratings user by user: the implicit user vector is built once,
+// the item side is updated per rating, and the accumulated error is pushed
+// back into XJ and YJ at the end of each user.
+func (m *AsymSVD) Fit(numEpochs int) {
+	numFactors := m.Config.NumFactors
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	qi := m.QI
+	xj := m.XJ
+	yj := m.YJ
+	bu := *m.BU
+	bi := *m.BI
+	globalMean := m.GlobalMean
+	pu := make([]float64, numFactors)
+	sum := make([]float64, numFactors)
+
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		timer := startEpoch(m.Config.Instrument)
+		for u, idxs := range m.RU {
+			norm := 1 / math.Sqrt(float64(len(idxs)))
+			for f := range pu {
+				pu[f] = 0
+				sum[f] = 0
+			}
+			for _, idx := range idxs {
+				j := m.Dataset.Items[idx]
+				res := (float64(m.Dataset.Ratings[idx]) - (globalMean + bu[u] + bi[j])) * norm
+				xr := xj.Row(j)
+				yr := yj.Row(j)
+				for f := range pu {
+					pu[f] += res*xr[f] + norm*yr[f]
+				}
+			}
+
+			for _, idx := range idxs {
+				i := m.Dataset.Items[idx]
+				r := float64(m.Dataset.Ratings[idx])
+				qr := qi.Row(i)
+				dot := float64(0)
+				for f := range pu {
+					dot += pu[f] * qr[f]
+				}
+				err := r - (globalMean + bu[u] + bi[i] + dot)
+				bu[u] += lr * (err - reg*bu[u])
+				bi[i] += lr * (err - reg*bi[i])
+				for f := range pu {
+					sum[f] += err * qr[f]
+					qr[f] += lr * (err*pu[f] - reg*qr[f])
+				}
+			}
+
+			for _, idx := range idxs {
+				j := m.Dataset.Items[idx]
+				res := (float64(m.Dataset.Ratings[idx]) - (globalMean + bu[u] + bi[j])) * norm
+				xr := xj.Row(j)
+				yr := yj.Row(j)
+				for f := range sum {
+					xr[f] += lr * (res*sum[f] - reg*xr[f])
+					yr[f] += lr * (norm*sum[f] - reg*yr[f])
+				}
+			}
+		}
+		timer.done("AsymSVD", epoch, len(m.Dataset.Ratings))
+	}
+}
+
+func (m *AsymSVD) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *AsymSVD) PredictID(uid, iid int) float64 {
+	var pu []float64
+	if uid >= 0 && iid >= 0 {
+		pu = m.userVector(uid)
+	}
+	return m.predictWith(uid, iid, pu)
+}
+
+// scoreUser builds uid's user vector, which PredictID rebuilds from the
+// user's ratings on every call, once for all items.
+func (m *AsymSVD) scoreUser(uid int) func(iid int) float64 {
+	var pu []float64
+	if uid >= 0 {
+		pu = m.userVector(uid)
+	}
+	return func(iid int) float64 {
+		return m.predictWith(uid, iid, pu)
+	}
+}
+
+// predictWith is PredictID given uid's user vector pu. uid is -1 for users
+// unseen in training, whose pu, if any, comes from vecFromRatings.
+func (m *AsymSVD) predictWith(uid, iid int, pu []float64) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		p += (*m.BI)[iid]
+		if pu != nil {
+			p += dot(pu, m.QI.Row(iid))
+		}
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+// biasesID is PredictID without the latent factors.
+func (m *AsymSVD) biasesID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		p += (*m.BI)[iid]
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+// PredictFromRatings scores item i for a user known only by the ratings
+// passed in, e.g. a user who signed up after training. Items absent from
+// the training data are ignored and the user bias is taken to be zero.
+func (m *AsymSVD) PredictFromRatings(ratings map[string]float32, i string) float64 {
+	iid, ok := m.Dataset.ItemMap[i]
+	if !ok {
+		iid = -1
+	}
+	return m.predictWith(-1, iid, m.vecFromRatings(ratings))
+}
+
+// RecommendFromRatings returns the n items that score highest, as by
+// PredictFromRatings, for a user known only by ratings, leaving out the
+// items rated. The user vector is built once for all items.
+func (m *AsymSVD) RecommendFromRatings(ratings map[string]float32, n int) []ScoredItem {
+	pu := m.vecFromRatings(ratings)
+	scores := make([]ScoredItem, 0, len(m.Dataset.ItemIDs))
+	for iid, i := range m.Dataset.ItemIDs {
+		if _, ok := ratings[i]; !ok {
+			scores = append(scores, ScoredItem{i, m.predictWith(-1, iid, pu)})
+		}
+	}
+	return topN(scores, n)
+}
+
+// vecFromRatings returns the user vector of ratings, or nil if none of the
+// rated items is known. Items are visited in ID order, so the same ratings
+// always give the same vector.
+func (m *AsymSVD) vecFromRatings(ratings map[string]float32) []float64 {
+	items := make([]int, 0, len(ratings))
+	for item := range ratings {
+		if j, ok := m.Dataset.ItemMap[item]; ok {
+			items = append(items, j)
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	sort.Ints(items)
+	rs := make([]float64, len(items))
+	for k, j := range items {
+		rs[k] = float64(ratings[m.Dataset.ItemIDs[j]])
+	}
+	return m.userVec(items, rs, 0)
+}
+
+func (m *AsymSVD) userVec(items []int, ratings []float64, bu float64) []float64 {
+	pu := make([]float64, m.Config.NumFactors)
+	norm := 1 / math.Sqrt(float64(len(items)))
+	for k, j := range items {
+		res := (ratings[k] - (m.GlobalMean + bu + (*m.BI)[j])) * norm
+		yr := m.YJ.Row(j)
+		for f, x := range m.XJ.Row(j) {
+			pu[f] += res*x + norm*yr[f]
+		}
+	}
+	return pu
+}
+
+func (m *AsymSVD) userVector(uid int) []float64 {
+	idxs := m.RU[uid]
+	items := make([]int, len(idxs))
+	ratings := make([]float64, len(idxs))
+	for k, idx := range idxs {
+		items[k] = m.Dataset.Items[idx]
+		ratings[k] = float64(m.Dataset.Ratings[idx])
+	}
+	return m.userVec(items, ratings, (*m.BU)[uid])
+}
+
+func (m *AsymSVD) itemVectors() (*Factors, []float64) {
+	return m.QI, *m.BI
+}
+
+func (m *AsymSVD) NumParams() int {
+	return len(m.QI.Data) + len(m.XJ.Data) + len(m.YJ.Data) + len(*m.BU) + len(*m.BI) + 1
+}
+
+func (m *AsymSVD) Summary() string {
+	return summarize("AsymSVD", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *AsymSVD) GetDataset() *data.Dataset {
+	return m.Dataset
+}
@@ -0,0 +1,83 @@
+package train
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"main/colfi/data"
+)
+
+func TestAsymSVDRecommend(t *testing.T) {
+	d := testDataset(t)
+	m, err := NewAsymSVD(d, &SVDConfig{NumFactors: 8, Clip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(5)
+	for _, u := range d.UserIDs[:5] {
+		recs := Recommend(m, u, len(d.ItemIDs), nil)
+		if len(recs) != len(d.ItemIDs) {
+			t.Fatalf("%s: got %d items, want %d", u, len(recs), len(d.ItemIDs))
+		}
+		for _, s := range recs {
+			if p := m.Predict(u, s.Item); s.Score != p {
+				t.Errorf("%s, %s: Recommend scored %v, Predict %v", u, s.Item, s.Score, p)
+			}
+		}
+	}
+}
+
+func TestAsymSVDRecommendFromRatings(t *testing.T) {
+	d := testDataset(t)
+	m, err := NewAsymSVD(d, &SVDConfig{NumFactors: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(5)
+	asvd := m.(*AsymSVD)
+	ratings := map[string]float32{"i1": 5, "i2": 1, "i3": 4, "unknown": 3}
+	recs := asvd.RecommendFromRatings(ratings, 10)
+	if len(recs) != 10 {
+		t.Fatalf("got %d items, want 10", len(recs))
+	}
+	changed := false
+	for _, s := range recs {
+		if _, ok := ratings[s.Item]; ok {
+			t.Errorf("recommended %s, which is rated", s.Item)
+		}
+		if p := asvd.PredictFromRatings(ratings, s.Item); s.Score != p {
+			t.Errorf("%s: RecommendFromRatings scored %v, PredictFromRatings %v", s.Item, s.Score, p)
+		}
+		if s.Score != asvd.PredictFromRatings(nil, s.Item) {
+			changed = true
+		}
+	}
+	if !changed {
+		t.Error("ratings did not change any score")
+	}
+}
+
+// testDataset returns a small trainset of random ratings, 1 to 5, of 40
+// items by 60 users, the same on every call.
+func testDataset(t *testing.T) *data.Dataset {
+	r := rand.New(rand.NewSource(1))
+	var u, i []string
+	var ratings []float32
+	for uid := 0; uid < 60; uid++ {
+		for iid := 0; iid < 40; iid++ {
+			if r.Intn(3) == 0 {
+				u = append(u, fmt.Sprint("u", uid))
+				i = append(i, fmt.Sprint("i", iid))
+				ratings = append(ratings, float32(1+r.Intn(5)))
+			}
+		}
+	}
+	Seed(1)
+	t.Cleanup(func() { SetRand(nil) })
+	d, _, err := data.DatasetsFromSlices(u, i, ratings, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
@@ -0,0 +1,58 @@
+package train
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+type ScoredUser struct {
+	User  string
+	Score float64
+}
+
+// RecommendUsersForItem scores every user of the model's training data for
+// the item and returns the n highest scoring, e.g. as the audience for a
+// campaign. Users are scored in parallel, by internal ID where the model
+// supports it.
+func RecommendUsersForItem(m Model, item string, n int) ([]ScoredUser, error) {
+	d := m.GetDataset()
+	iid, ok := d.ItemMap[item]
+	if !ok {
+		return nil, fmt.Errorf("unknown item %q", item)
+	}
+	idp, _ := m.(IDPredictor)
+	scores := make([]ScoredUser, len(d.UserIDs))
+	numWorkers := runtime.NumCPU()
+	chunk := (len(scores) + numWorkers - 1) / numWorkers
+	var wg sync.WaitGroup
+	for start := 0; start < len(scores); start += chunk {
+		end := start + chunk
+		if end > len(scores) {
+			end = len(scores)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for uid := start; uid < end; uid++ {
+				s := ScoredUser{User: d.UserIDs[uid]}
+				if idp != nil {
+					s.Score = idp.PredictID(uid, iid)
+				} else {
+					s.Score = m.Predict(s.User, item)
+				}
+				scores[uid] = s
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	sort.Slice(scores, func(a, b int) bool {
+		return scores[a].Score > scores[b].Score
+	})
+	if n > 0 && n < len(scores) {
+		scores = scores[:n]
+	}
+	return scores, nil
+}
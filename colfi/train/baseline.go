@@ -0,0 +1,137 @@
+package train
+
+import (
+	"log"
+
+	"main/colfi/data"
+)
+
+// BaselineOnly predicts a rating as the global mean plus a user bias and an
+// item bias and nothing else, which is what the factor models add their
+// factors to. Comparing it with them measures what the factors contribute.
+type BaselineOnly struct {
+	Dataset    *data.Dataset
+	BU         []float64
+	BI         []float64
+	GlobalMean float64
+	Bounds     data.Bounds
+	Config     *BaselineConfig
+}
+
+type BaselineConfig struct {
+	// Solver is SGDSolver or ALSSolver. ALS solves the item biases and then
+	// the user biases in closed form every epoch, as Surprise does, and
+	// usually needs only a few epochs.
+	Solver SVDSolver
+	// LR and Reg are the learning rate and regularization of SGD.
+	LR  float64
+	Reg float64
+	// RegU and RegI are the regularization of the user and item biases
+	// under ALS, in ratings' worth of shrinkage towards zero.
+	RegU    float64
+	RegI    float64
+	Clip    bool
+	Verbose bool
+}
+
+func NewBaselineOnly(dataset *data.Dataset, config *BaselineConfig) (Model, error) {
+	if config == nil {
+		config = &BaselineConfig{}
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .02
+	}
+	if config.RegU == 0 {
+		config.RegU = 15
+	}
+	if config.RegI == 0 {
+		config.RegI = 10
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &BaselineOnly{
+		Dataset:    dataset,
+		BU:         make([]float64, len(dataset.UserMap)),
+		BI:         make([]float64, len(dataset.ItemMap)),
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Bounds:     dataset.RatingBounds(),
+		Config:     config,
+	}, nil
+}
+
+func (m *BaselineOnly) Fit(numEpochs int) {
+	d := m.Dataset
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		if m.Config.Solver == ALSSolver {
+			m.alsStep(d.Items, d.Users, m.BI, m.BU, d.ItemCounts(), m.Config.RegI)
+			m.alsStep(d.Users, d.Items, m.BU, m.BI, d.UserCounts(), m.Config.RegU)
+			continue
+		}
+		lr, reg := m.Config.LR, m.Config.Reg
+		for idx, r := range d.Ratings {
+			u, i := d.Users[idx], d.Items[idx]
+			err := float64(r) - (m.GlobalMean + m.BU[u] + m.BI[i])
+			m.BU[u] += lr * (err - reg*m.BU[u])
+			m.BI[i] += lr * (err - reg*m.BI[i])
+		}
+	}
+}
+
+// alsStep sets every bias in b to the shrunk mean residual of its ratings
+// given the other biases, where rowOf and otherOf map a rating to the rows of
+// b and other.
+func (m *BaselineOnly) alsStep(rowOf, otherOf []int, b, other []float64, counts []int, reg float64) {
+	for k := range b {
+		b[k] = 0
+	}
+	for idx, r := range m.Dataset.Ratings {
+		b[rowOf[idx]] += float64(r) - m.GlobalMean - other[otherOf[idx]]
+	}
+	for k, n := range counts {
+		b[k] /= reg + float64(n)
+	}
+}
+
+func (m *BaselineOnly) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *BaselineOnly) PredictID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += m.BU[uid]
+	}
+	if iid >= 0 {
+		p += m.BI[iid]
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+func (m *BaselineOnly) biasesID(uid, iid int) float64 {
+	return m.PredictID(uid, iid)
+}
+
+func (m *BaselineOnly) NumParams() int {
+	return len(m.BU) + len(m.BI) + 1
+}
+
+func (m *BaselineOnly) Summary() string {
+	return summarize("BaselineOnly", m.Dataset, 0, m.NumParams(), *m.Config)
+}
+
+func (m *BaselineOnly) GetDataset() *data.Dataset {
+	return m.Dataset
+}
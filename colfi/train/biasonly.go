@@ -0,0 +1,44 @@
+package train
+
+// biasPredictor is implemented by models with a global mean, user bias and
+// item bias underneath their latent factors.
+type biasPredictor interface {
+	biasesID(uid, iid int) float64
+}
+
+// biasOnly scores with the biases of a biasPredictor alone.
+type biasOnly struct {
+	Model
+	b biasPredictor
+}
+
+func (m biasOnly) Predict(u, i string) float64 {
+	return m.PredictID(m.GetDataset().LookupIDs(u, i))
+}
+
+func (m biasOnly) PredictID(uid, iid int) float64 {
+	return m.b.biasesID(uid, iid)
+}
+
+// gateBiasOnly returns m, or m scored by its biases alone if u has fewer
+// than minRatings training ratings and m has biases. Unknown users have
+// none.
+func gateBiasOnly(m Model, u string, minRatings int) Model {
+	b, ok := m.(biasPredictor)
+	if !ok || minRatings <= 0 {
+		return m
+	}
+	d := m.GetDataset()
+	if uid, ok := d.UserMap[u]; ok && d.UserCounts()[uid] >= minRatings {
+		return m
+	}
+	return biasOnly{m, b}
+}
+
+// PredictGated is m.Predict(u, i), except that a user with fewer than
+// biasOnlyBelow training ratings, whose factors are mostly noise, is scored
+// by the global mean and biases alone. Models without biases (SVD, SVDpp,
+// AsymSVD and HashedSVD have them) are never gated.
+func PredictGated(m Model, u, i string, biasOnlyBelow int) float64 {
+	return gateBiasOnly(m, u, biasOnlyBelow).Predict(u, i)
+}
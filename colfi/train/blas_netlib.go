@@ -0,0 +1,19 @@
+//go:build netlib
+
+package train
+
+import (
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/lapack/lapack64"
+	blasnetlib "gonum.org/v1/netlib/blas/netlib"
+	lapacknetlib "gonum.org/v1/netlib/lapack/netlib"
+)
+
+// Building with -tags netlib routes the factorizations and products behind
+// the ALS solves through a cgo BLAS/LAPACK such as OpenBLAS. This needs
+// CGO_LDFLAGS pointing at the library, e.g. CGO_LDFLAGS="-lopenblas".
+func init() {
+	blas64.Use(blasnetlib.Implementation{})
+	lapack64.Use(lapacknetlib.Implementation{})
+	blasBackend = "netlib"
+}
@@ -0,0 +1,94 @@
+//go:build netlib
+
+package train
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/blas/gonum"
+	gonumlapack "gonum.org/v1/gonum/lapack/gonum"
+	"gonum.org/v1/gonum/lapack/lapack64"
+	blasnetlib "gonum.org/v1/netlib/blas/netlib"
+	lapacknetlib "gonum.org/v1/netlib/lapack/netlib"
+
+	"main/colfi/data"
+)
+
+// TestNetlibMatchesGonum trains the models behind the netlib backend once on
+// netlib and once on the pure Go BLAS/LAPACK and checks that they predict
+// the same, up to rounding.
+func TestNetlibMatchesGonum(t *testing.T) {
+	newModels := map[string]func(*data.Dataset) (Model, error){
+		"svd-als": func(d *data.Dataset) (Model, error) {
+			return NewSVD(d, &SVDConfig{NumFactors: 8, Solver: ALSSolver})
+		},
+		"ials": func(d *data.Dataset) (Model, error) {
+			return NewImplicitALS(d, &ImplicitALSConfig{NumFactors: 8})
+		},
+		"eals": func(d *data.Dataset) (Model, error) {
+			return NewEALS(d, &EALSConfig{NumFactors: 8})
+		},
+		"ease": func(d *data.Dataset) (Model, error) {
+			return NewEASE(d, &EASEConfig{})
+		},
+	}
+	defer func() {
+		blas64.Use(blasnetlib.Implementation{})
+		lapack64.Use(lapacknetlib.Implementation{})
+	}()
+	for name, newModel := range newModels {
+		t.Run(name, func(t *testing.T) {
+			blas64.Use(blasnetlib.Implementation{})
+			lapack64.Use(lapacknetlib.Implementation{})
+			want := netlibPredictions(t, newModel)
+			blas64.Use(gonum.Implementation{})
+			lapack64.Use(gonumlapack.Implementation{})
+			got := netlibPredictions(t, newModel)
+			for k := range want {
+				if d := math.Abs(got[k] - want[k]); d > 1e-9*math.Max(1, math.Abs(want[k])) {
+					t.Fatalf("prediction %d: gonum %v, netlib %v", k, got[k], want[k])
+				}
+			}
+		})
+	}
+}
+
+// netlibPredictions trains a model built by newModel on fixed synthetic
+// ratings and returns its predictions for every user and item.
+func netlibPredictions(t *testing.T, newModel func(*data.Dataset) (Model, error)) []float64 {
+	const numUsers, numItems = 60, 40
+	Seed(1)
+	defer SetRand(nil)
+	r := rand.New(rand.NewSource(1))
+	var u, i []string
+	var ratings []float32
+	for uid := 0; uid < numUsers; uid++ {
+		for iid := 0; iid < numItems; iid++ {
+			if r.Intn(3) == 0 {
+				u = append(u, fmt.Sprint("u", uid))
+				i = append(i, fmt.Sprint("i", iid))
+				ratings = append(ratings, float32(1+r.Intn(5)))
+			}
+		}
+	}
+	trainset, _, err := data.DatasetsFromSlices(u, i, ratings, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newModel(trainset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(5)
+	var preds []float64
+	for _, u := range trainset.UserIDs {
+		for _, i := range trainset.ItemIDs {
+			preds = append(preds, m.Predict(u, i))
+		}
+	}
+	return preds
+}
@@ -0,0 +1,58 @@
+package train
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"main/colfi/data"
+)
+
+// RelevanceWeight is the key of Blend.Weights that weights the model's own
+// score.
+const RelevanceWeight = "relevance"
+
+// Blend is a PostProcessor that scores items by a weighted sum of the
+// model's score and numeric item attributes, such as margin or freshness,
+// taken from Features. The model's score has weight Weights[RelevanceWeight],
+// or 1 if it is absent; every other key names an attribute. Items missing an
+// attribute, or whose first value of it is not a number, get zero for it.
+type Blend struct {
+	Features data.ItemFeatures
+	Weights  map[string]float64
+}
+
+func (b Blend) Process(u, i string, score float64) float64 {
+	rel, ok := b.Weights[RelevanceWeight]
+	if !ok {
+		rel = 1
+	}
+	s := rel * score
+	for attr, w := range b.Weights {
+		if attr == RelevanceWeight {
+			continue
+		}
+		if x, ok := b.Features.Number(i, attr); ok {
+			s += w * x
+		}
+	}
+	return s
+}
+
+// ParseWeights parses weights of the form attr:weight, e.g. margin:0.3 or
+// relevance:0.8, into a map for Blend.
+func ParseWeights(specs []string) (map[string]float64, error) {
+	weights := make(map[string]float64, len(specs))
+	for _, spec := range specs {
+		k := strings.LastIndex(spec, ":")
+		if k <= 0 {
+			return nil, fmt.Errorf("%q is not of the form attr:weight", spec)
+		}
+		w, err := strconv.ParseFloat(spec[k+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", spec, err)
+		}
+		weights[spec[:k]] = w
+	}
+	return weights, nil
+}
@@ -0,0 +1,270 @@
+package train
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+type RankingLoss int
+
+const (
+	// BPRLoss is the Bayesian Personalized Ranking log-sigmoid pairwise loss
+	// with one uniformly sampled negative per positive.
+	BPRLoss RankingLoss = iota
+	// WARPLoss is the Weighted Approximate-Rank Pairwise loss. Negatives are
+	// sampled until one violates the margin and the update is weighted by the
+	// rank estimated from the number of draws it took, which concentrates
+	// training on the top of the ranking.
+	WARPLoss
+)
+
+// BPR is a pairwise ranking model for implicit feedback: every rating is a
+// positive interaction and the model learns to score it above items the user
+// has not interacted with.
+type BPR struct {
+	Dataset *data.Dataset
+	PU      *Factors
+	QI      *Factors
+	BI      *[]float64
+	IU      map[int][]int
+	Config  *BPRConfig
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+}
+
+type BPRConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	LR         float64
+	Reg        float64
+	Loss       RankingLoss
+	// MaxSampled caps the number of negatives drawn per positive by WARP.
+	MaxSampled int
+	// Source, if set, draws the initial factors and the sampled pairs, as
+	// SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewBPR(dataset *data.Dataset, config *BPRConfig) (Model, error) {
+	if config == nil {
+		config = &BPRConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .05
+	}
+	if config.Reg == 0 {
+		config.Reg = .002
+	}
+	if config.MaxSampled == 0 {
+		config.MaxSampled = 100
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	bi := make([]float64, len(dataset.ItemMap))
+
+	if config.Verbose {
+		log.Println("caching user interactions")
+	}
+	iu := make(map[int][]int, len(dataset.UserMap))
+	for idx := range dataset.Ratings {
+		uid := dataset.Users[idx]
+		iu[uid] = append(iu[uid], dataset.Items[idx])
+	}
+	for _, items := range iu {
+		sort.Ints(items)
+	}
+
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	return &BPR{
+		Dataset: dataset,
+		PU:      randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.UserMap), config.NumFactors),
+		QI:      randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.ItemMap), config.NumFactors),
+		BI:      &bi,
+		IU:      iu,
+		Config:  &saved,
+		src:     config.Source,
+	}, nil
+}
+
+func (m *BPR) Fit(numEpochs int) {
+	numRatings := len(m.Dataset.Ratings)
+	numItems := len(m.Dataset.ItemMap)
+	lr := m.Config.LR
+	reg := m.Config.Reg
+	pu := m.PU
+	qi := m.QI
+	bi := *m.BI
+	rng := random.Or(m.src)
+	// Users with every item among their positives have no negative to
+	// sample. IU repeats an item a user rated more than once, so its
+	// length overcounts them.
+	saturated := make(map[int]bool)
+	for u, items := range m.IU {
+		if countDistinct(items) >= numItems {
+			saturated[u] = true
+		}
+	}
+
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		for n := 0; n < numRatings; n++ {
+			idx := rng.Intn(numRatings)
+			u := m.Dataset.Users[idx]
+			i := m.Dataset.Items[idx]
+			if saturated[u] {
+				continue
+			}
+			pr := pu.Row(u)
+			qri := qi.Row(i)
+			xi := bi[i] + dot(pr, qri)
+
+			var j int
+			var g float64
+			switch m.Config.Loss {
+			case WARPLoss:
+				trials := 0
+				found := false
+				for trials < m.Config.MaxSampled {
+					trials++
+					j = m.sampleNegative(rng, u, numItems)
+					if bi[j]+dot(pr, qi.Row(j)) > xi-1 {
+						found = true
+						break
+					}
+				}
+				if !found {
+					continue
+				}
+				g = warpWeight((numItems - 1) / trials)
+			default:
+				j = m.sampleNegative(rng, u, numItems)
+				x := xi - bi[j] - dot(pr, qi.Row(j))
+				g = 1 / (1 + math.Exp(x))
+			}
+
+			qrj := qi.Row(j)
+			bi[i] += lr * (g - reg*bi[i])
+			bi[j] += lr * (-g - reg*bi[j])
+			for f := range pr {
+				puf := pr[f]
+				qif := qri[f]
+				qjf := qrj[f]
+				pr[f] += lr * (g*(qif-qjf) - reg*puf)
+				qri[f] += lr * (g*puf - reg*qif)
+				qrj[f] += lr * (-g*puf - reg*qjf)
+			}
+		}
+	}
+}
+
+func (m *BPR) sampleNegative(rng *rand.Rand, u, numItems int) int {
+	items := m.IU[u]
+	for {
+		j := rng.Intn(numItems)
+		k := sort.SearchInts(items, j)
+		if k == len(items) || items[k] != j {
+			return j
+		}
+	}
+}
+
+// countDistinct returns the number of distinct values in the sorted slice
+// items.
+func countDistinct(items []int) int {
+	var n int
+	for k, item := range items {
+		if k == 0 || item != items[k-1] {
+			n++
+		}
+	}
+	return n
+}
+
+// warpWeight is L(k) = Σ_{n=1..k} 1/n, the rank-to-weight transform from the
+// WSABIE paper.
+func warpWeight(k int) float64 {
+	var l float64
+	for n := 1; n <= k; n++ {
+		l += 1 / float64(n)
+	}
+	return l
+}
+
+func (m *BPR) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *BPR) PredictID(uid, iid int) float64 {
+	if iid < 0 {
+		return 0
+	}
+	p := (*m.BI)[iid]
+	if uid >= 0 {
+		p += dot(m.PU.Row(uid), m.QI.Row(iid))
+	}
+	return p
+}
+
+// TopN returns the n items that score highest for u among those u has not
+// interacted with in the training data.
+func (m *BPR) TopN(u string, n int) []ScoredItem {
+	var seen []int
+	if uid, ok := m.Dataset.UserMap[u]; ok {
+		seen = m.IU[uid]
+	}
+	recs, _ := RankItems(context.Background(), m, u, n, func(iid int) bool {
+		k := sort.SearchInts(seen, iid)
+		return k == len(seen) || seen[k] != iid
+	})
+	return recs
+}
+
+func (m *BPR) userVector(uid int) []float64 {
+	return m.PU.Row(uid)
+}
+
+func (m *BPR) itemVectors() (*Factors, []float64) {
+	return m.QI, *m.BI
+}
+
+func (m *BPR) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data) + len(*m.BI)
+}
+
+func (m *BPR) Summary() string {
+	return summarize("BPR", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *BPR) GetDataset() *data.Dataset {
+	return m.Dataset
+}
+
+func dot(a, b []float64) float64 {
+	var s float64
+	for k := range a {
+		s += a[k] * b[k]
+	}
+	return s
+}
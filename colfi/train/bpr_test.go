@@ -0,0 +1,44 @@
+package train
+
+import (
+	"math/rand"
+	"testing"
+
+	"main/colfi/data"
+)
+
+func TestBPRRepeatedPositives(t *testing.T) {
+	// a rated i0 three times, so it has as many ratings as there are items
+	// but still has i2 to sample as a negative. c rated every item and has
+	// none.
+	u := []string{"a", "a", "a", "a", "b", "c", "c", "c"}
+	i := []string{"i0", "i0", "i0", "i1", "i2", "i0", "i1", "i2"}
+	r := []float32{1, 1, 1, 1, 1, 1, 1, 1}
+	d, _, err := data.DatasetsFromSlices(u, i, r, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewBPR(d, &BPRConfig{NumFactors: 2, Source: rand.NewSource(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bpr := m.(*BPR)
+	a, c := bpr.PU.Row(d.UserMap["a"]), bpr.PU.Row(d.UserMap["c"])
+	a0, c0 := append([]float64(nil), a...), append([]float64(nil), c...)
+	m.Fit(20)
+	if equal(a, a0) {
+		t.Error("a was not trained")
+	}
+	if !equal(c, c0) {
+		t.Error("c was trained without any negative item")
+	}
+}
+
+func equal(a, b []float64) bool {
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
@@ -0,0 +1,31 @@
+package train
+
+import (
+	"io"
+
+	"main/colfi/infer"
+)
+
+// Bundle is a compact model with a prebuilt ANN index over its items, for
+// serving processes that import package infer.
+type Bundle = infer.Bundle
+
+// NewBundle extracts the compact form of m, as NewCompact, and indexes its
+// item vectors as NewANNCandidates does.
+func NewBundle(m Model, config *ANNConfig) (*Bundle, error) {
+	c, err := NewCompact(m)
+	if err != nil {
+		return nil, err
+	}
+	config = annDefaults(config)
+	qi := &Factors{Rows: c.QI.Rows, Cols: c.QI.Cols, Stride: c.QI.Stride, Data: c.QI.Data}
+	return &Bundle{Model: c, Index: buildIndex(qi, c.BI, config)}, nil
+}
+
+func SaveBundle(w io.Writer, b *Bundle) error {
+	return b.Save(w)
+}
+
+func LoadBundle(r io.Reader) (*Bundle, error) {
+	return infer.LoadBundle(r)
+}
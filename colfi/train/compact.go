@@ -0,0 +1,61 @@
+package train
+
+import (
+	"fmt"
+	"io"
+
+	"main/colfi/data"
+	"main/colfi/infer"
+)
+
+// Compact is the scoring part of a factor model without the training data,
+// for inference-only builds such as WebAssembly, which should import
+// package infer rather than colfi.
+type Compact = infer.Model
+
+// NewCompact extracts the scoring function of m. SVD, AsymSVD, BPR, EALS and
+// ImplicitALS are supported. For AsymSVD the user vectors, which it derives
+// from each user's ratings, are precomputed.
+func NewCompact(m Model) (*Compact, error) {
+	d := m.GetDataset()
+	c := &Compact{UserIDs: d.UserIDs, ItemIDs: d.ItemIDs}
+	var clip bool
+	var bounds data.Bounds
+	switch v := m.(type) {
+	case *SVD:
+		c.PU, c.QI, c.BU, c.BI, c.GlobalMean = inferFactors(v.PU), inferFactors(v.QI), *v.BU, *v.BI, v.GlobalMean
+		clip, bounds = v.Config.Clip, v.Bounds
+	case *AsymSVD:
+		pu := newFactors(len(d.UserMap), v.Config.NumFactors)
+		for uid := 0; uid < pu.Rows; uid++ {
+			copy(pu.Row(uid), v.userVector(uid))
+		}
+		c.PU, c.QI, c.BU, c.BI, c.GlobalMean = inferFactors(pu), inferFactors(v.QI), *v.BU, *v.BI, v.GlobalMean
+		clip, bounds = v.Config.Clip, v.Bounds
+	case *BPR:
+		c.PU, c.QI, c.BI = inferFactors(v.PU), inferFactors(v.QI), *v.BI
+	case *EALS:
+		c.PU, c.QI = inferFactors(v.PU), inferFactors(v.QI)
+	case *ImplicitALS:
+		c.PU, c.QI = inferFactors(v.PU), inferFactors(v.QI)
+	default:
+		return nil, fmt.Errorf("no compact form for %T", m)
+	}
+	if clip {
+		c.Clip = &infer.Bounds{Min: bounds.Min, Max: bounds.Max, Step: bounds.Step}
+	}
+	return c, nil
+}
+
+// inferFactors views f as an infer.Factors, sharing its data.
+func inferFactors(f *Factors) *infer.Factors {
+	return &infer.Factors{Rows: f.Rows, Cols: f.Cols, Stride: f.Stride, Data: f.Data}
+}
+
+func SaveCompact(w io.Writer, c *Compact) error {
+	return c.Save(w)
+}
+
+func LoadCompact(r io.Reader) (*Compact, error) {
+	return infer.Load(r)
+}
@@ -0,0 +1,310 @@
+package train
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// ParamServer holds the item factors and biases shared by a group of
+// Workers, each of which trains an SVD on its own shard of users. Package
+// paramgrpc serves it to workers on other machines over gRPC:
+//
+//	srv, err := train.NewParamServer(items, globalMean, numWorkers, time.Minute, config)
+//	g := grpc.NewServer()
+//	paramgrpc.Register(g, srv)
+//	g.Serve(listener)
+//
+// Training is synchronous: every epoch each worker pulls the item
+// parameters, runs one local epoch and pushes the change it made. Once all
+// workers have pushed, the changes are summed into the shared parameters and
+// the next epoch starts. If a worker fails instead, whether it calls Abort or
+// misses the timeout, the whole run fails: every waiting and later call
+// returns the error, as the remaining workers cannot finish the epoch alone.
+type ParamServer struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	vocab      Vocabulary
+	qi         *Factors
+	bi         []float64
+	epoch      int
+	pushed     int
+	numWorkers int
+	dqi        []float64
+	dbi        []float64
+	timeout    time.Duration
+	timer      *time.Timer
+	err        error
+}
+
+// Vocabulary is what a worker needs to lay out its shard consistently with
+// the server and every other worker.
+type Vocabulary struct {
+	Items      []string
+	GlobalMean float64
+	Config     SVDConfig
+}
+
+// ParamClient is how a Worker reaches its ParamServer. *ParamServer
+// implements it for workers in the same process, and paramgrpc.NewClient
+// over a gRPC connection.
+type ParamClient interface {
+	Vocabulary() (*Vocabulary, error)
+	Pull() (*ItemParams, error)
+	Push(update *ItemParams) (int, error)
+	Abort(reason string) error
+}
+
+// ItemParams is what workers exchange with the server: the item factors
+// and biases they pull for Epoch, or the change to them they push after
+// training it.
+type ItemParams struct {
+	Epoch int
+	QI    *Factors
+	BI    []float64
+}
+
+// NewParamServer returns a server for numWorkers workers training with
+// config, which must use SGDSolver: the other solvers do not train by
+// small steps, so the summed changes of the shards would overshoot. Once the
+// first worker of an epoch has pushed, the others have timeout to follow, or
+// indefinitely if it is zero.
+func NewParamServer(items []string, globalMean float64, numWorkers int, timeout time.Duration, config *SVDConfig) (*ParamServer, error) {
+	if config == nil {
+		config = &SVDConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items")
+	}
+	if numWorkers < 1 {
+		return nil, fmt.Errorf("need at least one worker, got %d", numWorkers)
+	}
+	if timeout < 0 {
+		return nil, fmt.Errorf("timeout must be non-negative, got %v", timeout)
+	}
+	if config.Solver != SGDSolver {
+		return nil, fmt.Errorf("ParamServer needs SGDSolver, got solver %d", config.Solver)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	// Workers fit their own shard only, so initialization from a truncated
+	// SVD of the full matrix is not available. The config goes to them
+	// without Source, which gob cannot send.
+	c := *config
+	c.InitSVD = false
+	c.Source = nil
+	s := &ParamServer{
+		vocab:      Vocabulary{items, globalMean, c},
+		qi:         c.randFactors(random.Or(config.Source), len(items)),
+		bi:         make([]float64, len(items)),
+		numWorkers: numWorkers,
+		dqi:        make([]float64, len(items)*config.NumFactors),
+		dbi:        make([]float64, len(items)),
+		timeout:    timeout,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s, nil
+}
+
+// Vocabulary returns the items, global mean and config the workers share.
+func (s *ParamServer) Vocabulary() (*Vocabulary, error) {
+	vocab := s.vocab
+	return &vocab, nil
+}
+
+// Pull returns a copy of the item parameters of the current epoch.
+func (s *ParamServer) Pull() (*ItemParams, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &ItemParams{
+		Epoch: s.epoch,
+		QI:    &Factors{s.qi.Rows, s.qi.Cols, s.qi.Stride, append([]float64(nil), s.qi.Data...)},
+		BI:    append([]float64(nil), s.bi...),
+	}, nil
+}
+
+// Push adds a worker's change to the item parameters for the current epoch
+// and blocks until every worker has pushed theirs, or the run fails. It
+// returns the epoch that follows.
+func (s *ParamServer) Push(update *ItemParams) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	if update == nil || update.QI == nil {
+		return 0, fmt.Errorf("update has no item factors")
+	}
+	if update.Epoch != s.epoch {
+		return 0, fmt.Errorf("push for epoch %d during epoch %d", update.Epoch, s.epoch)
+	}
+	if len(update.QI.Data) != len(s.dqi) || len(update.BI) != len(s.dbi) {
+		return 0, fmt.Errorf("update does not match the item vocabulary")
+	}
+	for k, d := range update.QI.Data {
+		s.dqi[k] += d
+	}
+	for k, d := range update.BI {
+		s.dbi[k] += d
+	}
+	s.pushed++
+	if s.pushed == 1 && s.timeout > 0 && s.numWorkers > 1 {
+		epoch := s.epoch
+		s.timer = time.AfterFunc(s.timeout, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.epoch == epoch {
+				s.fail(fmt.Errorf("epoch %d: only %d of %d workers pushed within %v", epoch, s.pushed, s.numWorkers, s.timeout))
+			}
+		})
+	}
+	if s.pushed == s.numWorkers {
+		if s.timer != nil {
+			s.timer.Stop()
+			s.timer = nil
+		}
+		for k := range s.dqi {
+			s.qi.Data[k] += s.dqi[k]
+			s.dqi[k] = 0
+		}
+		for k := range s.dbi {
+			s.bi[k] += s.dbi[k]
+			s.dbi[k] = 0
+		}
+		s.pushed = 0
+		s.epoch++
+		s.cond.Broadcast()
+	}
+	for update.Epoch == s.epoch && s.err == nil {
+		s.cond.Wait()
+	}
+	if update.Epoch == s.epoch {
+		return 0, s.err
+	}
+	return s.epoch, nil
+}
+
+// Abort fails the run with reason, for a worker that cannot finish its
+// epochs, releasing the workers waiting in Push.
+func (s *ParamServer) Abort(reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail(fmt.Errorf("aborted by a worker: %s", reason))
+	return nil
+}
+
+// fail records err as the reason the run failed, unless it already has,
+// and wakes up the waiting workers. s.mu must be held.
+func (s *ParamServer) fail(err error) {
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.cond.Broadcast()
+}
+
+// Worker trains the user factors for one shard of users and contributes item
+// factor updates to a ParamServer.
+type Worker struct {
+	Model   *SVD
+	client  ParamClient
+	dropped int
+}
+
+// NewWorker builds a worker over the given ratings. Ratings for items the
+// server does not know about are dropped.
+func NewWorker(client ParamClient, u, i []string, r []float32) (*Worker, error) {
+	vocab, err := client.Vocabulary()
+	if err != nil {
+		return nil, err
+	}
+	if len(u) != len(i) || len(u) != len(r) {
+		return nil, fmt.Errorf("length mismatch: %d users, %d items, %d ratings", len(u), len(i), len(r))
+	}
+	dataset := data.NewDataset()
+	for k, item := range vocab.Items {
+		dataset.ItemMap[item] = k
+	}
+	dataset.ItemIDs = append(dataset.ItemIDs, vocab.Items...)
+	var dropped int
+	for k := range r {
+		if _, ok := dataset.ItemMap[i[k]]; !ok {
+			dropped++
+			continue
+		}
+		dataset.Append(u[k], i[k], r[k])
+	}
+	config := vocab.Config
+	m, err := NewSVD(dataset, &config)
+	if err != nil {
+		return nil, err
+	}
+	svd := m.(*SVD)
+	svd.GlobalMean = vocab.GlobalMean
+	if dropped > 0 && config.Verbose {
+		log.Printf("dropped %d ratings for items unknown to the server", dropped)
+	}
+	return &Worker{Model: svd, client: client, dropped: dropped}, nil
+}
+
+// Fit runs numEpochs synchronous epochs with the other workers, then pulls
+// the final item parameters so that Model can be used for prediction.
+func (w *Worker) Fit(numEpochs int) error {
+	m := w.Model
+	bi := *m.BI
+	for n := 0; n < numEpochs; n++ {
+		params, err := w.client.Pull()
+		if err != nil {
+			return err
+		}
+		copy(m.QI.Data, params.QI.Data)
+		copy(bi, params.BI)
+		m.Fit(1)
+		for k := range m.QI.Data {
+			params.QI.Data[k] = m.QI.Data[k] - params.QI.Data[k]
+		}
+		for k := range bi {
+			params.BI[k] = bi[k] - params.BI[k]
+		}
+		if _, err := w.client.Push(params); err != nil {
+			return err
+		}
+	}
+	params, err := w.client.Pull()
+	if err != nil {
+		return err
+	}
+	copy(m.QI.Data, params.QI.Data)
+	copy(bi, params.BI)
+	return nil
+}
+
+// Abort fails the run on the server for every worker, for a worker that
+// cannot go on, so that the others do not wait for it until the timeout.
+func (w *Worker) Abort(reason error) error {
+	return w.client.Abort(reason.Error())
+}
+
+// Dropped returns the number of ratings ignored because their item is not in
+// the server's vocabulary.
+func (w *Worker) Dropped() int {
+	return w.dropped
+}
@@ -0,0 +1,64 @@
+package train
+
+import (
+	"log"
+	"sync"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// defaultDSGDBlocks is the number of blocks per side DSGDSolver partitions
+// ratings into if NumWorkers is zero. It is fixed rather than the number of
+// CPUs so that the result does not depend on the machine.
+const defaultDSGDBlocks = 8
+
+// fitDSGD trains m for numEpochs of distributed SGD in the manner of
+// Gemulla et al. (2011). Users and items are each split into NumWorkers
+// blocks by their internal IDs, which cuts the ratings into a grid of
+// NumWorkers² blocks. A stratum is a set of blocks no two of which share a
+// row or column of the grid, so their ratings touch disjoint factors and
+// biases and can be trained on in parallel without locks or races. Every
+// epoch visits the NumWorkers strata in random order, training each block of
+// a stratum on its own goroutine in dataset order, so that the result only
+// depends on the seed and NumWorkers.
+func (m *SVD) fitDSGD(numEpochs int) {
+	numBlocks := m.Config.NumWorkers
+	if numBlocks <= 0 {
+		numBlocks = defaultDSGDBlocks
+	}
+	blocks := dsgdBlocks(m.Dataset, numBlocks)
+	rng := random.Or(m.src)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d\n", epoch)
+		}
+		timer := startEpoch(m.Config.Instrument)
+		for _, s := range rng.Perm(numBlocks) {
+			var wg sync.WaitGroup
+			for ub := 0; ub < numBlocks; ub++ {
+				wg.Add(1)
+				go func(block []int) {
+					defer wg.Done()
+					for _, idx := range block {
+						m.sgdStep(idx)
+					}
+				}(blocks[ub*numBlocks+(ub+s)%numBlocks])
+			}
+			wg.Wait()
+		}
+		timer.done("SVD-DSGD", epoch, len(m.Dataset.Ratings))
+	}
+}
+
+// dsgdBlocks returns the indices of the ratings of d in each block of a
+// numBlocks by numBlocks grid, the block of user block ub and item block ib
+// at ub*numBlocks+ib.
+func dsgdBlocks(d *data.Dataset, numBlocks int) [][]int {
+	blocks := make([][]int, numBlocks*numBlocks)
+	for idx := range d.Ratings {
+		b := d.Users[idx]%numBlocks*numBlocks + d.Items[idx]%numBlocks
+		blocks[b] = append(blocks[b], idx)
+	}
+	return blocks
+}
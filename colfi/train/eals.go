@@ -0,0 +1,228 @@
+package train
+
+import (
+	"log"
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// EALS is the element-wise ALS model of He et al. (2016) for implicit
+// feedback. Every rating in the dataset is treated as a positive interaction
+// and all other user-item pairs as missing data, weighted by item popularity
+// so that popular items that were not consumed count as stronger negatives.
+type EALS struct {
+	Dataset *data.Dataset
+	PU      *Factors
+	QI      *Factors
+	CI      []float64
+	RU      map[int][]int
+	RI      map[int][]int
+	Config  *EALSConfig
+}
+
+type EALSConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	Reg        float64
+	// W is the weight of an observed interaction.
+	W float64
+	// C0 is the total weight of the missing data, spread across items in
+	// proportion to popularity^Alpha.
+	C0    float64
+	Alpha float64
+	// Source, if set, draws the initial factors, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewEALS(dataset *data.Dataset, config *EALSConfig) (Model, error) {
+	if config == nil {
+		config = &EALSConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .01
+	}
+	if config.Reg == 0 {
+		config.Reg = .01
+	}
+	if config.W == 0 {
+		config.W = 1
+	}
+	if config.C0 == 0 {
+		config.C0 = 512
+	}
+	if config.Alpha == 0 {
+		config.Alpha = .5
+	}
+
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Verbose {
+		log.Println("caching user and item interactions")
+	}
+	ru := make(map[int][]int, len(dataset.UserMap))
+	ri := make(map[int][]int, len(dataset.ItemMap))
+	for idx := range dataset.Ratings {
+		ru[dataset.Users[idx]] = append(ru[dataset.Users[idx]], idx)
+		ri[dataset.Items[idx]] = append(ri[dataset.Items[idx]], idx)
+	}
+
+	ci := make([]float64, len(dataset.ItemMap))
+	var total float64
+	for i := range ci {
+		ci[i] = math.Pow(float64(len(ri[i])), config.Alpha)
+		total += ci[i]
+	}
+	for i := range ci {
+		ci[i] *= config.C0 / total
+	}
+
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	return &EALS{
+		Dataset: dataset,
+		PU:      randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.UserMap), config.NumFactors),
+		QI:      randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.ItemMap), config.NumFactors),
+		CI:      ci,
+		RU:      ru,
+		RI:      ri,
+		Config:  &saved,
+	}, nil
+}
+
+func (m *EALS) Fit(numEpochs int) {
+	numFactors := m.Config.NumFactors
+	reg := m.Config.Reg
+	w := m.Config.W
+	pu := m.PU
+	qi := m.QI
+	ci := m.CI
+
+	// pred caches the current prediction for every observed interaction so
+	// that each coordinate update only touches the affected entries.
+	pred := make([]float64, len(m.Dataset.Ratings))
+	for idx := range pred {
+		pred[idx] = dot(pu.Row(m.Dataset.Users[idx]), qi.Row(m.Dataset.Items[idx]))
+	}
+
+	if m.Config.Verbose {
+		log.Printf("using %s BLAS", blasBackend)
+	}
+	var sq, sp mat.Dense
+	scaled := mat.NewDense(len(ci), numFactors, nil)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+
+		// Sq = Σ_i c_i q_i q_iᵀ
+		for i, c := range ci {
+			row := scaled.RawRowView(i)
+			copy(row, qi.Row(i))
+			for f := range row {
+				row[f] *= math.Sqrt(c)
+			}
+		}
+		sq.Mul(scaled.T(), scaled)
+
+		for u, idxs := range m.RU {
+			pr := pu.Row(u)
+			for f := 0; f < numFactors; f++ {
+				var numer, denom float64
+				for _, idx := range idxs {
+					i := m.Dataset.Items[idx]
+					qif := qi.Row(i)[f]
+					predF := pred[idx] - pr[f]*qif
+					numer += (w - (w-ci[i])*predF) * qif
+					denom += (w - ci[i]) * qif * qif
+				}
+				for k := 0; k < numFactors; k++ {
+					if k != f {
+						numer -= pr[k] * sq.At(k, f)
+					}
+				}
+				denom += sq.At(f, f) + reg
+				puf := numer / denom
+				for _, idx := range idxs {
+					pred[idx] += (puf - pr[f]) * qi.Row(m.Dataset.Items[idx])[f]
+				}
+				pr[f] = puf
+			}
+		}
+
+		// Sp = Σ_u p_u p_uᵀ
+		pud := pu.dense()
+		sp.Mul(pud.T(), pud)
+
+		for i, idxs := range m.RI {
+			qr := qi.Row(i)
+			c := ci[i]
+			for f := 0; f < numFactors; f++ {
+				var numer, denom float64
+				for _, idx := range idxs {
+					puf := pu.Row(m.Dataset.Users[idx])[f]
+					predF := pred[idx] - puf*qr[f]
+					numer += (w - (w-c)*predF) * puf
+					denom += (w - c) * puf * puf
+				}
+				for k := 0; k < numFactors; k++ {
+					if k != f {
+						numer -= c * qr[k] * sp.At(k, f)
+					}
+				}
+				denom += c*sp.At(f, f) + reg
+				qif := numer / denom
+				for _, idx := range idxs {
+					pred[idx] += (qif - qr[f]) * pu.Row(m.Dataset.Users[idx])[f]
+				}
+				qr[f] = qif
+			}
+		}
+	}
+}
+
+func (m *EALS) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *EALS) PredictID(uid, iid int) float64 {
+	if uid < 0 || iid < 0 {
+		return 0
+	}
+	return dot(m.PU.Row(uid), m.QI.Row(iid))
+}
+
+func (m *EALS) userVector(uid int) []float64 {
+	return m.PU.Row(uid)
+}
+
+func (m *EALS) itemVectors() (*Factors, []float64) {
+	return m.QI, nil
+}
+
+func (m *EALS) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data)
+}
+
+func (m *EALS) Summary() string {
+	return summarize("EALS", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *EALS) GetDataset() *data.Dataset {
+	return m.Dataset
+}
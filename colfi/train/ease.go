@@ -0,0 +1,142 @@
+package train
+
+import (
+	"log"
+
+	"gonum.org/v1/gonum/mat"
+
+	"main/colfi/data"
+)
+
+// EASE is the shallow autoencoder EASE^R of Steck (2019) for top-N
+// recommendation from implicit feedback. Every rating is an interaction of
+// weight one, and the score of an item for a user is the sum of the weights
+// from the items they interacted with to it. The item-item weights minimize
+// the ridge-regularized error of reconstructing every user's interactions
+// with a zero diagonal, which has a closed form in the inverse of the Gram
+// matrix of the items. Fit needs memory and time quadratic and cubic in the
+// number of items, so EASE suits catalogs of up to a few tens of thousands
+// of items; the number of epochs is ignored.
+type EASE struct {
+	Dataset *data.Dataset
+	// B holds the weight from every item, a row, to every other, a column.
+	B      *Factors
+	Config *EASEConfig
+	// items lists the distinct items of every user.
+	items [][]int
+}
+
+type EASEConfig struct {
+	// Reg is the L2 regularization of the weights, typically in the
+	// hundreds.
+	Reg     float64
+	Verbose bool
+}
+
+func NewEASE(dataset *data.Dataset, config *EASEConfig) (Model, error) {
+	if config == nil {
+		config = &EASEConfig{}
+	}
+	if config.Reg == 0 {
+		config.Reg = 500
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	numItems := len(dataset.ItemMap)
+	m := &EASE{
+		Dataset: dataset,
+		B:       newFactors(numItems, numItems),
+		Config:  config,
+	}
+	m.restore()
+	return m, nil
+}
+
+func (m *EASE) restore() {
+	d := m.Dataset
+	m.items = make([][]int, len(d.UserMap))
+	for u, idxs := range data.GroupRatings(d.Users, len(d.UserMap)) {
+		seen := make(map[int]bool, len(idxs))
+		for _, idx := range idxs {
+			if i := d.Items[idx]; !seen[i] {
+				seen[i] = true
+				m.items[u] = append(m.items[u], i)
+			}
+		}
+	}
+}
+
+func (m *EASE) Fit(numEpochs int) {
+	numItems := m.B.Rows
+	if m.Config.Verbose {
+		log.Printf("inverting the %d x %d item Gram matrix using %s BLAS", numItems, numItems, blasBackend)
+	}
+	g := mat.NewSymDense(numItems, nil)
+	gd := g.RawSymmetric()
+	for _, items := range m.items {
+		for _, a := range items {
+			for _, b := range items {
+				// Only the upper triangle of a SymDense is stored.
+				if a <= b {
+					gd.Data[a*gd.Stride+b]++
+				}
+			}
+		}
+	}
+	for i := 0; i < numItems; i++ {
+		g.SetSym(i, i, g.At(i, i)+m.Config.Reg)
+	}
+	var chol mat.Cholesky
+	var p mat.SymDense
+	if !chol.Factorize(g) {
+		log.Printf("EASE: keeping previous weights, item Gram matrix is not positive definite")
+		return
+	}
+	if err := chol.InverseTo(&p); err != nil {
+		log.Printf("EASE: keeping previous weights, inverting item Gram matrix: %v", err)
+		return
+	}
+	for a := 0; a < numItems; a++ {
+		row := m.B.Row(a)
+		for b := range row {
+			if a != b {
+				row[b] = -p.At(a, b) / p.At(b, b)
+			} else {
+				row[b] = 0
+			}
+		}
+	}
+}
+
+func (m *EASE) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+// PredictID returns the reconstructed interaction of the user with the item,
+// a ranking score rather than a rating. Unknown users and items score zero.
+func (m *EASE) PredictID(uid, iid int) float64 {
+	if uid < 0 || iid < 0 {
+		return 0
+	}
+	var s float64
+	for _, j := range m.items[uid] {
+		s += m.B.Row(j)[iid]
+	}
+	return s
+}
+
+func (m *EASE) NumParams() int {
+	return len(m.B.Data)
+}
+
+func (m *EASE) Summary() string {
+	return summarize("EASE", m.Dataset, 0, m.NumParams(), *m.Config)
+}
+
+func (m *EASE) GetDataset() *data.Dataset {
+	return m.Dataset
+}
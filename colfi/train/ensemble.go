@@ -0,0 +1,237 @@
+package train
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+
+	"main/colfi/data"
+)
+
+// Ensemble blends the predictions of several models linearly. Weights are
+// fixed by the config, uniform by default, or learned by Blend with ridge
+// regression on a validation set, optionally separately for segments of
+// users grouped by how many training ratings they have.
+type Ensemble struct {
+	Models []Model
+	// Weights holds, per segment, an intercept followed by one weight per
+	// model.
+	Weights    [][]float64
+	Config     *EnsembleConfig
+	userCounts map[int]int
+}
+
+type EnsembleConfig struct {
+	Reg float64
+	// SegmentBounds splits users by training rating count, e.g. [10, 100]
+	// gives the segments <10, 10-99 and >=100. No bounds means one global
+	// blend.
+	SegmentBounds []int
+	// MinSegmentSize is the number of validation ratings a segment needs to
+	// get its own weights; smaller segments use the global blend.
+	MinSegmentSize int
+	// Weights, if set, fixes the weight of every model, in order, with no
+	// intercept, until Blend learns others.
+	Weights []float64
+	Verbose bool
+}
+
+func NewEnsemble(models []Model, config *EnsembleConfig) (Model, error) {
+	if config == nil {
+		config = &EnsembleConfig{}
+	}
+	if config.Reg == 0 {
+		config.Reg = .01
+	}
+	if config.MinSegmentSize == 0 {
+		config.MinSegmentSize = 100
+	}
+	if len(models) == 0 {
+		return nil, fmt.Errorf("ensemble needs at least one model")
+	}
+	for k, m := range models {
+		if m == nil {
+			return nil, fmt.Errorf("ensemble model %d is nil", k)
+		}
+	}
+	if config.Weights != nil && len(config.Weights) != len(models) {
+		return nil, fmt.Errorf("ensemble has %d models but %d weights", len(models), len(config.Weights))
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	sort.Ints(config.SegmentBounds)
+	fixed := make([]float64, len(models)+1)
+	for k := range models {
+		if config.Weights != nil {
+			fixed[k+1] = config.Weights[k]
+		} else {
+			fixed[k+1] = 1 / float64(len(models))
+		}
+	}
+	weights := make([][]float64, len(config.SegmentBounds)+1)
+	for s := range weights {
+		weights[s] = fixed
+	}
+	e := &Ensemble{
+		Models:  models,
+		Weights: weights,
+		Config:  config,
+	}
+	e.countUsers()
+	return e, nil
+}
+
+func (e *Ensemble) restore() {
+	for _, m := range e.Models {
+		m.GetDataset().Restore()
+		if rs, ok := m.(restorer); ok {
+			rs.restore()
+		}
+	}
+	e.countUsers()
+}
+
+func (e *Ensemble) countUsers() {
+	d := e.Models[0].GetDataset()
+	e.userCounts = make(map[int]int, len(d.UserMap))
+	for _, u := range d.Users {
+		e.userCounts[u]++
+	}
+}
+
+func (e *Ensemble) Fit(numEpochs int) {
+	for k, m := range e.Models {
+		if e.Config.Verbose {
+			log.Printf("fitting ensemble member %d / %d", k+1, len(e.Models))
+		}
+		m.Fit(numEpochs)
+	}
+}
+
+// Blend learns the blending weights from the member models' predictions on
+// the validation set, which should not overlap the data they were trained on.
+func (e *Ensemble) Blend(validation *data.Dataset) error {
+	n := len(validation.Ratings)
+	if n == 0 {
+		return fmt.Errorf("validation set is empty")
+	}
+	if err := data.CheckScales(e.Models[0].GetDataset(), validation); err != nil {
+		log.Printf("Blend: warning: %v", err)
+	}
+	cols := len(e.Models) + 1
+	x := mat.NewDense(n, cols, nil)
+	y := make([]float64, n)
+	segments := make([][]int, len(e.Weights))
+	for idx, r := range validation.Ratings {
+		u := validation.UserIDs[validation.Users[idx]]
+		i := validation.ItemIDs[validation.Items[idx]]
+		row := x.RawRowView(idx)
+		row[0] = 1
+		for k, m := range e.Models {
+			row[k+1] = m.Predict(u, i)
+		}
+		y[idx] = float64(r)
+		s := e.segment(u)
+		segments[s] = append(segments[s], idx)
+	}
+
+	global, err := ridge(x, y, e.Config.Reg)
+	if err != nil {
+		return err
+	}
+	for s, idxs := range segments {
+		e.Weights[s] = global
+		if len(e.Weights) == 1 || len(idxs) < e.Config.MinSegmentSize {
+			continue
+		}
+		xs := mat.NewDense(len(idxs), cols, nil)
+		ys := make([]float64, len(idxs))
+		for k, idx := range idxs {
+			xs.SetRow(k, x.RawRowView(idx))
+			ys[k] = y[idx]
+		}
+		w, err := ridge(xs, ys, e.Config.Reg)
+		if err != nil {
+			return err
+		}
+		e.Weights[s] = w
+	}
+	if e.Config.Verbose {
+		log.Printf("ensemble weights: %v", e.Weights)
+	}
+	return nil
+}
+
+func (e *Ensemble) segment(u string) int {
+	var count int
+	if uid, ok := e.Models[0].GetDataset().UserMap[u]; ok {
+		count = e.userCounts[uid]
+	}
+	return sort.SearchInts(e.Config.SegmentBounds, count+1)
+}
+
+func (e *Ensemble) Predict(u, i string) float64 {
+	w := e.Weights[e.segment(u)]
+	p := w[0]
+	for k, m := range e.Models {
+		p += w[k+1] * m.Predict(u, i)
+	}
+	return p
+}
+
+// NumParams counts the blending weights and the parameters of the members
+// that report theirs.
+func (e *Ensemble) NumParams() int {
+	var n int
+	for _, w := range e.Weights {
+		n += len(w)
+	}
+	for _, m := range e.Models {
+		if pc, ok := m.(interface{ NumParams() int }); ok {
+			n += pc.NumParams()
+		}
+	}
+	return n
+}
+
+// Summary describes the ensemble followed by one line per member.
+func (e *Ensemble) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Ensemble: %d models, %d segments, %d parameters (%.1f MiB), config %+v",
+		len(e.Models), len(e.Weights), e.NumParams(), float64(e.NumParams())*8/(1<<20), *e.Config)
+	for _, m := range e.Models {
+		b.WriteString("\n  ")
+		if sm, ok := m.(interface{ Summary() string }); ok {
+			b.WriteString(sm.Summary())
+		} else {
+			fmt.Fprintf(&b, "%T", m)
+		}
+	}
+	return b.String()
+}
+
+func (e *Ensemble) GetDataset() *data.Dataset {
+	return e.Models[0].GetDataset()
+}
+
+// ridge solves (XᵀX + λI)w = Xᵀy. The intercept in column 0 is not
+// regularized.
+func ridge(x *mat.Dense, y []float64, reg float64) ([]float64, error) {
+	_, cols := x.Dims()
+	var xtx mat.Dense
+	xtx.Mul(x.T(), x)
+	for c := 1; c < cols; c++ {
+		xtx.Set(c, c, xtx.At(c, c)+reg)
+	}
+	var xty mat.VecDense
+	xty.MulVec(x.T(), mat.NewVecDense(len(y), y))
+	var w mat.VecDense
+	if err := w.SolveVec(&xtx, &xty); err != nil {
+		return nil, fmt.Errorf("solving blend weights: %v", err)
+	}
+	return w.RawVector().Data, nil
+}
@@ -0,0 +1,168 @@
+package train
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// ExplorePolicy selects how RecommendExplore departs from the best list.
+type ExplorePolicy int
+
+const (
+	// EpsilonGreedy fills a share Epsilon of the slots with items drawn
+	// uniformly from those outside the best list.
+	EpsilonGreedy ExplorePolicy = iota
+	// Thompson ranks items by their score plus Gaussian noise of standard
+	// deviation StdDev/sqrt(1+n), n being their number of training ratings,
+	// so that items little is known about, such as new ones, are shown more
+	// often than their score alone would warrant.
+	Thompson
+)
+
+func (p ExplorePolicy) validate() error {
+	if p != EpsilonGreedy && p != Thompson {
+		return fmt.Errorf("unknown ExplorePolicy %d", p)
+	}
+	return nil
+}
+
+type ExploreConfig struct {
+	Policy ExplorePolicy
+	// Epsilon is the share of slots EpsilonGreedy explores with, .1 if
+	// zero. A positive share of a short list explores at least one slot.
+	Epsilon float64
+	// StdDev scales the noise of Thompson, .5 if zero.
+	StdDev float64
+	// Samples is the number of draws Thompson estimates propensities from,
+	// 100 if zero. Each costs a ranking of the catalog.
+	Samples int
+	// Source, if set, draws the explored items instead of the default
+	// source of SetRand. It is not safe for concurrent use, so a config with
+	// a Source must not be shared between concurrent requests.
+	Source rand.Source
+}
+
+// ExploredItem is an item of an exploration list together with the
+// probability that the policy would have included it, for inverse
+// propensity weighting of the feedback it gets. Explored marks items that
+// are not in the best list.
+type ExploredItem struct {
+	ScoredItem
+	Propensity float64
+	Explored   bool
+}
+
+// RecommendExplore is Recommend with exploration: n items for u under opts,
+// some of them chosen by config's policy instead of by score. Scores are the
+// model's, not the noisy ones Thompson ranks by. config may be nil.
+func RecommendExplore(ctx context.Context, m Model, u string, n int, opts *RecommendOptions, config *ExploreConfig) ([]ExploredItem, error) {
+	// Defaults go in a copy, as config may be shared between requests.
+	c := ExploreConfig{}
+	if config != nil {
+		c = *config
+	}
+	config = &c
+	if config.Epsilon == 0 {
+		config.Epsilon = .1
+	}
+	if config.StdDev == 0 {
+		config.StdDev = .5
+	}
+	if config.Samples == 0 {
+		config.Samples = 100
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	all, err := RecommendContext(ctx, m, u, 0, opts)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 || n > len(all) {
+		n = len(all)
+	}
+	rng := random.Or(config.Source)
+	if config.Policy == Thompson {
+		return thompson(m.GetDataset(), all, n, config, rng), nil
+	}
+	return epsilonGreedy(all, n, config.Epsilon, rng), nil
+}
+
+// epsilonGreedy keeps the best n-e items of ranked and adds e drawn from the
+// rest by rng, placing them at random positions.
+func epsilonGreedy(ranked []ScoredItem, n int, epsilon float64, rng *rand.Rand) []ExploredItem {
+	e := int(math.Round(epsilon * float64(n)))
+	if e == 0 && epsilon > 0 && n > 0 {
+		e = 1
+	}
+	greedy := n - e
+	pool := len(ranked) - greedy
+	list := make([]ExploredItem, 0, n)
+	for _, it := range ranked[:greedy] {
+		list = append(list, ExploredItem{ScoredItem: it, Propensity: 1})
+	}
+	for _, k := range rng.Perm(pool)[:e] {
+		it := ExploredItem{ScoredItem: ranked[greedy+k], Propensity: float64(e) / float64(pool), Explored: true}
+		at := rng.Intn(len(list) + 1)
+		list = append(list, ExploredItem{})
+		copy(list[at+1:], list[at:])
+		list[at] = it
+	}
+	return list
+}
+
+// thompson ranks ranked by noisy scores and estimates how often each chosen
+// item makes the top n over config.Samples further draws, all from rng.
+func thompson(d *data.Dataset, ranked []ScoredItem, n int, config *ExploreConfig, rng *rand.Rand) []ExploredItem {
+	counts := d.ItemCounts()
+	stdDevs := make([]float64, len(ranked))
+	for k, it := range ranked {
+		var c int
+		if iid, ok := d.ItemMap[it.Item]; ok {
+			c = counts[iid]
+		}
+		stdDevs[k] = config.StdDev / math.Sqrt(1+float64(c))
+	}
+	draw := func() []ScoredItem {
+		noisy := make([]ScoredItem, len(ranked))
+		for k, it := range ranked {
+			noisy[k] = ScoredItem{Item: it.Item, Score: it.Score + rng.NormFloat64()*stdDevs[k]}
+		}
+		return topN(noisy, n)
+	}
+	chosen := draw()
+	hits := make(map[string]int, n)
+	for _, it := range chosen {
+		hits[it.Item] = 0
+	}
+	for s := 0; s < config.Samples; s++ {
+		for _, it := range draw() {
+			if _, ok := hits[it.Item]; ok {
+				hits[it.Item]++
+			}
+		}
+	}
+	best := make(map[string]bool, n)
+	scores := make(map[string]float64, len(ranked))
+	for k, it := range ranked {
+		if k < n {
+			best[it.Item] = true
+		}
+		scores[it.Item] = it.Score
+	}
+	list := make([]ExploredItem, len(chosen))
+	for k, it := range chosen {
+		list[k] = ExploredItem{
+			ScoredItem: ScoredItem{it.Item, scores[it.Item]},
+			// Counting the draw that chose it keeps the estimate positive.
+			Propensity: float64(hits[it.Item]+1) / float64(config.Samples+1),
+			Explored:   !best[it.Item],
+		}
+	}
+	return list
+}
@@ -0,0 +1,65 @@
+package train
+
+import (
+	"math/rand"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Factors is a row-major matrix of latent vectors held in one flat slice.
+// Row i occupies Data[i*Stride : i*Stride+Cols], so training loops can walk a
+// row as a plain slice and let the compiler drop the bounds checks.
+type Factors struct {
+	Rows   int
+	Cols   int
+	Stride int
+	Data   []float64
+}
+
+func newFactors(r, c int) *Factors {
+	return &Factors{Rows: r, Cols: c, Stride: c, Data: make([]float64, r*c)}
+}
+
+func randFactors(rng *rand.Rand, mean, stdDev float64, r, c int) *Factors {
+	f := newFactors(r, c)
+	for k := range f.Data {
+		f.Data[k] = rng.NormFloat64()*stdDev + mean
+	}
+	return f
+}
+
+// addRow appends a row of values from draw, for a user or item that joined
+// after training.
+func (f *Factors) addRow(draw func() float64) {
+	for k := 0; k < f.Stride; k++ {
+		f.Data = append(f.Data, draw())
+	}
+	f.Rows++
+}
+
+// appendRow appends v, which holds Cols values, as a new row.
+func (f *Factors) appendRow(v []float64) {
+	f.Data = append(f.Data, v...)
+	f.Data = append(f.Data, make([]float64, f.Stride-f.Cols)...)
+	f.Rows++
+}
+
+func (f *Factors) Dims() (int, int) {
+	return f.Rows, f.Cols
+}
+
+// Row returns row i without copying. The slice is capped at the row length
+// so appending to it cannot overwrite the next row.
+func (f *Factors) Row(i int) []float64 {
+	start := i * f.Stride
+	return f.Data[start : start+f.Cols : start+f.Cols]
+}
+
+// dense returns a gonum view sharing the storage of f, for the solvers that
+// need matrix operations.
+func (f *Factors) dense() *mat.Dense {
+	var d mat.Dense
+	d.SetRawMatrix(blas64.General{Rows: f.Rows, Cols: f.Cols, Stride: f.Stride, Data: f.Data})
+	return &d
+}
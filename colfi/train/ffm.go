@@ -0,0 +1,213 @@
+package train
+
+import (
+	"log"
+	"math/rand"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+const (
+	ffmUserField = iota
+	ffmItemField
+	ffmNumFixedFields
+)
+
+// FFM is a field-aware factorization machine over the user, the item and the
+// contextual features attached to each rating. Every feature keeps a separate
+// latent vector per field it can interact with, so a context signal such as
+// the device can relate to items differently than it relates to users.
+//
+// Latent vectors live in flat tables laid out as [id][field][factor].
+type FFM struct {
+	Dataset    *data.Dataset
+	VU         []float64
+	VI         []float64
+	VC         []float64
+	BU         *[]float64
+	BI         *[]float64
+	BC         *[]float64
+	GlobalMean float64
+	NumFields  int
+	Config     *FFMConfig
+}
+
+type FFMConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	LR         float64
+	Reg        float64
+	// Source, if set, draws the initial factors, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+type ffmTerm struct {
+	vec   []float64
+	bias  *float64
+	field int
+	x     float64
+}
+
+func NewFFM(dataset *data.Dataset, config *FFMConfig) (Model, error) {
+	if config == nil {
+		config = &FFMConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 8
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .02
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	numFields := ffmNumFixedFields + len(dataset.FieldMap)
+	width := numFields * config.NumFactors
+	bu := make([]float64, len(dataset.UserMap))
+	bi := make([]float64, len(dataset.ItemMap))
+	bc := make([]float64, len(dataset.FeatureMap))
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	return &FFM{
+		Dataset:    dataset,
+		VU:         randSlice(rng, config.InitMean, config.InitStdDev, len(dataset.UserMap)*width),
+		VI:         randSlice(rng, config.InitMean, config.InitStdDev, len(dataset.ItemMap)*width),
+		VC:         randSlice(rng, config.InitMean, config.InitStdDev, len(dataset.FeatureMap)*width),
+		BU:         &bu,
+		BI:         &bi,
+		BC:         &bc,
+		GlobalMean: data.Mean32(dataset.Ratings),
+		NumFields:  numFields,
+		Config:     &saved,
+	}, nil
+}
+
+func (m *FFM) Fit(numEpochs int) {
+	numRatings := len(m.Dataset.Ratings)
+	k := m.Config.NumFactors
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	var terms []ffmTerm
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		for idx := 0; idx < numRatings; idx++ {
+			var ctx []data.FeatureValue
+			if m.Dataset.Context != nil {
+				ctx = m.Dataset.Context[idx]
+			}
+			terms = m.terms(terms[:0], m.Dataset.Users[idx], m.Dataset.Items[idx], ctx)
+			err := float64(m.Dataset.Ratings[idx]) - m.score(terms)
+
+			for _, t := range terms {
+				*t.bias += lr * (err*t.x - reg**t.bias)
+			}
+			for a := 0; a < len(terms); a++ {
+				for b := a + 1; b < len(terms); b++ {
+					ta, tb := terms[a], terms[b]
+					va := ta.vec[tb.field*k : (tb.field+1)*k]
+					vb := tb.vec[ta.field*k : (ta.field+1)*k]
+					g := err * ta.x * tb.x
+					for f := 0; f < k; f++ {
+						vaf := va[f]
+						vbf := vb[f]
+						va[f] += lr * (g*vbf - reg*vaf)
+						vb[f] += lr * (g*vaf - reg*vbf)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (m *FFM) terms(dst []ffmTerm, uid, iid int, ctx []data.FeatureValue) []ffmTerm {
+	width := m.NumFields * m.Config.NumFactors
+	if uid >= 0 {
+		dst = append(dst, ffmTerm{m.VU[uid*width : (uid+1)*width], &(*m.BU)[uid], ffmUserField, 1})
+	}
+	if iid >= 0 {
+		dst = append(dst, ffmTerm{m.VI[iid*width : (iid+1)*width], &(*m.BI)[iid], ffmItemField, 1})
+	}
+	for _, fv := range ctx {
+		field := ffmNumFixedFields + m.Dataset.Fields[fv.ID]
+		dst = append(dst, ffmTerm{m.VC[fv.ID*width : (fv.ID+1)*width], &(*m.BC)[fv.ID], field, float64(fv.Value)})
+	}
+	return dst
+}
+
+func (m *FFM) score(terms []ffmTerm) float64 {
+	k := m.Config.NumFactors
+	p := m.GlobalMean
+	for a, ta := range terms {
+		p += *ta.bias * ta.x
+		for _, tb := range terms[a+1:] {
+			p += dot(ta.vec[tb.field*k:(tb.field+1)*k], tb.vec[ta.field*k:(ta.field+1)*k]) * ta.x * tb.x
+		}
+	}
+	return p
+}
+
+func (m *FFM) Predict(u, i string) float64 {
+	return m.PredictContext(u, i, nil)
+}
+
+func (m *FFM) PredictID(uid, iid int) float64 {
+	return m.score(m.terms(nil, uid, iid, nil))
+}
+
+// PredictContext scores a user-item pair under the given context. Users,
+// items and features that were not seen during training are left out.
+func (m *FFM) PredictContext(u, i string, ctx []data.Feature) float64 {
+	uid, iid := m.Dataset.LookupIDs(u, i)
+	fvs := make([]data.FeatureValue, 0, len(ctx))
+	for _, f := range ctx {
+		if id, ok := m.Dataset.FeatureMap[f.Field+"="+f.Name]; ok {
+			fvs = append(fvs, data.FeatureValue{ID: id, Value: f.Value})
+		}
+	}
+	return m.score(m.terms(nil, uid, iid, fvs))
+}
+
+// restore replaces bias tables that gob drops when they are empty, which
+// happens for the context biases of a dataset without context.
+func (m *FFM) restore() {
+	for _, b := range []**[]float64{&m.BU, &m.BI, &m.BC} {
+		if *b == nil {
+			*b = &[]float64{}
+		}
+	}
+}
+
+func (m *FFM) NumParams() int {
+	return len(m.VU) + len(m.VI) + len(m.VC) + len(*m.BU) + len(*m.BI) + len(*m.BC) + 1
+}
+
+func (m *FFM) Summary() string {
+	return summarize("FFM", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *FFM) GetDataset() *data.Dataset {
+	return m.Dataset
+}
+
+func randSlice(rng *rand.Rand, mean, stdDev float64, n int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = rng.NormFloat64()*stdDev + mean
+	}
+	return s
+}
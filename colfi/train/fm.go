@@ -0,0 +1,188 @@
+package train
+
+import (
+	"log"
+	"math/rand"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// FM is a factorization machine (Rendle, 2010) over the user, the item and
+// the features attached to each rating with AppendContext, such as the
+// genre and year of the item or the country of the user. Every pair of
+// present features interacts through the dot product of their latent
+// vectors, computed in time linear in the number of features. Unlike FFM a
+// feature has a single latent vector, which needs far fewer parameters.
+type FM struct {
+	Dataset    *data.Dataset
+	VU         *Factors
+	VI         *Factors
+	VC         *Factors
+	BU         *[]float64
+	BI         *[]float64
+	BC         *[]float64
+	GlobalMean float64
+	Config     *FMConfig
+}
+
+type FMConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	LR         float64
+	Reg        float64
+	// Source, if set, draws the initial factors, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+type fmTerm struct {
+	vec  []float64
+	bias *float64
+	x    float64
+}
+
+func NewFM(dataset *data.Dataset, config *FMConfig) (Model, error) {
+	if config == nil {
+		config = &FMConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 8
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .02
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	bu := make([]float64, len(dataset.UserMap))
+	bi := make([]float64, len(dataset.ItemMap))
+	bc := make([]float64, len(dataset.FeatureMap))
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	return &FM{
+		Dataset:    dataset,
+		VU:         randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.UserMap), config.NumFactors),
+		VI:         randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.ItemMap), config.NumFactors),
+		VC:         randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.FeatureMap), config.NumFactors),
+		BU:         &bu,
+		BI:         &bi,
+		BC:         &bc,
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Config:     &saved,
+	}, nil
+}
+
+func (m *FM) Fit(numEpochs int) {
+	d := m.Dataset
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	sums := make([]float64, m.Config.NumFactors)
+	var terms []fmTerm
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		for idx, r := range d.Ratings {
+			var ctx []data.FeatureValue
+			if d.Context != nil {
+				ctx = d.Context[idx]
+			}
+			terms = m.terms(terms[:0], d.Users[idx], d.Items[idx], ctx)
+			err := float64(r) - m.score(terms, sums)
+			for _, t := range terms {
+				*t.bias += lr * (err*t.x - reg**t.bias)
+				for f, v := range t.vec {
+					g := err * t.x * (sums[f] - v*t.x)
+					t.vec[f] += lr * (g - reg*v)
+				}
+			}
+		}
+	}
+}
+
+func (m *FM) terms(dst []fmTerm, uid, iid int, ctx []data.FeatureValue) []fmTerm {
+	if uid >= 0 {
+		dst = append(dst, fmTerm{m.VU.Row(uid), &(*m.BU)[uid], 1})
+	}
+	if iid >= 0 {
+		dst = append(dst, fmTerm{m.VI.Row(iid), &(*m.BI)[iid], 1})
+	}
+	for _, fv := range ctx {
+		dst = append(dst, fmTerm{m.VC.Row(fv.ID), &(*m.BC)[fv.ID], float64(fv.Value)})
+	}
+	return dst
+}
+
+// score returns the prediction for terms, leaving in sums the sum of their
+// weighted latent vectors, which the gradients need.
+func (m *FM) score(terms []fmTerm, sums []float64) float64 {
+	p := m.GlobalMean
+	for f := range sums {
+		sums[f] = 0
+	}
+	var squares float64
+	for _, t := range terms {
+		p += *t.bias * t.x
+		for f, v := range t.vec {
+			sums[f] += v * t.x
+			squares += v * v * t.x * t.x
+		}
+	}
+	return p + (dot(sums, sums)-squares)/2
+}
+
+func (m *FM) Predict(u, i string) float64 {
+	return m.PredictContext(u, i, nil)
+}
+
+func (m *FM) PredictID(uid, iid int) float64 {
+	return m.score(m.terms(nil, uid, iid, nil), make([]float64, m.Config.NumFactors))
+}
+
+// PredictContext scores a user-item pair with the given features. Users,
+// items and features that were not seen during training are left out, so an
+// unknown item is still scored by its known features.
+func (m *FM) PredictContext(u, i string, ctx []data.Feature) float64 {
+	uid, iid := m.Dataset.LookupIDs(u, i)
+	fvs := make([]data.FeatureValue, 0, len(ctx))
+	for _, f := range ctx {
+		if id, ok := m.Dataset.FeatureMap[f.Field+"="+f.Name]; ok {
+			fvs = append(fvs, data.FeatureValue{ID: id, Value: f.Value})
+		}
+	}
+	return m.score(m.terms(nil, uid, iid, fvs), make([]float64, m.Config.NumFactors))
+}
+
+// restore replaces tables that gob drops when they are empty, which happens
+// for the features of a dataset without context.
+func (m *FM) restore() {
+	for _, b := range []**[]float64{&m.BU, &m.BI, &m.BC} {
+		if *b == nil {
+			*b = &[]float64{}
+		}
+	}
+}
+
+func (m *FM) NumParams() int {
+	return len(m.VU.Data) + len(m.VI.Data) + len(m.VC.Data) + len(*m.BU) + len(*m.BI) + len(*m.BC) + 1
+}
+
+func (m *FM) Summary() string {
+	return summarize("FM", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *FM) GetDataset() *data.Dataset {
+	return m.Dataset
+}
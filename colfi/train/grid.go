@@ -0,0 +1,70 @@
+package train
+
+import (
+	"gonum.org/v1/gonum/mat"
+)
+
+// ScoreGrid predicts every item in items for every user in users, with
+// users as rows, for offline analyses such as a heatmap of affinities. The
+// dot products come from a single matrix multiplication over the selected
+// factor rows. It supports the models NewCompact does and scores unknown
+// users and items as their Predict does.
+func ScoreGrid(m Model, users, items []string) (*mat.Dense, error) {
+	c, err := NewCompact(m)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 || len(items) == 0 {
+		return &mat.Dense{}, nil
+	}
+	d := m.GetDataset()
+	uids := lookupRows(d.UserMap, users)
+	iids := lookupRows(d.ItemMap, items)
+	pu := gatherRows(c.PU.Row, c.PU.Cols, uids)
+	qi := gatherRows(c.QI.Row, c.QI.Cols, iids)
+	grid := mat.NewDense(len(users), len(items), nil)
+	grid.Mul(pu, qi.T())
+	for r, uid := range uids {
+		base := c.GlobalMean
+		if uid >= 0 && c.BU != nil {
+			base += c.BU[uid]
+		}
+		row := grid.RawRowView(r)
+		for k, iid := range iids {
+			p := base + row[k]
+			if iid >= 0 && c.BI != nil {
+				p += c.BI[iid]
+			}
+			if c.Clip != nil {
+				p = c.Clip.Clip(p)
+			}
+			row[k] = p
+		}
+	}
+	return grid, nil
+}
+
+// lookupRows maps ids to their rows in index, -1 for unknown ones.
+func lookupRows(index map[string]int, ids []string) []int {
+	rows := make([]int, len(ids))
+	for k, id := range ids {
+		row, ok := index[id]
+		if !ok {
+			row = -1
+		}
+		rows[k] = row
+	}
+	return rows
+}
+
+// gatherRows copies the given rows of a factor matrix into a dense matrix,
+// leaving zeros for rows of -1.
+func gatherRows(row func(int) []float64, cols int, rows []int) *mat.Dense {
+	g := mat.NewDense(len(rows), cols, nil)
+	for k, r := range rows {
+		if r >= 0 {
+			copy(g.RawRowView(k), row(r))
+		}
+	}
+	return g
+}
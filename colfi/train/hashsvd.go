@@ -0,0 +1,214 @@
+package train
+
+import (
+	"hash/fnv"
+	"log"
+	"math/rand"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// HashedSVD is SVD with item IDs hashed into a fixed number of buckets, so
+// that the item factors take bounded memory however large the catalog. Each
+// item is hashed into two buckets and represented by the sum of their
+// vectors and biases, so two items only share a representation if they
+// collide in both, which makes collisions rare and cheap.
+type HashedSVD struct {
+	Dataset    *data.Dataset
+	PU         *Factors
+	QB         *Factors
+	BU         *[]float64
+	BB         *[]float64
+	GlobalMean float64
+	Bounds     data.Bounds
+	Config     *SVDConfig
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+	// buckets holds the two buckets of every item, derived from ItemIDs.
+	buckets [][2]int
+}
+
+func NewHashedSVD(dataset *data.Dataset, config *SVDConfig) (Model, error) {
+	if config == nil {
+		config = &SVDConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .02
+	}
+	if config.ItemBuckets == 0 {
+		// Small catalogs get enough buckets to keep collisions rare, large
+		// ones a table of about 400 MiB at the default NumFactors.
+		config.ItemBuckets = 4 * len(dataset.ItemMap)
+		if config.ItemBuckets > 1<<20 {
+			config.ItemBuckets = 1 << 20
+		}
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	bu := make([]float64, len(dataset.UserMap))
+	bb := make([]float64, config.ItemBuckets)
+	// Item vectors are the sum of two bucket vectors, so the buckets start
+	// at half the configured scale. Users are drawn first, as in SVD.
+	rng := random.Or(config.Source)
+	pu := config.randFactors(rng, len(dataset.UserMap))
+	qb := config.randFactors(rng, config.ItemBuckets)
+	for k := range qb.Data {
+		qb.Data[k] /= 2
+	}
+	saved := *config
+	saved.Source = nil
+	m := &HashedSVD{
+		Dataset:    dataset,
+		PU:         pu,
+		QB:         qb,
+		BU:         &bu,
+		BB:         &bb,
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Bounds:     config.ratingBounds(dataset),
+		Config:     &saved,
+		src:        config.Source,
+	}
+	m.restore()
+	if config.Verbose {
+		log.Printf("hashing %d items into %d buckets", len(dataset.ItemMap), config.ItemBuckets)
+	}
+	return m, nil
+}
+
+func (m *HashedSVD) restore() {
+	// Models saved before HashedSVD stored its rating scale have none.
+	if m.Bounds == (data.Bounds{}) {
+		m.Bounds = m.Dataset.RatingBounds()
+	}
+	m.buckets = make([][2]int, len(m.Dataset.ItemIDs))
+	for iid, i := range m.Dataset.ItemIDs {
+		m.buckets[iid] = itemBuckets(i, m.Config.ItemBuckets)
+	}
+}
+
+// itemBuckets hashes an item ID into two distinct buckets, or the same one
+// twice if there is only one.
+func itemBuckets(i string, n int) [2]int {
+	h := fnv.New64a()
+	h.Write([]byte(i))
+	sum := h.Sum64()
+	b1 := int(uint32(sum) % uint32(n))
+	b2 := int(uint32(sum>>32) % uint32(n))
+	if b1 == b2 && n > 1 {
+		b2 = (b1 + 1) % n
+	}
+	return [2]int{b1, b2}
+}
+
+func (m *HashedSVD) Fit(numEpochs int) {
+	numRatings := len(m.Dataset.Ratings)
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	pu := m.PU
+	qb := m.QB
+	bu := *m.BU
+	bb := *m.BB
+	globalMean := m.GlobalMean
+	numSamples := epochSamples(numRatings, m.Config.SampleRate)
+	rng := random.Or(m.src)
+	qi := make([]float64, m.Config.NumFactors)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d\n", epoch)
+		}
+		timer := startEpoch(m.Config.Instrument)
+		for n := 0; n < numSamples; n++ {
+			idx := sampleIndex(n, numRatings, numSamples, rng.Intn)
+			u := m.Dataset.Users[idx]
+			b := m.buckets[m.Dataset.Items[idx]]
+			r := float64(m.Dataset.Ratings[idx])
+			pr := pu.Row(u)
+			q1 := qb.Row(b[0])[:len(pr)]
+			q2 := qb.Row(b[1])[:len(pr)]
+			dot := float64(0)
+			for f := range pr {
+				qi[f] = q1[f] + q2[f]
+				dot += pr[f] * qi[f]
+			}
+			err := r - (globalMean + bu[u] + bb[b[0]] + bb[b[1]] + dot)
+			bu[u] += lr * (err - reg*bu[u])
+			bb[b[0]] += lr * (err - reg*bb[b[0]])
+			if b[1] != b[0] {
+				bb[b[1]] += lr * (err - reg*bb[b[1]])
+			}
+			for f := range pr {
+				puf := pr[f]
+				pr[f] = puf + lr*(err*qi[f]-reg*puf)
+				q1[f] += lr * (err*puf - reg*q1[f])
+				if b[1] != b[0] {
+					q2[f] += lr * (err*puf - reg*q2[f])
+				}
+			}
+		}
+		timer.done("HashedSVD", epoch, numSamples)
+	}
+}
+
+func (m *HashedSVD) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *HashedSVD) PredictID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		b := m.buckets[iid]
+		p += (*m.BB)[b[0]] + (*m.BB)[b[1]]
+		if uid >= 0 {
+			p += dot(m.PU.Row(uid), m.QB.Row(b[0])) + dot(m.PU.Row(uid), m.QB.Row(b[1]))
+		}
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+// biasesID is PredictID without the latent factors.
+func (m *HashedSVD) biasesID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		b := m.buckets[iid]
+		p += (*m.BB)[b[0]] + (*m.BB)[b[1]]
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+func (m *HashedSVD) NumParams() int {
+	return len(m.PU.Data) + len(m.QB.Data) + len(*m.BU) + len(*m.BB) + 1
+}
+
+func (m *HashedSVD) Summary() string {
+	return summarize("HashedSVD", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *HashedSVD) GetDataset() *data.Dataset {
+	return m.Dataset
+}
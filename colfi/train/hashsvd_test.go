@@ -0,0 +1,51 @@
+package train
+
+import (
+	"testing"
+
+	"main/colfi/data"
+)
+
+func TestHashedSVDClip(t *testing.T) {
+	d := testDataset(t)
+	// A scale narrower than the ratings makes some unclipped predictions
+	// fall outside it.
+	bounds := &data.Bounds{Min: 2, Max: 4, Step: 1}
+	fit := func(clip bool) *HashedSVD {
+		m, err := NewHashedSVD(d, &SVDConfig{NumFactors: 8, LR: .02, Bounds: bounds, Clip: clip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Fit(10)
+		return m.(*HashedSVD)
+	}
+	outside := func(p float64) bool { return p < bounds.Min || p > bounds.Max }
+
+	unclipped := fit(false)
+	var n int
+	for uid := range d.UserIDs {
+		for iid := range d.ItemIDs {
+			if outside(unclipped.PredictID(uid, iid)) {
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		t.Fatal("no unclipped prediction falls outside the scale, so clipping is not tested")
+	}
+
+	m := fit(true)
+	if m.Bounds != *bounds {
+		t.Errorf("Bounds: got %v, want %v", m.Bounds, *bounds)
+	}
+	for uid := -1; uid < len(d.UserIDs); uid++ {
+		for iid := -1; iid < len(d.ItemIDs); iid++ {
+			if p := m.PredictID(uid, iid); outside(p) {
+				t.Fatalf("PredictID(%d, %d) = %v, outside %v to %v", uid, iid, p, bounds.Min, bounds.Max)
+			}
+			if p := m.biasesID(uid, iid); outside(p) {
+				t.Fatalf("biasesID(%d, %d) = %v, outside %v to %v", uid, iid, p, bounds.Min, bounds.Max)
+			}
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package train
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// blasBackend names the BLAS/LAPACK implementation used by the matrix
+// operations in the ALS models. It is the pure Go one unless the package is
+// built with the netlib tag.
+var blasBackend = "gonum"
+
+type LinearSolver int
+
+const (
+	// CholeskySolver solves each least-squares subproblem exactly in O(f³).
+	CholeskySolver LinearSolver = iota
+	// ConjugateGradientSolver runs a few warm-started conjugate-gradient
+	// steps per subproblem in O(f²) each, which is considerably cheaper at
+	// high factor counts.
+	ConjugateGradientSolver
+)
+
+// ImplicitALS is the implicit-feedback matrix factorization of Hu, Koren and
+// Volinsky (2008), also known as WRMF, fitted by alternating least squares.
+// Every rating is a positive interaction with confidence 1 + Alpha*r, every
+// other user-item pair a negative with confidence 1. For event logs such as
+// plays or clicks, build the dataset with DatasetFromInteractions so that r
+// is the number of interactions of the pair.
+type ImplicitALS struct {
+	Dataset *data.Dataset
+	PU      *Factors
+	QI      *Factors
+	RU      map[int][]int
+	RI      map[int][]int
+	Config  *ImplicitALSConfig
+}
+
+type ImplicitALSConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	Reg        float64
+	Alpha      float64
+	Solver     LinearSolver
+	CGSteps    int
+	// Source, if set, draws the initial factors, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+// DatasetFromInteractions returns a dataset with one rating per distinct
+// user-item pair of the events u and i, equal to the number of times the
+// pair occurs, in order of first occurrence.
+func DatasetFromInteractions(u, i []string) (*data.Dataset, error) {
+	if len(u) != len(i) {
+		return nil, fmt.Errorf("u and i slices must be the same length")
+	}
+	type pair struct{ u, i string }
+	idx := make(map[pair]int)
+	d := data.NewDataset()
+	for k := range u {
+		p := pair{u[k], i[k]}
+		if at, ok := idx[p]; ok {
+			d.Ratings[at]++
+			continue
+		}
+		idx[p] = len(d.Ratings)
+		d.Append(p.u, p.i, 1)
+	}
+	return d, nil
+}
+
+func NewImplicitALS(dataset *data.Dataset, config *ImplicitALSConfig) (Model, error) {
+	if config == nil {
+		config = &ImplicitALSConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .01
+	}
+	if config.Reg == 0 {
+		config.Reg = .01
+	}
+	if config.Alpha == 0 {
+		config.Alpha = 40
+	}
+	if config.CGSteps == 0 {
+		config.CGSteps = 3
+	}
+
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Verbose {
+		log.Println("caching user and item interactions")
+	}
+	ru := make(map[int][]int, len(dataset.UserMap))
+	ri := make(map[int][]int, len(dataset.ItemMap))
+	for idx := range dataset.Ratings {
+		ru[dataset.Users[idx]] = append(ru[dataset.Users[idx]], idx)
+		ri[dataset.Items[idx]] = append(ri[dataset.Items[idx]], idx)
+	}
+
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	return &ImplicitALS{
+		Dataset: dataset,
+		PU:      randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.UserMap), config.NumFactors),
+		QI:      randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.ItemMap), config.NumFactors),
+		RU:      ru,
+		RI:      ri,
+		Config:  &saved,
+	}, nil
+}
+
+func (m *ImplicitALS) Fit(numEpochs int) {
+	if m.Config.Verbose {
+		log.Printf("using %s BLAS", blasBackend)
+	}
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		m.solveSide(m.PU, m.QI, m.RU, m.Dataset.Items)
+		m.solveSide(m.QI, m.PU, m.RI, m.Dataset.Users)
+	}
+}
+
+// solveSide recomputes every row of x holding y fixed. rows maps a row of x to
+// the indices of its interactions and other maps an interaction index to the
+// corresponding row of y.
+func (m *ImplicitALS) solveSide(x, y *Factors, rows map[int][]int, other []int) {
+	numFactors := m.Config.NumFactors
+	alpha := m.Config.Alpha
+	reg := m.Config.Reg
+
+	var yty mat.SymDense
+	yty.SymOuterK(1, y.dense().T())
+	for f := 0; f < numFactors; f++ {
+		yty.SetSym(f, f, yty.At(f, f)+reg)
+	}
+
+	a := mat.NewSymDense(numFactors, nil)
+	b := mat.NewVecDense(numFactors, nil)
+	var chol mat.Cholesky
+	var xv, yv mat.VecDense
+	s := newCGScratch(numFactors)
+	ytyFull := mat.DenseCopyOf(&yty)
+	for r, idxs := range rows {
+		xr := x.Row(r)
+		bd := b.RawVector().Data
+		for f := range bd {
+			bd[f] = 0
+		}
+		for _, idx := range idxs {
+			c := 1 + alpha*float64(m.Dataset.Ratings[idx])
+			for f, yf := range y.Row(other[idx]) {
+				bd[f] += c * yf
+			}
+		}
+		switch m.Config.Solver {
+		case ConjugateGradientSolver:
+			s.solve(xr, ytyFull, y, idxs, other, m.Dataset.Ratings, alpha, bd, m.Config.CGSteps)
+		default:
+			a.CopySym(&yty)
+			for _, idx := range idxs {
+				c := 1 + alpha*float64(m.Dataset.Ratings[idx])
+				yv.SetRawVector(blas64.Vector{N: numFactors, Inc: 1, Data: y.Row(other[idx])})
+				a.SymRankOne(a, c-1, &yv)
+			}
+			if !chol.Factorize(a) {
+				log.Printf("ALS: skipping row %d, system is not positive definite", r)
+				continue
+			}
+			xv.SetRawVector(blas64.Vector{N: numFactors, Inc: 1, Data: xr})
+			chol.SolveVecTo(&xv, b)
+		}
+	}
+}
+
+type cgScratch struct {
+	r, p, ap []float64
+}
+
+func newCGScratch(n int) *cgScratch {
+	return &cgScratch{
+		r:  make([]float64, n),
+		p:  make([]float64, n),
+		ap: make([]float64, n),
+	}
+}
+
+// solve runs steps iterations of conjugate gradient on
+// (YᵀY + λI + Σ (c-1) y yᵀ) x = b, starting from the current value of x.
+// The system matrix is never formed; products with it cost O(f² + |R|·f).
+func (s *cgScratch) solve(x []float64, yty *mat.Dense, y *Factors,
+	idxs, other []int, ratings []float32, alpha float64, b []float64, steps int) {
+	mulA := func(dst, v []float64) {
+		for f := range dst {
+			var sum float64
+			for k, a := range yty.RawRowView(f) {
+				sum += a * v[k]
+			}
+			dst[f] = sum
+		}
+		for _, idx := range idxs {
+			yr := y.Row(other[idx])
+			var dot float64
+			for f, yf := range yr {
+				dot += yf * v[f]
+			}
+			dot *= alpha * float64(ratings[idx])
+			for f, yf := range yr {
+				dst[f] += dot * yf
+			}
+		}
+	}
+
+	mulA(s.ap, x)
+	var rsold float64
+	for f := range x {
+		s.r[f] = b[f] - s.ap[f]
+		s.p[f] = s.r[f]
+		rsold += s.r[f] * s.r[f]
+	}
+	for step := 0; step < steps; step++ {
+		if rsold < 1e-20 {
+			return
+		}
+		mulA(s.ap, s.p)
+		var pap float64
+		for f := range s.p {
+			pap += s.p[f] * s.ap[f]
+		}
+		a := rsold / pap
+		var rsnew float64
+		for f := range x {
+			x[f] += a * s.p[f]
+			s.r[f] -= a * s.ap[f]
+			rsnew += s.r[f] * s.r[f]
+		}
+		for f := range s.p {
+			s.p[f] = s.r[f] + rsnew/rsold*s.p[f]
+		}
+		rsold = rsnew
+	}
+}
+
+func (m *ImplicitALS) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *ImplicitALS) PredictID(uid, iid int) float64 {
+	if uid < 0 || iid < 0 {
+		return 0
+	}
+	return dot(m.PU.Row(uid), m.QI.Row(iid))
+}
+
+func (m *ImplicitALS) userVector(uid int) []float64 {
+	return m.PU.Row(uid)
+}
+
+func (m *ImplicitALS) itemVectors() (*Factors, []float64) {
+	return m.QI, nil
+}
+
+func (m *ImplicitALS) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data)
+}
+
+func (m *ImplicitALS) Summary() string {
+	return summarize("ImplicitALS", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *ImplicitALS) GetDataset() *data.Dataset {
+	return m.Dataset
+}
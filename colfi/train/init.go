@@ -0,0 +1,97 @@
+package train
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"main/colfi/data"
+)
+
+// InitStrategy selects the distribution initial factors are drawn from.
+type InitStrategy int
+
+const (
+	// InitNormal draws from N(InitMean, InitStdDev).
+	InitNormal InitStrategy = iota
+	// InitUniform draws uniformly around InitMean with a standard deviation
+	// of InitStdDev.
+	InitUniform
+	// InitXavier and InitHe draw from a normal distribution around InitMean
+	// with a variance of 1 and 2 over NumFactors, ignoring InitStdDev, so
+	// that the scale of the initial predictions does not grow with the
+	// number of factors.
+	InitXavier
+	InitHe
+)
+
+// Shrinkage of the data-derived initial biases towards zero, as in Koren's
+// baseline estimates: an item needs around baselineItemReg ratings before
+// its mean deviation is trusted half way.
+const (
+	baselineItemReg = 25
+	baselineUserReg = 10
+)
+
+func (s InitStrategy) validate() error {
+	if s < InitNormal || s > InitHe {
+		return fmt.Errorf("unknown InitStrategy %d", s)
+	}
+	return nil
+}
+
+// sampler returns a function drawing one initial factor value.
+func (c *SVDConfig) sampler(rng *rand.Rand) func() float64 {
+	mean, stdDev := c.InitMean, c.InitStdDev
+	switch c.Init {
+	case InitUniform:
+		half := math.Sqrt(3) * stdDev
+		return func() float64 {
+			return mean + (2*rng.Float64()-1)*half
+		}
+	case InitXavier:
+		stdDev = math.Sqrt(1 / float64(c.NumFactors))
+	case InitHe:
+		stdDev = math.Sqrt(2 / float64(c.NumFactors))
+	}
+	return func() float64 {
+		return rng.NormFloat64()*stdDev + mean
+	}
+}
+
+// randFactors draws a rows x NumFactors matrix from rng with the configured
+// strategy.
+func (c *SVDConfig) randFactors(rng *rand.Rand, rows int) *Factors {
+	f := newFactors(rows, c.NumFactors)
+	draw := c.sampler(rng)
+	for k := range f.Data {
+		f.Data[k] = draw()
+	}
+	return f
+}
+
+// initBiases returns zero biases, or if config.InitBiases is set the
+// baselineBiases of d.
+func initBiases(d *data.Dataset, globalMean float64, config *SVDConfig) ([]float64, []float64) {
+	if !config.InitBiases {
+		return make([]float64, len(d.UserMap)), make([]float64, len(d.ItemMap))
+	}
+	return baselineBiases(d, globalMean)
+}
+
+// baselineBiases returns the shrunk mean deviations of every item from the
+// global mean and of every user from the global mean plus the item biases.
+func baselineBiases(d *data.Dataset, globalMean float64) ([]float64, []float64) {
+	bu := make([]float64, len(d.UserMap))
+	bi := make([]float64, len(d.ItemMap))
+	for i, n := range d.ItemCounts() {
+		bi[i] = (d.ItemMeanRating()[i] - globalMean) * float64(n) / float64(n+baselineItemReg)
+	}
+	for idx, r := range d.Ratings {
+		bu[d.Users[idx]] += float64(r) - globalMean - bi[d.Items[idx]]
+	}
+	for u, n := range d.UserCounts() {
+		bu[u] /= float64(n + baselineUserReg)
+	}
+	return bu, bi
+}
@@ -0,0 +1,86 @@
+package train
+
+import (
+	"expvar"
+	"log"
+	"runtime"
+	"time"
+)
+
+// trainingVars publishes the stats of the most recently completed
+// instrumented epoch under /debug/vars when the expvar handler is served.
+var trainingVars = expvar.NewMap("colfi_training")
+
+// EpochStats describes the work done in one training epoch. Allocs and
+// AllocBytes are process-wide, so they include any concurrent activity.
+type EpochStats struct {
+	Model      string
+	Epoch      int
+	Samples    int
+	Duration   time.Duration
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+func (s EpochStats) SamplesPerSec() float64 {
+	return float64(s.Samples) / s.Duration.Seconds()
+}
+
+type epochTimer struct {
+	enabled bool
+	start   time.Time
+	mem     runtime.MemStats
+}
+
+func startEpoch(enabled bool) *epochTimer {
+	t := &epochTimer{enabled: enabled}
+	if enabled {
+		runtime.ReadMemStats(&t.mem)
+		t.start = time.Now()
+	}
+	return t
+}
+
+// done logs and publishes the throughput and heap allocations of the epoch
+// started by startEpoch, if instrumentation is enabled.
+func (t *epochTimer) done(model string, epoch, samples int) {
+	if !t.enabled {
+		return
+	}
+	d := time.Since(t.start)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	s := EpochStats{
+		Model:      model,
+		Epoch:      epoch,
+		Samples:    samples,
+		Duration:   d,
+		Allocs:     mem.Mallocs - t.mem.Mallocs,
+		AllocBytes: mem.TotalAlloc - t.mem.TotalAlloc,
+	}
+	log.Printf("%s epoch %d: %d samples in %v (%.0f samples/s), %d allocs (%d bytes)",
+		s.Model, s.Epoch, s.Samples, s.Duration, s.SamplesPerSec(), s.Allocs, s.AllocBytes)
+	trainingVars.Set("model", stringVar(s.Model))
+	trainingVars.Set("epoch", intVar(int64(s.Epoch)))
+	trainingVars.Set("samples_per_sec", floatVar(s.SamplesPerSec()))
+	trainingVars.Set("allocs", intVar(int64(s.Allocs)))
+	trainingVars.Set("alloc_bytes", intVar(int64(s.AllocBytes)))
+}
+
+func stringVar(v string) *expvar.String {
+	s := new(expvar.String)
+	s.Set(v)
+	return s
+}
+
+func intVar(v int64) *expvar.Int {
+	i := new(expvar.Int)
+	i.Set(v)
+	return i
+}
+
+func floatVar(v float64) *expvar.Float {
+	f := new(expvar.Float)
+	f.Set(v)
+	return f
+}
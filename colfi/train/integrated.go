@@ -0,0 +1,330 @@
+package train
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// Integrated is the integrated model of Koren (2008), which adds an item
+// neighborhood term to SVD++ and trains both in one SGD loop. A prediction
+// is SVD++'s plus, over the user's ratings of the K items most similar to
+// the item, learned weights of their deviations from fixed baseline
+// estimates and learned offsets, each sum normalized by the square root of
+// its size. The neighborhood term captures strong local relations between
+// items that the low-rank factors smooth over. Neighbors are chosen by the
+// cosine similarity of baseline residuals, as KNNItemBaseline does, which
+// needs memory quadratic in the number of items during NewIntegrated.
+type Integrated struct {
+	Dataset *data.Dataset
+	PU      *Factors
+	QI      *Factors
+	YJ      *Factors
+	BU      *[]float64
+	BI      *[]float64
+	// Neighbors lists the items most similar to every item. Row i of W and
+	// C holds the weight and offset of each of them, in the same order.
+	Neighbors [][]int
+	W         *Factors
+	C         *Factors
+	// BaseU and BaseI are the fixed baseline biases neighbor deviations are
+	// measured from.
+	BaseU      []float64
+	BaseI      []float64
+	GlobalMean float64
+	Bounds     data.Bounds
+	Config     *IntegratedConfig
+	// rated lists the indices of the ratings of every user, residuals the
+	// deviation of every rating from its fixed baseline and slots the
+	// position of each neighbor of every item in its row of W and C.
+	rated     [][]int
+	residuals []float64
+	slots     []map[int]int
+}
+
+type IntegratedConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	// LR and Reg apply to the biases and factors, NeighborLR and
+	// NeighborReg to the neighbor weights and offsets.
+	LR          float64
+	Reg         float64
+	NeighborLR  float64
+	NeighborReg float64
+	// K is the number of neighbors of every item and MinSupport the number
+	// of common raters two items need to be neighbors.
+	K          int
+	MinSupport int
+	// NumWorkers is the number of goroutines similarities are computed on,
+	// runtime.NumCPU() if zero.
+	NumWorkers int
+	Clip       bool
+	// Source, if set, draws the initial factors, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewIntegrated(dataset *data.Dataset, config *IntegratedConfig) (Model, error) {
+	if config == nil {
+		config = &IntegratedConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .007
+	}
+	if config.Reg == 0 {
+		config.Reg = .015
+	}
+	if config.NeighborLR == 0 {
+		config.NeighborLR = .001
+	}
+	if config.NeighborReg == 0 {
+		config.NeighborReg = .015
+	}
+	if config.K == 0 {
+		config.K = 40
+	}
+	if config.MinSupport == 0 {
+		config.MinSupport = 5
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	numUsers, numItems := len(dataset.UserMap), len(dataset.ItemMap)
+	globalMean := data.Mean32(dataset.Ratings)
+	baseU, baseI := baselineBiases(dataset, globalMean)
+	bu := make([]float64, numUsers)
+	bi := make([]float64, numItems)
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	m := &Integrated{
+		Dataset:    dataset,
+		PU:         randFactors(rng, config.InitMean, config.InitStdDev, numUsers, config.NumFactors),
+		QI:         randFactors(rng, config.InitMean, config.InitStdDev, numItems, config.NumFactors),
+		YJ:         randFactors(rng, config.InitMean, config.InitStdDev, numItems, config.NumFactors),
+		BU:         &bu,
+		BI:         &bi,
+		W:          newFactors(numItems, config.K),
+		C:          newFactors(numItems, config.K),
+		BaseU:      baseU,
+		BaseI:      baseI,
+		GlobalMean: globalMean,
+		Bounds:     dataset.RatingBounds(),
+		Config:     &saved,
+	}
+	m.restore()
+	if config.Verbose {
+		log.Printf("computing similarities of %d items", numItems)
+	}
+	sim := newFactors(numItems, numItems)
+	byItem := data.GroupRatings(dataset.Items, numItems)
+	neighborSimilarities(sim, byItem, m.rated, dataset.Users, dataset.Items, m.residuals,
+		&KNNConfig{MinSupport: config.MinSupport, NumWorkers: config.NumWorkers})
+	m.Neighbors = make([][]int, numItems)
+	for i := range m.Neighbors {
+		m.Neighbors[i] = nearestNeighbors(sim.Row(i), config.K)
+	}
+	m.restore()
+	return m, nil
+}
+
+// nearestNeighbors returns the indices of the up to k largest positive
+// similarities in sims.
+func nearestNeighbors(sims []float64, k int) []int {
+	var nbrs []int
+	for j, s := range sims {
+		if s > 0 {
+			nbrs = append(nbrs, j)
+		}
+	}
+	sort.SliceStable(nbrs, func(a, b int) bool {
+		return sims[nbrs[a]] > sims[nbrs[b]]
+	})
+	if len(nbrs) > k {
+		nbrs = nbrs[:k]
+	}
+	return nbrs
+}
+
+func (m *Integrated) restore() {
+	d := m.Dataset
+	m.rated = data.GroupRatings(d.Users, len(d.UserMap))
+	m.residuals = make([]float64, len(d.Ratings))
+	for idx, r := range d.Ratings {
+		m.residuals[idx] = float64(r) - (m.GlobalMean + m.BaseU[d.Users[idx]] + m.BaseI[d.Items[idx]])
+	}
+	m.slots = make([]map[int]int, len(m.Neighbors))
+	for i, nbrs := range m.Neighbors {
+		m.slots[i] = make(map[int]int, len(nbrs))
+		for k, j := range nbrs {
+			m.slots[i][j] = k
+		}
+	}
+}
+
+// neighborhood appends to dst the rating indices of uid's ratings of the
+// neighbors of iid.
+func (m *Integrated) neighborhood(dst []int, uid, iid int) []int {
+	slots := m.slots[iid]
+	for _, idx := range m.rated[uid] {
+		if _, ok := slots[m.Dataset.Items[idx]]; ok {
+			dst = append(dst, idx)
+		}
+	}
+	return dst
+}
+
+func (m *Integrated) Fit(numEpochs int) {
+	d := m.Dataset
+	numFactors := m.Config.NumFactors
+	lr, reg := m.Config.LR, m.Config.Reg
+	nlr, nreg := m.Config.NeighborLR, m.Config.NeighborReg
+	bu, bi := *m.BU, *m.BI
+	implicit := make([]float64, numFactors)
+	var nbrs []int
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		for idx, r := range d.Ratings {
+			u, i := d.Users[idx], d.Items[idx]
+			m.implicitVector(implicit, u)
+			nbrs = m.neighborhood(nbrs[:0], u, i)
+			pr, qr := m.PU.Row(u), m.QI.Row(i)
+			p := m.GlobalMean + bu[u] + bi[i]
+			for f := range pr {
+				p += (pr[f] + implicit[f]) * qr[f]
+			}
+			p += m.neighborTerm(nbrs, i)
+			err := float64(r) - p
+
+			bu[u] += lr * (err - reg*bu[u])
+			bi[i] += lr * (err - reg*bi[i])
+			norm := 1 / math.Sqrt(float64(len(m.rated[u])))
+			for f := range pr {
+				puf, qif := pr[f], qr[f]
+				pr[f] += lr * (err*qif - reg*puf)
+				qr[f] += lr * (err*(puf+implicit[f]) - reg*qif)
+				// implicit is reused below as the gradient of the y_j.
+				implicit[f] = err * norm * qif
+			}
+			for _, jdx := range m.rated[u] {
+				yr := m.YJ.Row(d.Items[jdx])
+				for f := range yr {
+					yr[f] += lr * (implicit[f] - reg*yr[f])
+				}
+			}
+			if len(nbrs) > 0 {
+				nnorm := 1 / math.Sqrt(float64(len(nbrs)))
+				w, c, slots := m.W.Row(i), m.C.Row(i), m.slots[i]
+				for _, jdx := range nbrs {
+					k := slots[d.Items[jdx]]
+					w[k] += nlr * (err*nnorm*m.residuals[jdx] - nreg*w[k])
+					c[k] += nlr * (err*nnorm - nreg*c[k])
+				}
+			}
+		}
+	}
+}
+
+// implicitVector sets dst to the normalized sum of the y_j of the items uid
+// rated.
+func (m *Integrated) implicitVector(dst []float64, uid int) {
+	for f := range dst {
+		dst[f] = 0
+	}
+	for _, idx := range m.rated[uid] {
+		for f, y := range m.YJ.Row(m.Dataset.Items[idx]) {
+			dst[f] += y
+		}
+	}
+	if n := len(m.rated[uid]); n > 0 {
+		norm := 1 / math.Sqrt(float64(n))
+		for f := range dst {
+			dst[f] *= norm
+		}
+	}
+}
+
+// neighborTerm is the weighted sum of the deviations of the ratings nbrs,
+// of neighbors of iid, plus their offsets.
+func (m *Integrated) neighborTerm(nbrs []int, iid int) float64 {
+	if len(nbrs) == 0 {
+		return 0
+	}
+	w, c, slots := m.W.Row(iid), m.C.Row(iid), m.slots[iid]
+	var s float64
+	for _, idx := range nbrs {
+		k := slots[m.Dataset.Items[idx]]
+		s += m.residuals[idx]*w[k] + c[k]
+	}
+	return s / math.Sqrt(float64(len(nbrs)))
+}
+
+func (m *Integrated) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *Integrated) PredictID(uid, iid int) float64 {
+	p := m.biases(uid, iid)
+	if uid >= 0 && iid >= 0 {
+		implicit := make([]float64, m.Config.NumFactors)
+		m.implicitVector(implicit, uid)
+		pr := m.PU.Row(uid)
+		for f, q := range m.QI.Row(iid) {
+			p += (pr[f] + implicit[f]) * q
+		}
+		p += m.neighborTerm(m.neighborhood(nil, uid, iid), iid)
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+func (m *Integrated) biases(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		p += (*m.BI)[iid]
+	}
+	return p
+}
+
+// biasesID is PredictID without the latent factors and neighbors.
+func (m *Integrated) biasesID(uid, iid int) float64 {
+	p := m.biases(uid, iid)
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+func (m *Integrated) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data) + len(m.YJ.Data) + len(*m.BU) + len(*m.BI) +
+		len(m.W.Data) + len(m.C.Data) + 1
+}
+
+func (m *Integrated) Summary() string {
+	return summarize("Integrated", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *Integrated) GetDataset() *data.Dataset {
+	return m.Dataset
+}
@@ -0,0 +1,235 @@
+package train
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// Item2Vec learns item embeddings from the order in which each user
+// interacted with items (the order ratings were appended to the dataset),
+// using skip-gram with negative sampling. A user is scored against an item by
+// the similarity of the item to their most recent history, with older
+// interactions decayed geometrically, which suits next-item recommendation.
+type Item2Vec struct {
+	Dataset *data.Dataset
+	IV      *Factors
+	OV      *Factors
+	// Sequences holds the items of every user in the order they were
+	// rated, by internal user ID.
+	Sequences [][]int
+	Config    *Item2VecConfig
+	negTable  []float64
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+}
+
+type Item2VecConfig struct {
+	NumFactors   int
+	InitStdDev   float64
+	LR           float64
+	Window       int
+	NumNegatives int
+	// HistoryLen is the number of most recent items used to score a user and
+	// Decay the weight applied per step back in their history.
+	HistoryLen int
+	Decay      float64
+	// Source, if set, draws the initial embeddings and the sampled negatives,
+	// as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewItem2Vec(dataset *data.Dataset, config *Item2VecConfig) (Model, error) {
+	if config == nil {
+		config = &Item2VecConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 32
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .025
+	}
+	if config.Window == 0 {
+		config.Window = 5
+	}
+	if config.NumNegatives == 0 {
+		config.NumNegatives = 5
+	}
+	if config.HistoryLen == 0 {
+		config.HistoryLen = 10
+	}
+	if config.Decay == 0 {
+		config.Decay = .8
+	}
+
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	seqs := make([][]int, len(dataset.UserMap))
+	for idx, u := range dataset.Users {
+		seqs[u] = append(seqs[u], dataset.Items[idx])
+	}
+	saved := *config
+	saved.Source = nil
+	m := &Item2Vec{
+		Dataset:   dataset,
+		IV:        randFactors(random.Or(config.Source), 0, config.InitStdDev, len(dataset.ItemMap), config.NumFactors),
+		OV:        newFactors(len(dataset.ItemMap), config.NumFactors),
+		Sequences: seqs,
+		Config:    &saved,
+		src:       config.Source,
+	}
+	m.restore()
+	return m, nil
+}
+
+// restore builds the negative sampling table. Negatives are drawn from the
+// unigram distribution raised to 3/4, as in word2vec; negTable holds its
+// cumulative sums.
+func (m *Item2Vec) restore() {
+	counts := m.Dataset.ItemCounts()
+	m.negTable = make([]float64, len(counts))
+	var total float64
+	for i, c := range counts {
+		total += math.Pow(float64(c), .75)
+		m.negTable[i] = total
+	}
+}
+
+func (m *Item2Vec) Fit(numEpochs int) {
+	lr := m.Config.LR
+	window := m.Config.Window
+	grad := make([]float64, m.Config.NumFactors)
+	rng := random.Or(m.src)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		for _, seq := range m.Sequences {
+			for t, target := range seq {
+				lo, hi := t-window, t+window
+				if lo < 0 {
+					lo = 0
+				}
+				if hi >= len(seq) {
+					hi = len(seq) - 1
+				}
+				for c := lo; c <= hi; c++ {
+					if c == t || seq[c] == target {
+						continue
+					}
+					in := m.IV.Row(target)
+					for f := range grad {
+						grad[f] = 0
+					}
+					m.sgnsStep(in, seq[c], 1, lr, grad)
+					for n := 0; n < m.Config.NumNegatives; n++ {
+						neg := m.sampleNegative(rng)
+						if neg == seq[c] {
+							continue
+						}
+						m.sgnsStep(in, neg, 0, lr, grad)
+					}
+					for f := range in {
+						in[f] += grad[f]
+					}
+				}
+			}
+		}
+	}
+}
+
+func (m *Item2Vec) sgnsStep(in []float64, out int, label, lr float64, grad []float64) {
+	ov := m.OV.Row(out)
+	g := lr * (label - sigmoid(dot(in, ov)))
+	for f := range ov {
+		grad[f] += g * ov[f]
+		ov[f] += g * in[f]
+	}
+}
+
+func (m *Item2Vec) sampleNegative(rng *rand.Rand) int {
+	total := m.negTable[len(m.negTable)-1]
+	return sort.SearchFloat64s(m.negTable, rng.Float64()*total)
+}
+
+func (m *Item2Vec) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *Item2Vec) PredictID(uid, iid int) float64 {
+	if uid < 0 || iid < 0 {
+		return 0
+	}
+	return m.historyScore(m.Sequences[uid], iid)
+}
+
+// NextItems returns the n items most likely to follow the given history,
+// ordered from oldest to most recent. Items already in the history are
+// excluded.
+func (m *Item2Vec) NextItems(history []string, n int) []ScoredItem {
+	seq := make([]int, 0, len(history))
+	seen := make(map[int]bool, len(history))
+	for _, item := range history {
+		if iid, ok := m.Dataset.ItemMap[item]; ok {
+			seq = append(seq, iid)
+			seen[iid] = true
+		}
+	}
+	scores := make([]ScoredItem, 0, len(m.Dataset.ItemMap))
+	for iid, item := range m.Dataset.ItemIDs {
+		if seen[iid] {
+			continue
+		}
+		scores = append(scores, ScoredItem{item, m.historyScore(seq, iid)})
+	}
+	return topN(scores, n)
+}
+
+func (m *Item2Vec) historyScore(seq []int, iid int) float64 {
+	v := m.IV.Row(iid)
+	var s float64
+	w := 1.
+	for k := len(seq) - 1; k >= 0 && k >= len(seq)-m.Config.HistoryLen; k-- {
+		s += w * cosine(v, m.IV.Row(seq[k]))
+		w *= m.Config.Decay
+	}
+	return s
+}
+
+func (m *Item2Vec) NumParams() int {
+	return len(m.IV.Data) + len(m.OV.Data)
+}
+
+func (m *Item2Vec) Summary() string {
+	return summarize("Item2Vec", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *Item2Vec) GetDataset() *data.Dataset {
+	return m.Dataset
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func cosine(a, b []float64) float64 {
+	na := math.Sqrt(dot(a, a))
+	nb := math.Sqrt(dot(b, b))
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot(a, b) / (na * nb)
+}
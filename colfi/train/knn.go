@@ -0,0 +1,266 @@
+package train
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"main/colfi/data"
+)
+
+type KNNSimilarity int
+
+const (
+	// CosineSimilarity is the cosine of the angle between two rating vectors
+	// restricted to their common entries.
+	CosineSimilarity KNNSimilarity = iota
+	// PearsonSimilarity is the correlation of two rating vectors over their
+	// common entries, centered on the means of those entries.
+	PearsonSimilarity
+)
+
+func (s KNNSimilarity) validate() error {
+	if s < CosineSimilarity || s > PearsonSimilarity {
+		return fmt.Errorf("unknown KNNSimilarity %d", s)
+	}
+	return nil
+}
+
+// KNNUser is user-based collaborative filtering with mean centering, as
+// Surprise's KNNWithMeans: a user's rating of an item is their mean rating
+// plus the similarity-weighted mean deviation of the K most similar users who
+// rated it. Fit computes the similarity of every pair of users, so memory is
+// quadratic in the number of users; the number of epochs is ignored.
+type KNNUser struct {
+	Dataset *data.Dataset
+	// Sim holds the similarity of every pair of users.
+	Sim        *Factors
+	Means      []float64
+	GlobalMean float64
+	Config     *KNNConfig
+	// raters lists the indices of the ratings of every item and residuals
+	// the deviation of every rating from its user's mean.
+	raters    [][]int
+	residuals []float64
+}
+
+type KNNConfig struct {
+	// K is the number of neighbors a prediction is based on.
+	K int
+	// MinSupport is the number of common ratings below which two users, or
+	// two items for KNNItemBaseline, are not considered neighbors.
+	MinSupport int
+	Similarity KNNSimilarity
+	// NumWorkers is the number of goroutines similarities are computed on,
+	// runtime.NumCPU() if zero.
+	NumWorkers int
+	Verbose    bool
+}
+
+func NewKNNUser(dataset *data.Dataset, config *KNNConfig) (Model, error) {
+	if config == nil {
+		config = &KNNConfig{}
+	}
+	if config.K == 0 {
+		config.K = 40
+	}
+	if config.MinSupport == 0 {
+		config.MinSupport = 1
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	numUsers := len(dataset.UserMap)
+	m := &KNNUser{
+		Dataset:    dataset,
+		Sim:        newFactors(numUsers, numUsers),
+		Means:      rowMeans(dataset.Users, dataset.Ratings, numUsers),
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Config:     config,
+	}
+	m.restore()
+	return m, nil
+}
+
+func (m *KNNUser) restore() {
+	d := m.Dataset
+	m.raters = data.GroupRatings(d.Items, len(d.ItemMap))
+	m.residuals = make([]float64, len(d.Ratings))
+	for idx, r := range d.Ratings {
+		m.residuals[idx] = float64(r) - m.Means[d.Users[idx]]
+	}
+}
+
+func (m *KNNUser) Fit(numEpochs int) {
+	d := m.Dataset
+	if m.Config.Verbose {
+		log.Printf("computing similarities of %d users", len(d.UserMap))
+	}
+	byUser := data.GroupRatings(d.Users, len(d.UserMap))
+	values := make([]float64, len(d.Ratings))
+	for idx, r := range d.Ratings {
+		values[idx] = float64(r)
+	}
+	neighborSimilarities(m.Sim, byUser, m.raters, d.Items, d.Users, values, m.Config)
+}
+
+func (m *KNNUser) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *KNNUser) PredictID(uid, iid int) float64 {
+	switch {
+	case uid < 0 && iid < 0:
+		return m.GlobalMean
+	case uid < 0:
+		return m.Dataset.ItemMeanRating()[iid]
+	case iid < 0:
+		return m.Means[uid]
+	}
+	return m.Means[uid] + neighborDeviation(m.raters[iid], m.Dataset.Users, m.residuals, uid, m.Sim.Row(uid), m.Config.K)
+}
+
+func (m *KNNUser) NumParams() int {
+	return len(m.Sim.Data) + len(m.Means) + 1
+}
+
+func (m *KNNUser) Summary() string {
+	return summarize("KNNUser", m.Dataset, 0, m.NumParams(), *m.Config)
+}
+
+func (m *KNNUser) GetDataset() *data.Dataset {
+	return m.Dataset
+}
+
+// rowMeans returns the mean rating of every row, given the row of each
+// rating.
+func rowMeans(rowOf []int, ratings []float32, numRows int) []float64 {
+	means := make([]float64, numRows)
+	counts := make([]int, numRows)
+	for idx, r := range ratings {
+		means[rowOf[idx]] += float64(r)
+		counts[rowOf[idx]]++
+	}
+	for row, n := range counts {
+		if n > 0 {
+			means[row] /= float64(n)
+		}
+	}
+	return means
+}
+
+// neighborSimilarities fills sim with the similarity of every pair of rows
+// over the values of their common columns. byRow and byCol list the rating
+// indices of every row and column, and colOf and rowOf map a rating index to
+// its column and row. Pairs with fewer than config.MinSupport common ratings
+// get zero.
+func neighborSimilarities(sim *Factors, byRow, byCol [][]int, colOf, rowOf []int, values []float64, config *KNNConfig) {
+	numWorkers := config.NumWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	numRows := len(byRow)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			acc := make([]pairSums, numRows)
+			var touched []int
+			for a := w; a < numRows; a += numWorkers {
+				touched = touched[:0]
+				for _, idx := range byRow[a] {
+					x := values[idx]
+					for _, jdx := range byCol[colOf[idx]] {
+						b := rowOf[jdx]
+						if acc[b].n == 0 {
+							touched = append(touched, b)
+						}
+						acc[b].add(x, values[jdx])
+					}
+				}
+				row := sim.Row(a)
+				for b := range row {
+					row[b] = 0
+				}
+				for _, b := range touched {
+					if b != a && acc[b].n >= config.MinSupport {
+						row[b] = acc[b].similarity(config.Similarity)
+					}
+					acc[b] = pairSums{}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// pairSums accumulates the sufficient statistics of the common ratings x and
+// y of two rows.
+type pairSums struct {
+	n                     int
+	sx, sy, sxx, syy, sxy float64
+}
+
+func (s *pairSums) add(x, y float64) {
+	s.n++
+	s.sx += x
+	s.sy += y
+	s.sxx += x * x
+	s.syy += y * y
+	s.sxy += x * y
+}
+
+func (s *pairSums) similarity(kind KNNSimilarity) float64 {
+	var num, den float64
+	switch kind {
+	case PearsonSimilarity:
+		n := float64(s.n)
+		num = n*s.sxy - s.sx*s.sy
+		den = math.Sqrt((n*s.sxx - s.sx*s.sx) * (n*s.syy - s.sy*s.sy))
+	default:
+		num = s.sxy
+		den = math.Sqrt(s.sxx * s.syy)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+// neighborDeviation is the similarity-weighted mean of the residuals of the
+// ratings idxs by the k rows most similar to self, among those with a
+// positive similarity, or zero if there are none.
+func neighborDeviation(idxs, rowOf []int, residuals []float64, self int, sims []float64, k int) float64 {
+	type neighbor struct {
+		sim, dev float64
+	}
+	neighbors := make([]neighbor, 0, len(idxs))
+	for _, idx := range idxs {
+		row := rowOf[idx]
+		if s := sims[row]; row != self && s > 0 {
+			neighbors = append(neighbors, neighbor{s, residuals[idx]})
+		}
+	}
+	if len(neighbors) > k {
+		sort.Slice(neighbors, func(a, b int) bool {
+			return neighbors[a].sim > neighbors[b].sim
+		})
+		neighbors = neighbors[:k]
+	}
+	var num, den float64
+	for _, n := range neighbors {
+		num += n.sim * n.dev
+		den += n.sim
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
@@ -0,0 +1,144 @@
+package train
+
+import (
+	"log"
+	"sort"
+
+	"main/colfi/data"
+)
+
+// KNNItemBaseline is item-based collaborative filtering on top of baseline
+// estimates, as Surprise's KNNBaseline: a user's rating of an item is the
+// baseline μ + b_u + b_i plus the similarity-weighted mean residual of the
+// user's ratings of the K items most similar to it. Similarities are computed
+// on the residuals of the ratings from their baselines, which with
+// CosineSimilarity is Surprise's pearson_baseline without shrinkage. Fit
+// computes the similarity of every pair of items, so memory is quadratic in
+// the number of items; the number of epochs is ignored.
+type KNNItemBaseline struct {
+	Dataset *data.Dataset
+	// Sim holds the similarity of every pair of items.
+	Sim        *Factors
+	BU         []float64
+	BI         []float64
+	GlobalMean float64
+	Config     *KNNConfig
+	// rated lists the indices of the ratings of every user and residuals
+	// the deviation of every rating from its baseline.
+	rated     [][]int
+	residuals []float64
+}
+
+func NewKNNItemBaseline(dataset *data.Dataset, config *KNNConfig) (Model, error) {
+	if config == nil {
+		config = &KNNConfig{}
+	}
+	if config.K == 0 {
+		config.K = 40
+	}
+	if config.MinSupport == 0 {
+		config.MinSupport = 1
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	numItems := len(dataset.ItemMap)
+	globalMean := data.Mean32(dataset.Ratings)
+	bu, bi := baselineBiases(dataset, globalMean)
+	m := &KNNItemBaseline{
+		Dataset:    dataset,
+		Sim:        newFactors(numItems, numItems),
+		BU:         bu,
+		BI:         bi,
+		GlobalMean: globalMean,
+		Config:     config,
+	}
+	m.restore()
+	return m, nil
+}
+
+func (m *KNNItemBaseline) restore() {
+	d := m.Dataset
+	m.rated = data.GroupRatings(d.Users, len(d.UserMap))
+	m.residuals = make([]float64, len(d.Ratings))
+	for idx, r := range d.Ratings {
+		m.residuals[idx] = float64(r) - m.baseline(d.Users[idx], d.Items[idx])
+	}
+}
+
+func (m *KNNItemBaseline) Fit(numEpochs int) {
+	d := m.Dataset
+	if m.Config.Verbose {
+		log.Printf("computing similarities of %d items", len(d.ItemMap))
+	}
+	byItem := data.GroupRatings(d.Items, len(d.ItemMap))
+	neighborSimilarities(m.Sim, byItem, m.rated, d.Users, d.Items, m.residuals, m.Config)
+}
+
+func (m *KNNItemBaseline) baseline(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += m.BU[uid]
+	}
+	if iid >= 0 {
+		p += m.BI[iid]
+	}
+	return p
+}
+
+func (m *KNNItemBaseline) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *KNNItemBaseline) PredictID(uid, iid int) float64 {
+	p := m.baseline(uid, iid)
+	if uid >= 0 && iid >= 0 {
+		p += neighborDeviation(m.rated[uid], m.Dataset.Items, m.residuals, iid, m.Sim.Row(iid), m.Config.K)
+	}
+	return p
+}
+
+// biasesID is PredictID without the neighbors.
+func (m *KNNItemBaseline) biasesID(uid, iid int) float64 {
+	return m.baseline(uid, iid)
+}
+
+// Explain returns up to n of the items u rated that are most similar to i,
+// scored by their similarity, for explanations such as "because you liked
+// X". Items with no positive similarity are left out.
+func (m *KNNItemBaseline) Explain(u, i string, n int) []ScoredItem {
+	d := m.Dataset
+	uid, iid := d.LookupIDs(u, i)
+	if uid < 0 || iid < 0 {
+		return nil
+	}
+	sims := m.Sim.Row(iid)
+	var items []ScoredItem
+	for _, idx := range m.rated[uid] {
+		if j := d.Items[idx]; j != iid && sims[j] > 0 {
+			items = append(items, ScoredItem{d.ItemIDs[j], sims[j]})
+		}
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		return items[a].Score > items[b].Score
+	})
+	if n > 0 && n < len(items) {
+		items = items[:n]
+	}
+	return items
+}
+
+func (m *KNNItemBaseline) NumParams() int {
+	return len(m.Sim.Data) + len(m.BU) + len(m.BI) + 1
+}
+
+func (m *KNNItemBaseline) Summary() string {
+	return summarize("KNNItemBaseline", m.Dataset, 0, m.NumParams(), *m.Config)
+}
+
+func (m *KNNItemBaseline) GetDataset() *data.Dataset {
+	return m.Dataset
+}
@@ -0,0 +1,183 @@
+package train
+
+import (
+	"log"
+	"math"
+	"math/rand"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// LogisticMF factorizes binary feedback such as likes and dislikes: the
+// probability that user u likes item i is the sigmoid of a global bias, a
+// user bias, an item bias and the dot product of their factors, fitted by SGD
+// on the log loss. Predictions are probabilities between 0 and 1, so
+// evaluate it with log loss or on 0/1 ratings rather than on a star scale.
+type LogisticMF struct {
+	Dataset *data.Dataset
+	PU      *Factors
+	QI      *Factors
+	BU      *[]float64
+	BI      *[]float64
+	// Bias is the global log-odds of a like.
+	Bias float64
+	// Threshold is the rating above which a rating counts as a like.
+	Threshold float64
+	Config    *LogisticMFConfig
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+}
+
+type LogisticMFConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	LR         float64
+	Reg        float64
+	// Threshold separates likes, the ratings above it, from dislikes. If
+	// nil, it is the middle of the trainset's rating range, which suits 0/1
+	// and -1/+1 ratings alike.
+	Threshold *float64
+	// Source, if set, draws the initial factors and the order SGD visits
+	// ratings in, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewLogisticMF(dataset *data.Dataset, config *LogisticMFConfig) (Model, error) {
+	if config == nil {
+		config = &LogisticMFConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 20
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .05
+	}
+	if config.Reg == 0 {
+		config.Reg = .01
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	threshold := config.threshold(dataset)
+	var likes int
+	for _, r := range dataset.Ratings {
+		if float64(r) > threshold {
+			likes++
+		}
+	}
+	// Start from the log-odds of the share of likes, smoothed so that a
+	// trainset of only likes or dislikes stays finite.
+	share := (float64(likes) + .5) / (float64(len(dataset.Ratings)) + 1)
+	bu := make([]float64, len(dataset.UserMap))
+	bi := make([]float64, len(dataset.ItemMap))
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	return &LogisticMF{
+		Dataset:   dataset,
+		PU:        randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.UserMap), config.NumFactors),
+		QI:        randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.ItemMap), config.NumFactors),
+		BU:        &bu,
+		BI:        &bi,
+		Bias:      math.Log(share / (1 - share)),
+		Threshold: threshold,
+		Config:    &saved,
+		src:       config.Source,
+	}, nil
+}
+
+// threshold returns the configured threshold, or the middle of the rating
+// range of d if none is set.
+func (c *LogisticMFConfig) threshold(d *data.Dataset) float64 {
+	if c.Threshold != nil {
+		return *c.Threshold
+	}
+	b := d.RatingBounds()
+	return (b.Min + b.Max) / 2
+}
+
+func (m *LogisticMF) Fit(numEpochs int) {
+	d := m.Dataset
+	bu, bi := *m.BU, *m.BI
+	lr, reg := m.Config.LR, m.Config.Reg
+	rng := random.Or(m.src)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		var loss float64
+		for _, idx := range rng.Perm(len(d.Ratings)) {
+			u, i := d.Users[idx], d.Items[idx]
+			var y float64
+			if float64(d.Ratings[idx]) > m.Threshold {
+				y = 1
+			}
+			p := m.PredictID(u, i)
+			loss -= y*math.Log(p+1e-12) + (1-y)*math.Log(1-p+1e-12)
+			// The gradient of the log loss with respect to the log-odds.
+			g := y - p
+			m.Bias += lr * g
+			bu[u] += lr * (g - reg*bu[u])
+			bi[i] += lr * (g - reg*bi[i])
+			pu, qi := m.PU.Row(u), m.QI.Row(i)
+			for f, puf := range pu {
+				qif := qi[f]
+				pu[f] += lr * (g*qif - reg*puf)
+				qi[f] += lr * (g*puf - reg*qif)
+			}
+		}
+		if m.Config.Verbose {
+			log.Printf("log loss %.4f", loss/float64(len(d.Ratings)))
+		}
+	}
+}
+
+func (m *LogisticMF) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+// PredictID returns the probability that the user likes the item.
+func (m *LogisticMF) PredictID(uid, iid int) float64 {
+	z := m.Bias
+	if uid >= 0 {
+		z += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		z += (*m.BI)[iid]
+	}
+	if uid >= 0 && iid >= 0 {
+		z += dot(m.PU.Row(uid), m.QI.Row(iid))
+	}
+	return 1 / (1 + math.Exp(-z))
+}
+
+func (m *LogisticMF) userVector(uid int) []float64 {
+	return m.PU.Row(uid)
+}
+
+// itemVectors ranks items by log-odds, which the sigmoid preserves the order
+// of.
+func (m *LogisticMF) itemVectors() (*Factors, []float64) {
+	return m.QI, *m.BI
+}
+
+func (m *LogisticMF) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data) + len(*m.BU) + len(*m.BI) + 1
+}
+
+func (m *LogisticMF) Summary() string {
+	return summarize("LogisticMF", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *LogisticMF) GetDataset() *data.Dataset {
+	return m.Dataset
+}
@@ -0,0 +1,23 @@
+package train
+
+const (
+	// idEntryBytes approximates the cost of one user or item ID: its entry in
+	// UserMap/ItemMap including bucket overhead, its slot in UserIDs/ItemIDs
+	// and the string data itself for IDs of around 16 bytes.
+	idEntryBytes = 96
+	// ratingBytes is the user index, item index and rating held per rating.
+	ratingBytes = 8 + 8 + 4
+)
+
+// EstimateMemory returns the approximate number of bytes needed to hold a
+// dataset of the given size and an SVD model with the given number of
+// factors trained on it. SVD++ additionally needs its implicit factors and
+// per-user item lists, which roughly doubles the item factors and adds a
+// further 8 bytes per rating. The estimate excludes the raw input slices and
+// any test set, which should be accounted for separately.
+func EstimateMemory(nUsers, nItems, nRatings, factors int) int64 {
+	n := int64(nUsers + nItems)
+	dataset := n*idEntryBytes + int64(nRatings)*ratingBytes
+	model := n * int64(factors+1) * 8
+	return dataset + model
+}
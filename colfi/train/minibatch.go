@@ -0,0 +1,101 @@
+package train
+
+import (
+	"log"
+
+	"main/colfi/internal/random"
+)
+
+// fitMiniBatch trains m for numEpochs of mini-batch SGD: the gradients of
+// BatchSize ratings are computed against the same parameters and summed
+// before a single update. Summing rather than averaging keeps LR comparable
+// with plain SGD, which a batch size of one reduces to.
+func (m *SVD) fitMiniBatch(numEpochs int) {
+	d := m.Dataset
+	numRatings := len(d.Ratings)
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	pu, qi := m.PU, m.QI
+	bu, bi := *m.BU, *m.BI
+	numSamples := epochSamples(numRatings, m.Config.SampleRate)
+	rng := random.Or(m.src)
+	batchSize := m.Config.BatchSize
+	users := newGradients(pu.Rows, pu.Cols)
+	items := newGradients(qi.Rows, pu.Cols)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d\n", epoch)
+		}
+		timer := startEpoch(m.Config.Instrument)
+		for start := 0; start < numSamples; start += batchSize {
+			end := start + batchSize
+			if end > numSamples {
+				end = numSamples
+			}
+			for n := start; n < end; n++ {
+				idx := sampleIndex(n, numRatings, numSamples, rng.Intn)
+				u, i := d.Users[idx], d.Items[idx]
+				pr := pu.Row(u)
+				qr := qi.Row(i)[:len(pr)]
+				err := float64(d.Ratings[idx]) - (m.GlobalMean + bu[u] + bi[i] + dot(pr, qr))
+				gbu, gpr := users.row(u)
+				gbi, gqr := items.row(i)
+				*gbu += err - reg*bu[u]
+				*gbi += err - reg*bi[i]
+				for f := range pr {
+					gpr[f] += err*qr[f] - reg*pr[f]
+					gqr[f] += err*pr[f] - reg*qr[f]
+				}
+			}
+			users.apply(pu, bu, lr, m.Config.NonNegative)
+			items.apply(qi, bi, lr, m.Config.NonNegative)
+		}
+		timer.done("SVD", epoch, numSamples)
+	}
+}
+
+// gradients accumulates the bias and factor gradients of the rows touched
+// by a mini-batch.
+type gradients struct {
+	bias    []float64
+	factors *Factors
+	touched []int
+	seen    []bool
+}
+
+func newGradients(rows, cols int) *gradients {
+	return &gradients{
+		bias:    make([]float64, rows),
+		factors: newFactors(rows, cols),
+		seen:    make([]bool, rows),
+	}
+}
+
+// row returns the bias and factor gradients of row r, marking it touched.
+func (g *gradients) row(r int) (*float64, []float64) {
+	if !g.seen[r] {
+		g.seen[r] = true
+		g.touched = append(g.touched, r)
+	}
+	return &g.bias[r], g.factors.Row(r)
+}
+
+// apply takes a step of size lr along the accumulated gradients of every
+// touched row of p and b and clears them, clamping the factors at zero if
+// nonNegative is set.
+func (g *gradients) apply(p *Factors, b []float64, lr float64, nonNegative bool) {
+	for _, r := range g.touched {
+		b[r] += lr * g.bias[r]
+		g.bias[r] = 0
+		pr, gr := p.Row(r), g.factors.Row(r)
+		for f := range gr {
+			pr[f] += lr * gr[f]
+			gr[f] = 0
+		}
+		if nonNegative {
+			clampNegative(pr)
+		}
+		g.seen[r] = false
+	}
+	g.touched = g.touched[:0]
+}
@@ -0,0 +1,197 @@
+package train
+
+import (
+	"log"
+	"math"
+	"math/rand"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// NCF is the MLP variant of neural collaborative filtering (He et al.,
+// 2017): the user and item embeddings are concatenated and passed through
+// fully connected ReLU layers to a linear output added to the global mean.
+// The network can learn interactions a dot product cannot express, at the
+// cost of slower training and more tuning. Users and items that were not
+// seen in training get an all-zero embedding.
+type NCF struct {
+	Dataset *data.Dataset
+	PU      *Factors
+	QI      *Factors
+	// Weights and Biases hold one entry per hidden layer and a last one for
+	// the output. Each matrix of Weights has a row per output unit and a
+	// column per input.
+	Weights    []*Factors
+	Biases     [][]float64
+	GlobalMean float64
+	Config     *NCFConfig
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+}
+
+type NCFConfig struct {
+	NumFactors int
+	// Layers lists the widths of the hidden layers, [16 8] if empty.
+	Layers     []int
+	InitMean   float64
+	InitStdDev float64
+	LR         float64
+	Reg        float64
+	// Source, if set, draws the initial embeddings and weights and the
+	// order SGD visits ratings in, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewNCF(dataset *data.Dataset, config *NCFConfig) (Model, error) {
+	if config == nil {
+		config = &NCFConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 8
+	}
+	if len(config.Layers) == 0 {
+		config.Layers = []int{16, 8}
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .001
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	m := &NCF{
+		Dataset:    dataset,
+		PU:         randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.UserMap), config.NumFactors),
+		QI:         randFactors(rng, config.InitMean, config.InitStdDev, len(dataset.ItemMap), config.NumFactors),
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Config:     &saved,
+		src:        config.Source,
+	}
+	in := 2 * config.NumFactors
+	for _, out := range append(append([]int{}, config.Layers...), 1) {
+		// He initialization keeps the scale of activations through ReLUs.
+		m.Weights = append(m.Weights, randFactors(rng, 0, math.Sqrt(2/float64(in)), out, in))
+		m.Biases = append(m.Biases, make([]float64, out))
+		in = out
+	}
+	return m, nil
+}
+
+// newActivations returns buffers for the input and the output of every
+// layer.
+func (m *NCF) newActivations() [][]float64 {
+	acts := [][]float64{make([]float64, 2*m.Config.NumFactors)}
+	for _, b := range m.Biases {
+		acts = append(acts, make([]float64, len(b)))
+	}
+	return acts
+}
+
+// forward fills acts with the activations for the pair and returns the
+// prediction.
+func (m *NCF) forward(acts [][]float64, uid, iid int) float64 {
+	k := m.Config.NumFactors
+	x := acts[0]
+	for f := range x {
+		x[f] = 0
+	}
+	if uid >= 0 {
+		copy(x[:k], m.PU.Row(uid))
+	}
+	if iid >= 0 {
+		copy(x[k:], m.QI.Row(iid))
+	}
+	last := len(m.Weights) - 1
+	for l, w := range m.Weights {
+		out := acts[l+1]
+		for o := range out {
+			v := m.Biases[l][o] + dot(w.Row(o), acts[l])
+			if l < last && v < 0 {
+				v = 0
+			}
+			out[o] = v
+		}
+	}
+	return m.GlobalMean + acts[last+1][0]
+}
+
+func (m *NCF) Fit(numEpochs int) {
+	d := m.Dataset
+	k := m.Config.NumFactors
+	lr, reg := m.Config.LR, m.Config.Reg
+	acts := m.newActivations()
+	// grads[l] holds the gradient of the loss with respect to acts[l].
+	grads := m.newActivations()
+	rng := random.Or(m.src)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		for _, idx := range rng.Perm(len(d.Ratings)) {
+			u, i := d.Users[idx], d.Items[idx]
+			err := float64(d.Ratings[idx]) - m.forward(acts, u, i)
+			last := len(m.Weights) - 1
+			grads[last+1][0] = err
+			for l := last; l >= 0; l-- {
+				w, g, in := m.Weights[l], grads[l+1], acts[l]
+				prev := grads[l]
+				for f := range prev {
+					prev[f] = 0
+				}
+				for o, grad := range g {
+					if l < last && acts[l+1][o] <= 0 {
+						continue
+					}
+					row := w.Row(o)
+					for f, v := range row {
+						prev[f] += grad * v
+						row[f] += lr * (grad*in[f] - reg*v)
+					}
+					m.Biases[l][o] += lr * grad
+				}
+			}
+			pu, qi := m.PU.Row(u), m.QI.Row(i)
+			for f := 0; f < k; f++ {
+				pu[f] += lr * (grads[0][f] - reg*pu[f])
+				qi[f] += lr * (grads[0][k+f] - reg*qi[f])
+			}
+		}
+	}
+}
+
+func (m *NCF) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *NCF) PredictID(uid, iid int) float64 {
+	return m.forward(m.newActivations(), uid, iid)
+}
+
+func (m *NCF) NumParams() int {
+	n := len(m.PU.Data) + len(m.QI.Data) + 1
+	for l, w := range m.Weights {
+		n += len(w.Data) + len(m.Biases[l])
+	}
+	return n
+}
+
+func (m *NCF) Summary() string {
+	return summarize("NCF", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *NCF) GetDataset() *data.Dataset {
+	return m.Dataset
+}
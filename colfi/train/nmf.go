@@ -0,0 +1,169 @@
+package train
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// NMF is non-negative matrix factorization for explicit ratings, trained
+// with the regularized multiplicative updates of Luo et al. (2014) as in
+// Surprise. Factors start non-negative and updates only ever scale them, so
+// they stay non-negative and each can be read as the strength of a theme.
+// There are no biases; predictions for unknown users or items fall back to
+// the global mean.
+type NMF struct {
+	Dataset    *data.Dataset
+	PU         *Factors
+	QI         *Factors
+	GlobalMean float64
+	Config     *NMFConfig
+}
+
+type NMFConfig struct {
+	NumFactors int
+	// Initial factors are drawn uniformly from [InitLow, InitHigh).
+	InitLow  float64
+	InitHigh float64
+	// RegU and RegI are the regularization of the user and item factors,
+	// scaled by the number of ratings of each user and item.
+	RegU float64
+	RegI float64
+	// Source, if set, draws the initial factors, as SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewNMF(dataset *data.Dataset, config *NMFConfig) (Model, error) {
+	if config == nil {
+		config = &NMFConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 15
+	}
+	if config.InitHigh == 0 {
+		config.InitHigh = 1
+	}
+	if config.RegU == 0 {
+		config.RegU = .06
+	}
+	if config.RegI == 0 {
+		config.RegI = .06
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	for idx, r := range dataset.Ratings {
+		if r < 0 {
+			return nil, fmt.Errorf("NMF needs non-negative ratings, rating %d is %v", idx, r)
+		}
+	}
+	rng := random.Or(config.Source)
+	draw := func() float64 {
+		return config.InitLow + rng.Float64()*(config.InitHigh-config.InitLow)
+	}
+	pu := newFactors(len(dataset.UserMap), config.NumFactors)
+	for k := range pu.Data {
+		pu.Data[k] = draw()
+	}
+	qi := newFactors(len(dataset.ItemMap), config.NumFactors)
+	for k := range qi.Data {
+		qi.Data[k] = draw()
+	}
+	saved := *config
+	saved.Source = nil
+	return &NMF{
+		Dataset:    dataset,
+		PU:         pu,
+		QI:         qi,
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Config:     &saved,
+	}, nil
+}
+
+func (m *NMF) Fit(numEpochs int) {
+	d := m.Dataset
+	pu, qi := m.PU, m.QI
+	userNum := newFactors(pu.Rows, pu.Cols)
+	userDenom := newFactors(pu.Rows, pu.Cols)
+	itemNum := newFactors(qi.Rows, qi.Cols)
+	itemDenom := newFactors(qi.Rows, qi.Cols)
+	userCounts, itemCounts := d.UserCounts(), d.ItemCounts()
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		for _, f := range []*Factors{userNum, userDenom, itemNum, itemDenom} {
+			for k := range f.Data {
+				f.Data[k] = 0
+			}
+		}
+		for idx, r := range d.Ratings {
+			u, i := d.Users[idx], d.Items[idx]
+			pr, qr := pu.Row(u), qi.Row(i)
+			est := dot(pr, qr)
+			un, ud := userNum.Row(u), userDenom.Row(u)
+			in, id := itemNum.Row(i), itemDenom.Row(i)
+			for f := range pr {
+				un[f] += qr[f] * float64(r)
+				ud[f] += qr[f] * est
+				in[f] += pr[f] * float64(r)
+				id[f] += pr[f] * est
+			}
+		}
+		multiplicativeUpdate(pu, userNum, userDenom, userCounts, m.Config.RegU)
+		multiplicativeUpdate(qi, itemNum, itemDenom, itemCounts, m.Config.RegI)
+	}
+}
+
+// multiplicativeUpdate scales every factor by its numerator over its
+// regularized denominator, leaving factors with a zero denominator as they
+// are.
+func multiplicativeUpdate(p, num, denom *Factors, counts []int, reg float64) {
+	for row := 0; row < p.Rows; row++ {
+		pr, nr, dr := p.Row(row), num.Row(row), denom.Row(row)
+		for f := range pr {
+			den := dr[f] + float64(counts[row])*reg*pr[f]
+			if den > 0 {
+				pr[f] *= nr[f] / den
+			}
+		}
+	}
+}
+
+func (m *NMF) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *NMF) PredictID(uid, iid int) float64 {
+	if uid < 0 || iid < 0 {
+		return m.GlobalMean
+	}
+	return dot(m.PU.Row(uid), m.QI.Row(iid))
+}
+
+func (m *NMF) userVector(uid int) []float64 {
+	return m.PU.Row(uid)
+}
+
+func (m *NMF) itemVectors() (*Factors, []float64) {
+	return m.QI, nil
+}
+
+func (m *NMF) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data) + 1
+}
+
+func (m *NMF) Summary() string {
+	return summarize("NMF", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *NMF) GetDataset() *data.Dataset {
+	return m.Dataset
+}
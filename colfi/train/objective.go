@@ -0,0 +1,63 @@
+package train
+
+import (
+	"fmt"
+)
+
+// Objective decomposes the training objective of a model on its trainset:
+// the squared error of its predictions and the penalties on its biases and
+// factors. Penalties are counted once per rating, as SGD applies them, so a
+// factor regularization that dwarfs the data loss points to Reg being too
+// high and a negligible one to it being too low.
+type Objective struct {
+	Epoch     int
+	DataLoss  float64
+	BiasReg   float64
+	FactorReg float64
+}
+
+func (o Objective) Total() float64 {
+	return o.DataLoss + o.BiasReg + o.FactorReg
+}
+
+func (o Objective) String() string {
+	return fmt.Sprintf("epoch %d: objective %.4g = data %.4g + bias reg %.4g + factor reg %.4g",
+		o.Epoch, o.Total(), o.DataLoss, o.BiasReg, o.FactorReg)
+}
+
+// objectiver is implemented by models that can decompose their objective.
+type objectiver interface {
+	objective() Objective
+}
+
+// FitObjective trains m for numEpochs, one at a time, and returns its
+// objective after each epoch. Only SVD supports it.
+func FitObjective(m Model, numEpochs int) ([]Objective, error) {
+	o, ok := m.(objectiver)
+	if !ok {
+		return nil, fmt.Errorf("%T does not report its objective", m)
+	}
+	objectives := make([]Objective, numEpochs)
+	for epoch := range objectives {
+		m.Fit(1)
+		objectives[epoch] = o.objective()
+		objectives[epoch].Epoch = epoch
+	}
+	return objectives, nil
+}
+
+func (m *SVD) objective() Objective {
+	var o Objective
+	d := m.Dataset
+	bu, bi := *m.BU, *m.BI
+	reg := m.Config.Reg
+	for idx, r := range d.Ratings {
+		u, i := d.Users[idx], d.Items[idx]
+		pr, qr := m.PU.Row(u), m.QI.Row(i)
+		err := float64(r) - (m.GlobalMean + bu[u] + bi[i] + dot(pr, qr))
+		o.DataLoss += err * err
+		o.BiasReg += reg * (bu[u]*bu[u] + bi[i]*bi[i])
+		o.FactorReg += reg * (dot(pr, pr) + dot(qr, qr))
+	}
+	return o
+}
@@ -0,0 +1,177 @@
+package train
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"main/colfi/infer"
+)
+
+// ONNX enum values and the versions the exported graph targets. The graph
+// only uses Gather, Mul, ReduceSum, Add and Clip, so opset 13 is widely
+// supported.
+const (
+	onnxIRVersion    = 7
+	onnxOpsetVersion = 13
+	onnxFloat        = 1
+	onnxInt64        = 7
+	onnxAttrInt      = 2
+)
+
+// ExportONNX writes the scoring function of a factor model as an ONNX
+// model. The graph takes int64 tensors "user" and "item" of equal length,
+// holding internal IDs (positions in the dataset's UserIDs and ItemIDs), and
+// returns a float tensor "score" with one prediction per pair. IDs must be in
+// range; unseen users and items have to be handled by the caller.
+//
+// The same models as for NewCompact are supported.
+func ExportONNX(m Model, w io.Writer) error {
+	c, err := NewCompact(m)
+	if err != nil {
+		return fmt.Errorf("ONNX export: %w", err)
+	}
+
+	var g pbuf
+	var inits []pbuf
+	inits = append(inits, onnxFactors("P", c.PU), onnxFactors("Q", c.QI))
+	g.message(1, onnxNode("gather_p", "Gather", []string{"P", "user"}, "pu"))
+	g.message(1, onnxNode("gather_q", "Gather", []string{"Q", "item"}, "qi"))
+	g.message(1, onnxNode("mul", "Mul", []string{"pu", "qi"}, "prod"))
+	reduce := onnxNode("reduce", "ReduceSum", []string{"prod", "axes"}, "dot")
+	var keepdims pbuf
+	keepdims.str(1, "keepdims")
+	keepdims.varint(3, 0)
+	keepdims.varint(20, onnxAttrInt)
+	reduce.message(5, keepdims)
+	g.message(1, reduce)
+	inits = append(inits, onnxInt64s("axes", []int64{1}))
+	out := "dot"
+	add := func(name string, bias []float64, index string) {
+		inits = append(inits, onnxFloats(name, []int{len(bias)}, bias))
+		g.message(1, onnxNode("gather_"+name, "Gather", []string{name, index}, name+"_g"))
+		g.message(1, onnxNode("add_"+name, "Add", []string{out, name + "_g"}, out+"_"+name))
+		out += "_" + name
+	}
+	if c.BU != nil {
+		add("bu", c.BU, "user")
+	}
+	if c.BI != nil {
+		add("bi", c.BI, "item")
+	}
+	inits = append(inits, onnxFloats("mean", nil, []float64{c.GlobalMean}))
+	if c.Clip != nil {
+		inits = append(inits, onnxFloats("min", nil, []float64{c.Clip.Min}), onnxFloats("max", nil, []float64{c.Clip.Max}))
+		g.message(1, onnxNode("add_mean", "Add", []string{out, "mean"}, "unclipped"))
+		g.message(1, onnxNode("clip", "Clip", []string{"unclipped", "min", "max"}, "score"))
+	} else {
+		g.message(1, onnxNode("add_mean", "Add", []string{out, "mean"}, "score"))
+	}
+
+	g.str(2, "colfi")
+	for _, t := range inits {
+		g.message(5, t)
+	}
+	g.message(11, onnxValueInfo("user", onnxInt64))
+	g.message(11, onnxValueInfo("item", onnxInt64))
+	g.message(12, onnxValueInfo("score", onnxFloat))
+
+	var opset pbuf
+	opset.str(1, "")
+	opset.varint(2, onnxOpsetVersion)
+	var model pbuf
+	model.varint(1, onnxIRVersion)
+	model.str(2, "colfi")
+	model.message(7, g)
+	model.message(8, opset)
+	_, err = w.Write(model)
+	return err
+}
+
+func onnxNode(name, op string, inputs []string, output string) pbuf {
+	var n pbuf
+	for _, in := range inputs {
+		n.str(1, in)
+	}
+	n.str(2, output)
+	n.str(3, name)
+	n.str(4, op)
+	return n
+}
+
+// onnxValueInfo declares a one-dimensional tensor of dynamic length n.
+func onnxValueInfo(name string, elemType uint64) pbuf {
+	var dim, shape, tensor, typ, vi pbuf
+	dim.str(2, "n")
+	shape.message(1, dim)
+	tensor.varint(1, elemType)
+	tensor.message(2, shape)
+	typ.message(1, tensor)
+	vi.str(1, name)
+	vi.message(2, typ)
+	return vi
+}
+
+func onnxFactors(name string, f *infer.Factors) pbuf {
+	data := make([]float64, 0, f.Rows*f.Cols)
+	for r := 0; r < f.Rows; r++ {
+		data = append(data, f.Row(r)...)
+	}
+	return onnxFloats(name, []int{f.Rows, f.Cols}, data)
+}
+
+func onnxFloats(name string, dims []int, data []float64) pbuf {
+	var t pbuf
+	for _, d := range dims {
+		t.varint(1, uint64(d))
+	}
+	t.varint(2, onnxFloat)
+	t.str(8, name)
+	raw := make([]byte, 4*len(data))
+	for k, v := range data {
+		binary.LittleEndian.PutUint32(raw[4*k:], math.Float32bits(float32(v)))
+	}
+	t.bytes(9, raw)
+	return t
+}
+
+func onnxInt64s(name string, data []int64) pbuf {
+	var t pbuf
+	t.varint(1, uint64(len(data)))
+	t.varint(2, onnxInt64)
+	t.str(8, name)
+	raw := make([]byte, 8*len(data))
+	for k, v := range data {
+		binary.LittleEndian.PutUint64(raw[8*k:], uint64(v))
+	}
+	t.bytes(9, raw)
+	return t
+}
+
+// pbuf is a minimal protocol buffers encoder, enough to write the handful of
+// ONNX messages above without depending on generated code.
+type pbuf []byte
+
+func (b *pbuf) tag(field, wireType uint64) {
+	*b = binary.AppendUvarint(*b, field<<3|wireType)
+}
+
+func (b *pbuf) varint(field, v uint64) {
+	b.tag(field, 0)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *pbuf) bytes(field uint64, v []byte) {
+	b.tag(field, 2)
+	*b = binary.AppendUvarint(*b, uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (b *pbuf) str(field uint64, v string) {
+	b.bytes(field, []byte(v))
+}
+
+func (b *pbuf) message(field uint64, m pbuf) {
+	b.bytes(field, m)
+}
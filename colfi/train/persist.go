@@ -0,0 +1,121 @@
+package train
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// The models are registered under the names they had before the colfi
+// package was split, so that models saved by older builds still load.
+func init() {
+	gob.RegisterName("*colfi.SVD", &SVD{})
+	gob.RegisterName("*colfi.SVDpp", &SVDpp{})
+	gob.RegisterName("*colfi.HashedSVD", &HashedSVD{})
+	gob.RegisterName("*colfi.AsymSVD", &AsymSVD{})
+	gob.RegisterName("*colfi.EALS", &EALS{})
+	gob.RegisterName("*colfi.ImplicitALS", &ImplicitALS{})
+	gob.RegisterName("*colfi.BPR", &BPR{})
+	gob.RegisterName("*colfi.NMF", &NMF{})
+	gob.RegisterName("*colfi.KNNUser", &KNNUser{})
+	gob.RegisterName("*colfi.KNNItemBaseline", &KNNItemBaseline{})
+	gob.RegisterName("*colfi.SlopeOne", &SlopeOne{})
+	gob.RegisterName("*colfi.BaselineOnly", &BaselineOnly{})
+	gob.RegisterName("*colfi.FFM", &FFM{})
+	gob.RegisterName("*colfi.FM", &FM{})
+	gob.RegisterName("*colfi.NCF", &NCF{})
+	gob.RegisterName("*colfi.LogisticMF", &LogisticMF{})
+	gob.RegisterName("*colfi.EASE", &EASE{})
+	gob.RegisterName("*colfi.Integrated", &Integrated{})
+	gob.RegisterName("*colfi.PMF", &PMF{})
+	gob.RegisterName("*colfi.Item2Vec", &Item2Vec{})
+	gob.RegisterName("*colfi.Ensemble", &Ensemble{})
+}
+
+// restorer is implemented by models that keep derived state in unexported
+// fields, which is not saved and has to be rebuilt after Load.
+type restorer interface {
+	restore()
+}
+
+// Metadata describes a saved model. It follows the model in the gob stream,
+// so files written before it existed load with zero Metadata and older
+// readers ignore it.
+type Metadata struct {
+	// TrainedAt is when training finished, or zero if the model was saved
+	// without it.
+	TrainedAt time.Time
+}
+
+// Save writes m to w in gob format, followed by zero Metadata. Models that
+// share a Dataset, such as the members of an Ensemble, are written with a
+// copy each.
+func Save(w io.Writer, m Model) error {
+	return SaveMetadata(w, m, Metadata{})
+}
+
+// SaveMetadata is Save writing meta after m: the time training finished
+// for a model just trained, or the Metadata LoadMetadata returned for one
+// being written again, so that it keeps its age.
+func SaveMetadata(w io.Writer, m Model, meta Metadata) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(&m); err != nil {
+		return err
+	}
+	return enc.Encode(meta)
+}
+
+func Load(r io.Reader) (Model, error) {
+	m, _, err := LoadMetadata(r)
+	return m, err
+}
+
+// LoadMetadata is Load also returning the model's Metadata.
+func LoadMetadata(r io.Reader) (Model, Metadata, error) {
+	var m Model
+	var meta Metadata
+	dec := gob.NewDecoder(r)
+	if err := dec.Decode(&m); err != nil {
+		return nil, meta, err
+	}
+	if err := dec.Decode(&meta); err != nil && err != io.EOF {
+		return nil, meta, fmt.Errorf("reading model metadata: %w", err)
+	}
+	m.GetDataset().Restore()
+	if rs, ok := m.(restorer); ok {
+		rs.restore()
+	}
+	return m, meta, nil
+}
+
+func SaveFile(path string, m Model) error {
+	return SaveFileMetadata(path, m, Metadata{})
+}
+
+func SaveFileMetadata(path string, m Model, meta Metadata) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := SaveMetadata(f, m, meta); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func LoadFile(path string) (Model, error) {
+	m, _, err := LoadFileMetadata(path)
+	return m, err
+}
+
+func LoadFileMetadata(path string) (Model, Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer f.Close()
+	return LoadMetadata(f)
+}
@@ -0,0 +1,51 @@
+package train
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSaveMetadataKeepsTrainedAt(t *testing.T) {
+	m, err := NewSVD(testDataset(t), &SVDConfig{NumFactors: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(1)
+	trainedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var b bytes.Buffer
+	if err := SaveMetadata(&b, m, Metadata{TrainedAt: trainedAt}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, meta, err := LoadMetadata(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.TrainedAt.Equal(trainedAt) {
+		t.Fatalf("TrainedAt: got %v, want %v", meta.TrainedAt, trainedAt)
+	}
+
+	// Writing a loaded model again with its Metadata keeps its age.
+	b.Reset()
+	if err := SaveMetadata(&b, loaded, meta); err != nil {
+		t.Fatal(err)
+	}
+	if _, meta, err = LoadMetadata(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.TrainedAt.Equal(trainedAt) {
+		t.Errorf("TrainedAt after saving again: got %v, want %v", meta.TrainedAt, trainedAt)
+	}
+
+	// Save does not know when the model was trained.
+	b.Reset()
+	if err := Save(&b, m); err != nil {
+		t.Fatal(err)
+	}
+	if _, meta, err = LoadMetadata(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.TrainedAt.IsZero() {
+		t.Errorf("Save wrote TrainedAt %v, want zero", meta.TrainedAt)
+	}
+}
@@ -0,0 +1,310 @@
+package train
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// UncertainPredictor is implemented by models whose predictions come with a
+// variance, so that callers can tell confident predictions from guesses.
+type UncertainPredictor interface {
+	Model
+	PredictVariance(u, i string) float64
+}
+
+// PredictInterval returns the interval of z standard deviations around m's
+// prediction for u and i, e.g. z = 1.96 for a 95% interval under a normal
+// approximation.
+func PredictInterval(m UncertainPredictor, u, i string, z float64) (lo, hi float64) {
+	p := m.Predict(u, i)
+	w := z * math.Sqrt(m.PredictVariance(u, i))
+	return p - w, p + w
+}
+
+// PMF is Bayesian probabilistic matrix factorization in the manner of
+// Salakhutdinov and Mnih (2008), with fixed rather than learned precisions:
+// ratings are Gaussian around the global mean plus the dot product of the
+// user's and item's factors, which have Gaussian priors around zero. Each
+// epoch of Fit is a Gibbs sweep that draws every user's factors given the
+// items' and then every item's given the users'. After BurnIn sweeps, the
+// latest Samples draws are kept; Predict averages the predictions of the
+// draws kept and PredictVariance adds their variance to the noise variance,
+// so that it is largest for users and items with few ratings. Keeping the
+// draws needs Samples times the memory of the factors.
+type PMF struct {
+	Dataset *data.Dataset
+	// PU and QI hold the latest draw of the factors.
+	PU *Factors
+	QI *Factors
+	// DrawsU and DrawsI hold the draws kept, oldest first once the window
+	// has filled up.
+	DrawsU     []*Factors
+	DrawsI     []*Factors
+	Sweeps     int
+	GlobalMean float64
+	Bounds     data.Bounds
+	Config     *PMFConfig
+	byUser     [][]int
+	byItem     [][]int
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+}
+
+type PMFConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	// NoisePrecision is the inverse variance of ratings around their
+	// predictions and PriorPrecision that of every factor around zero.
+	NoisePrecision float64
+	PriorPrecision float64
+	// BurnIn is the number of sweeps whose draws are discarded and Samples
+	// the number of later draws kept.
+	BurnIn  int
+	Samples int
+	// NumWorkers is the number of goroutines rows are drawn on,
+	// runtime.NumCPU() if zero.
+	NumWorkers int
+	Clip       bool
+	// Source, if set, draws the initial factors and the Gibbs samples, as
+	// SVDConfig.Source does.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewPMF(dataset *data.Dataset, config *PMFConfig) (Model, error) {
+	if config == nil {
+		config = &PMFConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 10
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.NoisePrecision == 0 {
+		config.NoisePrecision = 2
+	}
+	if config.PriorPrecision == 0 {
+		config.PriorPrecision = 2
+	}
+	if config.BurnIn == 0 {
+		config.BurnIn = 5
+	}
+	if config.Samples == 0 {
+		config.Samples = 20
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	numUsers, numItems, k := len(dataset.UserMap), len(dataset.ItemMap), config.NumFactors
+	rng := random.Or(config.Source)
+	saved := *config
+	saved.Source = nil
+	m := &PMF{
+		Dataset:    dataset,
+		PU:         randFactors(rng, config.InitMean, config.InitStdDev, numUsers, k),
+		QI:         randFactors(rng, config.InitMean, config.InitStdDev, numItems, k),
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Bounds:     dataset.RatingBounds(),
+		Config:     &saved,
+		src:        config.Source,
+	}
+	m.restore()
+	return m, nil
+}
+
+func (m *PMF) restore() {
+	d := m.Dataset
+	m.byUser = data.GroupRatings(d.Users, len(d.UserMap))
+	m.byItem = data.GroupRatings(d.Items, len(d.ItemMap))
+}
+
+func (m *PMF) Fit(numEpochs int) {
+	d := m.Dataset
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running sweep %d", m.Sweeps)
+		}
+		m.drawSide(m.PU, m.QI, m.byUser, d.Items)
+		m.drawSide(m.QI, m.PU, m.byItem, d.Users)
+		m.Sweeps++
+		if m.Sweeps > m.Config.BurnIn {
+			m.DrawsU = keepDraw(m.DrawsU, m.PU, m.Config.Samples)
+			m.DrawsI = keepDraw(m.DrawsI, m.QI, m.Config.Samples)
+		}
+	}
+}
+
+// drawSide draws every row of x from its conditional posterior given y.
+// rows maps a row of x to the indices of its ratings and other maps a rating
+// index to the corresponding row of y. The posterior of a row is Gaussian
+// with precision A = λI + α Σ y yᵀ and mean A⁻¹ α Σ (r - μ) y; with A = UᵀU,
+// mean + U⁻¹z for standard normal z is a draw from it.
+func (m *PMF) drawSide(x, y *Factors, rows [][]int, other []int) {
+	numWorkers := m.Config.NumWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	alpha, lambda := m.Config.NoisePrecision, m.Config.PriorPrecision
+	dim := x.Cols
+	// The noise is drawn up front so that draws do not depend on how the
+	// workers interleave.
+	z := randFactors(random.Or(m.src), 0, 1, x.Rows, dim)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			a := mat.NewSymDense(dim, nil)
+			b := mat.NewVecDense(dim, nil)
+			mean := make([]float64, dim)
+			var chol mat.Cholesky
+			var yv, mv mat.VecDense
+			mv.SetRawVector(blas64.Vector{N: dim, Inc: 1, Data: mean})
+			bd := b.RawVector().Data
+			for r := w; r < len(rows); r += numWorkers {
+				a.Zero()
+				for f := range bd {
+					bd[f] = 0
+				}
+				for f := 0; f < dim; f++ {
+					a.SetSym(f, f, lambda)
+				}
+				for _, idx := range rows[r] {
+					yr := y.Row(other[idx])
+					yv.SetRawVector(blas64.Vector{N: dim, Inc: 1, Data: yr})
+					a.SymRankOne(a, alpha, &yv)
+					t := alpha * (float64(m.Dataset.Ratings[idx]) - m.GlobalMean)
+					for f, yf := range yr {
+						bd[f] += t * yf
+					}
+				}
+				if !chol.Factorize(a) {
+					log.Printf("PMF: keeping row %d, posterior precision is not positive definite", r)
+					continue
+				}
+				chol.SolveVecTo(&mv, b)
+				u := chol.RawU()
+				xr, zr := x.Row(r), z.Row(r)
+				// Back substitution solves U e = z into xr.
+				for f := dim - 1; f >= 0; f-- {
+					s := zr[f]
+					for g := f + 1; g < dim; g++ {
+						s -= u.At(f, g) * xr[g]
+					}
+					xr[f] = s / u.At(f, f)
+				}
+				for f := range xr {
+					xr[f] += mean[f]
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// keepDraw appends a copy of x to draws, dropping the oldest beyond n.
+func keepDraw(draws []*Factors, x *Factors, n int) []*Factors {
+	c := *x
+	c.Data = append([]float64(nil), x.Data...)
+	if len(draws) >= n {
+		draws = append(draws[:0], draws[len(draws)-n+1:]...)
+	}
+	return append(draws, &c)
+}
+
+// dotMoments returns the mean and variance of the dot product of the
+// factors of uid and iid over the draws kept, or over the latest draw
+// before any are. An unknown user or item contributes zero.
+func (m *PMF) dotMoments(uid, iid int) (mean, variance float64) {
+	if uid < 0 || iid < 0 {
+		return 0, 0
+	}
+	drawsU, drawsI := m.DrawsU, m.DrawsI
+	if len(drawsU) == 0 {
+		drawsU, drawsI = []*Factors{m.PU}, []*Factors{m.QI}
+	}
+	var sum, sumSq float64
+	for k := range drawsU {
+		p := dot(drawsU[k].Row(uid), drawsI[k].Row(iid))
+		sum += p
+		sumSq += p * p
+	}
+	n := float64(len(drawsU))
+	mean = sum / n
+	return mean, math.Max(0, sumSq/n-mean*mean)
+}
+
+func (m *PMF) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+// PredictID returns the global mean plus the average dot product of the
+// factors over the draws kept.
+func (m *PMF) PredictID(uid, iid int) float64 {
+	mean, _ := m.dotMoments(uid, iid)
+	p := m.GlobalMean + mean
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+func (m *PMF) PredictVariance(u, i string) float64 {
+	return m.PredictVarianceID(m.Dataset.LookupIDs(u, i))
+}
+
+// PredictVarianceID returns the variance of a new rating of the item by the
+// user: the noise variance plus the variance of the prediction over the
+// draws kept. For a user or item not seen in training, whose factors are
+// only known to follow the prior, the latter is replaced by that of a dot
+// product of prior factors with the other side's latest draw.
+func (m *PMF) PredictVarianceID(uid, iid int) float64 {
+	v := 1 / m.Config.NoisePrecision
+	if uid >= 0 && iid >= 0 {
+		_, dv := m.dotMoments(uid, iid)
+		return v + dv
+	}
+	// Var(pᵀq) for p ~ N(0, I/λ) independent of q is E[qᵀq]/λ.
+	var other *Factors
+	row := iid
+	if uid >= 0 {
+		other, row = m.PU, uid
+	} else if iid >= 0 {
+		other = m.QI
+	}
+	if other == nil {
+		return v + float64(m.Config.NumFactors)/(m.Config.PriorPrecision*m.Config.PriorPrecision)
+	}
+	q := other.Row(row)
+	return v + dot(q, q)/m.Config.PriorPrecision
+}
+
+func (m *PMF) NumParams() int {
+	n := len(m.PU.Data) + len(m.QI.Data) + 1
+	for k := range m.DrawsU {
+		n += len(m.DrawsU[k].Data) + len(m.DrawsI[k].Data)
+	}
+	return n
+}
+
+func (m *PMF) Summary() string {
+	return summarize("PMF", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *PMF) GetDataset() *data.Dataset {
+	return m.Dataset
+}
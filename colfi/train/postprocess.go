@@ -0,0 +1,109 @@
+package train
+
+import (
+	"main/colfi/data"
+)
+
+// PostProcessor transforms the score a model gives user u for item i, e.g.
+// to clip it to the rating scale, calibrate it or cap it for business
+// reasons. Scores of items being ranked are processed before the ranking.
+type PostProcessor interface {
+	Process(u, i string, score float64) float64
+}
+
+// PostProcessorFunc adapts a function to a PostProcessor.
+type PostProcessorFunc func(u, i string, score float64) float64
+
+func (f PostProcessorFunc) Process(u, i string, score float64) float64 {
+	return f(u, i, score)
+}
+
+// Chain applies its post-processors in order. A nil Chain leaves scores
+// unchanged.
+type Chain []PostProcessor
+
+func (c Chain) Process(u, i string, score float64) float64 {
+	for _, p := range c {
+		score = p.Process(u, i, score)
+	}
+	return score
+}
+
+// Clip returns a PostProcessor that clips scores to b.
+func Clip(b data.Bounds) PostProcessor {
+	return PostProcessorFunc(func(u, i string, score float64) float64 {
+		return b.Clip(score)
+	})
+}
+
+// ModelBounds returns the rating scale m stored when it was built, as
+// overridden by its config's Bounds, if it is one of the explicit models
+// that store one.
+func ModelBounds(m Model) (data.Bounds, bool) {
+	switch v := m.(type) {
+	case *SVD:
+		return v.Bounds, true
+	case *SVDpp:
+		return v.Bounds, true
+	case *HashedSVD:
+		return v.Bounds, true
+	case *AsymSVD:
+		return v.Bounds, true
+	case *BaselineOnly:
+		return v.Bounds, true
+	case *Integrated:
+		return v.Bounds, true
+	case *PMF:
+		return v.Bounds, true
+	}
+	return data.Bounds{}, false
+}
+
+// Linear calibrates scores to Scale*score + Offset.
+type Linear struct {
+	Scale  float64
+	Offset float64
+}
+
+func (l Linear) Process(u, i string, score float64) float64 {
+	return l.Scale*score + l.Offset
+}
+
+// ItemCaps caps the scores of the items it lists, e.g. to keep promoted or
+// sensitive items from dominating lists.
+type ItemCaps map[string]float64
+
+func (c ItemCaps) Process(u, i string, score float64) float64 {
+	if limit, ok := c[i]; ok && score > limit {
+		return limit
+	}
+	return score
+}
+
+// postProcessed scores with m for user u, passing the scores through
+// chain. RankItems ranks one user's items, so u is fixed.
+type postProcessed struct {
+	Model
+	u     string
+	chain Chain
+}
+
+func (m postProcessed) Predict(u, i string) float64 {
+	return m.chain.Process(u, i, m.Model.Predict(u, i))
+}
+
+func (m postProcessed) PredictID(uid, iid int) float64 {
+	i := m.GetDataset().ItemIDs[iid]
+	if idp, ok := m.Model.(IDPredictor); ok {
+		return m.chain.Process(m.u, i, idp.PredictID(uid, iid))
+	}
+	return m.Predict(m.u, i)
+}
+
+func (m postProcessed) scoreUser(uid int) func(iid int) float64 {
+	score := userScores(m.Model, m.u, uid)
+	d := m.GetDataset()
+	return func(iid int) float64 {
+		return m.chain.Process(m.u, d.ItemIDs[iid], score(iid))
+	}
+}
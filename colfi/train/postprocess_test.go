@@ -0,0 +1,26 @@
+package train
+
+import (
+	"testing"
+
+	"main/colfi/data"
+)
+
+func TestModelBoundsKeepsOverride(t *testing.T) {
+	d := testDataset(t)
+	override := data.Bounds{Min: 0, Max: 10, Step: .5}
+	m, err := NewSVD(d, &SVDConfig{NumFactors: 4, Bounds: &override})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The scale comes from the model, not from its dataset, which may
+	// have been emptied before the model was saved.
+	m.(*SVD).Dataset = data.NewDataset()
+	b, ok := ModelBounds(m)
+	if !ok || b != override {
+		t.Errorf("got %v, %v, want %v, true", b, ok, override)
+	}
+	if _, ok := ModelBounds(&BPR{}); ok {
+		t.Error("BPR reported a rating scale")
+	}
+}
@@ -0,0 +1,23 @@
+package train
+
+import (
+	"math/rand"
+
+	"main/colfi/internal/random"
+)
+
+// SetRand makes r the default source of randomness in the colfi packages,
+// including the dataset splits of package data, or restores the global
+// math/rand source if r is nil. Configs and functions given a source of their
+// own draw from that instead. r is used under a lock, so it is safe to
+// train concurrently, but concurrent draws make the order and so the results
+// depend on scheduling.
+func SetRand(r *rand.Rand) {
+	random.Set(r)
+}
+
+// Seed is SetRand with a new source seeded with seed. It yields the same
+// draws as seeding the global math/rand source did.
+func Seed(seed int64) {
+	SetRand(rand.New(rand.NewSource(seed)))
+}
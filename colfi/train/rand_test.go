@@ -0,0 +1,54 @@
+package train
+
+import (
+	"io"
+	"math/rand"
+	"testing"
+
+	"main/colfi/data"
+)
+
+func TestConfigSourceReproduces(t *testing.T) {
+	u, i, r, err := data.SyntheticRatings(1, 50, 30, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _, err := data.DatasetsFromSlices(u, i, r, 0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetRand(nil)
+	var calls int64
+	fit := func(seed int64) *SVD {
+		m, err := NewSVD(d, &SVDConfig{NumFactors: 4, SampleRate: .5, Source: rand.New(rand.NewSource(seed))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A default source seeded differently on every call must not
+		// change the model's draws.
+		calls++
+		SetRand(rand.New(rand.NewSource(calls)))
+		m.Fit(3)
+		return m.(*SVD)
+	}
+	a, b := fit(7), fit(7)
+	for k, v := range a.PU.Data {
+		if b.PU.Data[k] != v {
+			t.Fatalf("PU.Data[%d]: got %v and %v from the same seed", k, v, b.PU.Data[k])
+		}
+	}
+	if a.Config.Source != nil {
+		t.Error("the model's config kept the Source")
+	}
+	if err := Save(io.Discard, a); err != nil {
+		t.Fatal(err)
+	}
+	c := fit(8)
+	same := true
+	for k, v := range a.PU.Data {
+		same = same && c.PU.Data[k] == v
+	}
+	if same {
+		t.Error("different seeds gave the same factors")
+	}
+}
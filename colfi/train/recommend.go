@@ -0,0 +1,126 @@
+package train
+
+import (
+	"context"
+
+	"main/colfi/data"
+)
+
+type RecommendOptions struct {
+	// Exclude lists items to leave out, typically those the user has
+	// already rated.
+	Exclude []string
+	// MinSupport leaves out items with fewer training ratings, whose scores
+	// are mostly noise.
+	MinSupport int
+	// Filter, if set, leaves out items for which it returns false, e.g. a
+	// test against ItemFeatures.
+	Filter func(item string) bool
+	// BiasOnlyBelow ranks items by biases alone for users with fewer
+	// training ratings, as PredictGated does.
+	BiasOnlyBelow int
+	// PostProcess transforms every score before items are ranked.
+	PostProcess Chain
+	// Available, if set, leaves out the items it does not hold, such as
+	// those out of stock or withdrawn since the model was trained.
+	Available *data.Availability
+	// MaxStdDev, if set, leaves out items whose prediction has a larger
+	// standard deviation, for models that are UncertainPredictors. It does
+	// not apply to SimilarItems.
+	MaxStdDev float64
+}
+
+// Recommend returns the n items of m's training data that score highest for
+// u, subject to opts, which may be nil.
+func Recommend(m Model, u string, n int, opts *RecommendOptions) []ScoredItem {
+	recs, _ := RecommendContext(context.Background(), m, u, n, opts)
+	return recs
+}
+
+// RecommendContext is Recommend, giving up with ctx's error once ctx is done.
+func RecommendContext(ctx context.Context, m Model, u string, n int, opts *RecommendOptions) ([]ScoredItem, error) {
+	if opts == nil {
+		opts = &RecommendOptions{}
+	}
+	keep := opts.keepItem(m.GetDataset())
+	if up, ok := m.(UncertainPredictor); ok && opts.MaxStdDev > 0 {
+		keep = keepConfident(keep, up, u, opts.MaxStdDev)
+	}
+	m = gateBiasOnly(m, u, opts.BiasOnlyBelow)
+	if len(opts.PostProcess) > 0 {
+		m = postProcessed{m, u, opts.PostProcess}
+	}
+	return RankItems(ctx, m, u, n, keep)
+}
+
+// keepItem returns whether the item of d with the given internal ID passes
+// Exclude, MinSupport, Filter and Available.
+func (opts *RecommendOptions) keepItem(d *data.Dataset) func(iid int) bool {
+	skip := make(map[int]bool, len(opts.Exclude))
+	for _, i := range opts.Exclude {
+		if iid, ok := d.ItemMap[i]; ok {
+			skip[iid] = true
+		}
+	}
+	counts := d.ItemCounts()
+	return func(iid int) bool {
+		return !skip[iid] && counts[iid] >= opts.MinSupport && opts.Available.Has(iid) &&
+			(opts.Filter == nil || opts.Filter(d.ItemIDs[iid]))
+	}
+}
+
+// keepConfident narrows keep to the items whose prediction for u by m has a
+// standard deviation of at most maxStdDev.
+func keepConfident(keep func(iid int) bool, m UncertainPredictor, u string, maxStdDev float64) func(iid int) bool {
+	d := m.GetDataset()
+	return func(iid int) bool {
+		return keep(iid) && m.PredictVariance(u, d.ItemIDs[iid]) <= maxStdDev*maxStdDev
+	}
+}
+
+// RankItems scores the items of m's dataset for which keep returns true and
+// returns the n best. ctx is checked every ctxCheckItems items.
+func RankItems(ctx context.Context, m Model, u string, n int, keep func(iid int) bool) ([]ScoredItem, error) {
+	d := m.GetDataset()
+	uid, _ := d.LookupIDs(u, "")
+	score := userScores(m, u, uid)
+	scores := make([]ScoredItem, 0, len(d.ItemIDs))
+	for iid, i := range d.ItemIDs {
+		if iid%ctxCheckItems == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if !keep(iid) {
+			continue
+		}
+		scores = append(scores, ScoredItem{Item: i, Score: score(iid)})
+	}
+	return topN(scores, n), nil
+}
+
+// userScorer is implemented by models with per-user work, such as building
+// AsymSVD's user vector from the user's ratings, that is worth doing once per
+// ranking rather than once per item.
+type userScorer interface {
+	// scoreUser returns a function that scores the item with internal ID
+	// iid for the user with internal ID uid, as PredictID does.
+	scoreUser(uid int) func(iid int) float64
+}
+
+// userScores returns a function that scores the items of m's dataset for u,
+// whose internal ID is uid, or -1 if u is unknown.
+func userScores(m Model, u string, uid int) func(iid int) float64 {
+	switch m := m.(type) {
+	case userScorer:
+		return m.scoreUser(uid)
+	case IDPredictor:
+		return func(iid int) float64 { return m.PredictID(uid, iid) }
+	}
+	d := m.GetDataset()
+	return func(iid int) float64 { return m.Predict(u, d.ItemIDs[iid]) }
+}
+
+// ctxCheckItems is how many items RankItems scores between checks of its
+// context, a few milliseconds' worth for most models.
+const ctxCheckItems = 4096
@@ -0,0 +1,125 @@
+package train
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+
+	"main/colfi/data"
+)
+
+type RecommendAllOptions struct {
+	// ExcludeRated leaves out the items each user rated in training.
+	ExcludeRated bool
+	// MinSupport leaves out items with fewer training ratings.
+	MinSupport int
+	// Quotas caps the number of users each listed item is recommended to,
+	// e.g. for titles licensed for a limited audience. Items not listed are
+	// unlimited.
+	Quotas map[string]int
+	// Candidates is the number of best items per user that allocation under
+	// Quotas chooses from, 3n if zero, or every item if n is not positive
+	// either. Users whose candidates are all used up by other users get
+	// fewer than n items.
+	Candidates int
+	// NumWorkers is the number of goroutines users are scored on,
+	// runtime.NumCPU() if zero.
+	NumWorkers int
+}
+
+// RecommendAll returns the n best items for every user of m's dataset,
+// keyed by user, or all of them ranked if n is not positive, subject to
+// opts, which may be nil. With Quotas, items are
+// allocated greedily across users: candidate user-item pairs are taken in
+// decreasing order of score, skipping those whose user has n items or whose
+// item has reached its quota, so that capped items go to the users who
+// score them highest.
+func RecommendAll(m Model, n int, opts *RecommendAllOptions) map[string][]ScoredItem {
+	if opts == nil {
+		opts = &RecommendAllOptions{}
+	}
+	d := m.GetDataset()
+	numWorkers := opts.NumWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	k := n
+	if len(opts.Quotas) > 0 {
+		k = opts.Candidates
+		if k <= 0 {
+			k = 3 * n
+		}
+	}
+	var rated [][]int
+	if opts.ExcludeRated {
+		rated = data.GroupRatings(d.Users, len(d.UserMap))
+	}
+	counts := d.ItemCounts()
+	lists := make([][]ScoredItem, len(d.UserIDs))
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			skip := make(map[int]bool)
+			for uid := w; uid < len(d.UserIDs); uid += numWorkers {
+				for iid := range skip {
+					delete(skip, iid)
+				}
+				if rated != nil {
+					for _, idx := range rated[uid] {
+						skip[d.Items[idx]] = true
+					}
+				}
+				lists[uid], _ = RankItems(context.Background(), m, d.UserIDs[uid], k, func(iid int) bool {
+					return !skip[iid] && counts[iid] >= opts.MinSupport
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if len(opts.Quotas) > 0 {
+		lists = allocate(lists, n, opts.Quotas)
+	}
+	recs := make(map[string][]ScoredItem, len(lists))
+	for uid, l := range lists {
+		recs[d.UserIDs[uid]] = l
+	}
+	return recs
+}
+
+// allocate picks up to n items per user, or any number if n is not
+// positive, from their candidates in decreasing order of score across all
+// users, giving each item of quotas to at most that many users.
+func allocate(candidates [][]ScoredItem, n int, quotas map[string]int) [][]ScoredItem {
+	type pair struct {
+		user int
+		item ScoredItem
+	}
+	var pairs []pair
+	for uid, c := range candidates {
+		for _, it := range c {
+			pairs = append(pairs, pair{uid, it})
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		return pairs[a].item.Score > pairs[b].item.Score
+	})
+	used := make(map[string]int, len(quotas))
+	lists := make([][]ScoredItem, len(candidates))
+	for _, p := range pairs {
+		if n > 0 && len(lists[p.user]) >= n {
+			continue
+		}
+		if quota, ok := quotas[p.item.Item]; ok {
+			if used[p.item.Item] >= quota {
+				continue
+			}
+			used[p.item.Item]++
+		}
+		lists[p.user] = append(lists[p.user], p.item)
+	}
+	return lists
+}
@@ -0,0 +1,131 @@
+package train
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRecommendAllQuotas(t *testing.T) {
+	d := testDataset(t)
+	m, err := NewSVD(d, &SVDConfig{NumFactors: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(10)
+	const n = 5
+
+	// Cap the item recommended to the most users without quotas.
+	free := RecommendAll(m, n, nil)
+	reach := make(map[string]int)
+	for _, l := range free {
+		for _, it := range l {
+			reach[it.Item]++
+		}
+	}
+	var capped string
+	for item, c := range reach {
+		if c > reach[capped] || c == reach[capped] && item < capped {
+			capped = item
+		}
+	}
+	if reach[capped] <= 2 {
+		t.Fatalf("%s is recommended to only %d users, so its quota is not tested", capped, reach[capped])
+	}
+	const quota = 2
+	recs := RecommendAll(m, n, &RecommendAllOptions{Quotas: map[string]int{capped: quota}})
+	checkLists(t, recs, len(d.UserIDs), n)
+	// Users who score n other items higher never get the capped item, so
+	// it goes to those among the rest who score it highest.
+	var holders []string
+	for u, l := range free {
+		for _, it := range l {
+			if it.Item == capped {
+				holders = append(holders, u)
+			}
+		}
+	}
+	sort.Slice(holders, func(a, b int) bool {
+		return m.Predict(holders[a], capped) > m.Predict(holders[b], capped)
+	})
+	var got []string
+	for u, l := range recs {
+		for _, it := range l {
+			if it.Item == capped {
+				got = append(got, u)
+			}
+		}
+	}
+	want := holders[:quota]
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s went to %v, want %v", capped, got, want)
+	}
+
+	// A zero quota withholds the item, its place going to the next best.
+	recs = RecommendAll(m, n, &RecommendAllOptions{Quotas: map[string]int{capped: 0}})
+	checkLists(t, recs, len(d.UserIDs), n)
+	for u, l := range recs {
+		for _, it := range l {
+			if it.Item == capped {
+				t.Errorf("%s got %s despite its zero quota", u, capped)
+			}
+		}
+	}
+}
+
+// checkLists checks that recs has a list of n distinct items for each of
+// numUsers users, in decreasing order of score.
+func checkLists(t *testing.T, recs map[string][]ScoredItem, numUsers, n int) {
+	t.Helper()
+	if len(recs) != numUsers {
+		t.Fatalf("got lists for %d users, want %d", len(recs), numUsers)
+	}
+	for u, l := range recs {
+		if len(l) != n {
+			t.Errorf("%s: got %d items, want %d", u, len(l), n)
+		}
+		seen := make(map[string]bool)
+		for k, it := range l {
+			if seen[it.Item] {
+				t.Errorf("%s: %s recommended twice", u, it.Item)
+			}
+			seen[it.Item] = true
+			if k > 0 && it.Score > l[k-1].Score {
+				t.Errorf("%s: items not in decreasing order of score", u)
+			}
+		}
+	}
+}
+
+func TestRecommendAllEveryItem(t *testing.T) {
+	d := testDataset(t)
+	m, err := NewSVD(d, &SVDConfig{NumFactors: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(1)
+	numItems := len(d.ItemIDs)
+
+	// n == 0 ranks every item, with or without quotas.
+	for u, l := range RecommendAll(m, 0, nil) {
+		if len(l) != numItems {
+			t.Errorf("%s without quotas: got %d items, want %d", u, len(l), numItems)
+		}
+	}
+	var full, short int
+	for u, l := range RecommendAll(m, 0, &RecommendAllOptions{Quotas: map[string]int{"i3": 1}}) {
+		switch len(l) {
+		case numItems:
+			full++
+		case numItems - 1:
+			short++
+		default:
+			t.Errorf("%s with quotas: got %d items, want %d or %d", u, len(l), numItems, numItems-1)
+		}
+	}
+	if full != 1 || short != len(d.UserIDs)-1 {
+		t.Errorf("with quotas: %d users got every item and %d all but the capped one, want 1 and %d", full, short, len(d.UserIDs)-1)
+	}
+}
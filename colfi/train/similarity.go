@@ -0,0 +1,158 @@
+package train
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// similarityBlock is the number of items whose neighbors are computed
+// together before being written out, which bounds memory to
+// similarityBlock*topK neighbors regardless of catalog size.
+const similarityBlock = 1024
+
+type neighbor struct {
+	item int
+	sim  float64
+}
+
+// ExportItemSimilarities writes, for every item, its topK most similar items
+// by cosine similarity of the model's item vectors, as tab-separated
+// item, neighbor, similarity lines ordered by item and then by decreasing
+// similarity. It works with factor models and Item2Vec.
+func ExportItemSimilarities(m Model, topK int, w io.Writer) error {
+	qi, err := similarityVectors(m)
+	if err != nil {
+		return err
+	}
+	if topK <= 0 {
+		return fmt.Errorf("topK must be positive, got %d", topK)
+	}
+	ids := m.GetDataset().ItemIDs
+	numItems := qi.Rows
+	norms := rowNorms(qi)
+
+	bw := bufio.NewWriter(w)
+	block := make([][]neighbor, similarityBlock)
+	numWorkers := runtime.NumCPU()
+	for start := 0; start < numItems; start += similarityBlock {
+		end := start + similarityBlock
+		if end > numItems {
+			end = numItems
+		}
+		var wg sync.WaitGroup
+		for k := 0; k < numWorkers; k++ {
+			wg.Add(1)
+			go func(k int) {
+				defer wg.Done()
+				for i := start + k; i < end; i += numWorkers {
+					block[i-start] = nearestItems(qi, norms, i, topK, block[i-start][:0])
+				}
+			}(k)
+		}
+		wg.Wait()
+
+		for i := start; i < end; i++ {
+			for _, nb := range block[i-start] {
+				bw.WriteString(ids[i])
+				bw.WriteByte('\t')
+				bw.WriteString(ids[nb.item])
+				bw.WriteByte('\t')
+				bw.WriteString(strconv.FormatFloat(nb.sim, 'g', 6, 64))
+				bw.WriteByte('\n')
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// SimilarItems returns the n items most similar to item i by cosine
+// similarity of the model's item vectors, subject to the options of opts that
+// concern items: Exclude, MinSupport, Filter and Available. opts may be nil.
+func SimilarItems(m Model, i string, n int, opts *RecommendOptions) ([]ScoredItem, error) {
+	return SimilarItemsContext(context.Background(), m, i, n, opts)
+}
+
+// SimilarItemsContext is SimilarItems, giving up with ctx's error once ctx
+// is done. ctx is checked every ctxCheckItems items.
+func SimilarItemsContext(ctx context.Context, m Model, i string, n int, opts *RecommendOptions) ([]ScoredItem, error) {
+	qi, err := similarityVectors(m)
+	if err != nil {
+		return nil, err
+	}
+	d := m.GetDataset()
+	iid, ok := d.ItemMap[i]
+	if !ok {
+		return nil, fmt.Errorf("unknown item %q", i)
+	}
+	if opts == nil {
+		opts = &RecommendOptions{}
+	}
+	keep := opts.keepItem(d)
+	norms := rowNorms(qi)
+	ri := qi.Row(iid)
+	scores := make([]ScoredItem, 0, qi.Rows)
+	for j := 0; j < qi.Rows; j++ {
+		if j%ctxCheckItems == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if j == iid || norms[iid] == 0 || norms[j] == 0 || !keep(j) {
+			continue
+		}
+		scores = append(scores, ScoredItem{d.ItemIDs[j], dot(ri, qi.Row(j)) / (norms[iid] * norms[j])})
+	}
+	return topN(scores, n), nil
+}
+
+// similarityVectors returns the item vectors of m that similarities are
+// computed on.
+func similarityVectors(m Model) (*Factors, error) {
+	switch v := m.(type) {
+	case *Item2Vec:
+		return v.IV, nil
+	case factorizer:
+		qi, _ := v.itemVectors()
+		return qi, nil
+	}
+	return nil, fmt.Errorf("%T does not expose item vectors", m)
+}
+
+func rowNorms(f *Factors) []float64 {
+	norms := make([]float64, f.Rows)
+	for i := range norms {
+		r := f.Row(i)
+		norms[i] = math.Sqrt(dot(r, r))
+	}
+	return norms
+}
+
+// nearestItems appends to dst the topK items most similar to item i, kept
+// sorted by insertion since topK is expected to be small.
+func nearestItems(qi *Factors, norms []float64, i, topK int, dst []neighbor) []neighbor {
+	ri := qi.Row(i)
+	for j := 0; j < qi.Rows; j++ {
+		if j == i || norms[i] == 0 || norms[j] == 0 {
+			continue
+		}
+		sim := dot(ri, qi.Row(j)) / (norms[i] * norms[j])
+		if len(dst) == topK && sim <= dst[topK-1].sim {
+			continue
+		}
+		if len(dst) < topK {
+			dst = append(dst, neighbor{})
+		}
+		k := len(dst) - 1
+		for ; k > 0 && dst[k-1].sim < sim; k-- {
+			dst[k] = dst[k-1]
+		}
+		dst[k] = neighbor{j, sim}
+	}
+	return dst
+}
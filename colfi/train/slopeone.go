@@ -0,0 +1,144 @@
+package train
+
+import (
+	"log"
+	"runtime"
+	"sync"
+
+	"main/colfi/data"
+)
+
+// SlopeOne is the weighted Slope One scheme of Lemire and Maclachlan (2005):
+// a user's rating of an item is the mean, over the items j they rated, of
+// their rating of j plus the average difference between ratings of the item
+// and of j, weighted by the number of users who rated both. It has no
+// parameters to tune, which makes it a quick baseline. Fit computes the
+// deviation of every pair of items, so memory is quadratic in the number of
+// items; the number of epochs is ignored.
+type SlopeOne struct {
+	Dataset *data.Dataset
+	// Dev holds the average rating difference of every pair of items and
+	// Card the number of users the average is over.
+	Dev        *Factors
+	Card       *Factors
+	Means      []float64
+	GlobalMean float64
+	Config     *SlopeOneConfig
+	// rated lists the indices of the ratings of every user.
+	rated [][]int
+}
+
+type SlopeOneConfig struct {
+	// NumWorkers is the number of goroutines deviations are computed on,
+	// runtime.NumCPU() if zero.
+	NumWorkers int
+	Verbose    bool
+}
+
+func NewSlopeOne(dataset *data.Dataset, config *SlopeOneConfig) (Model, error) {
+	if config == nil {
+		config = &SlopeOneConfig{}
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	numItems := len(dataset.ItemMap)
+	m := &SlopeOne{
+		Dataset:    dataset,
+		Dev:        newFactors(numItems, numItems),
+		Card:       newFactors(numItems, numItems),
+		Means:      rowMeans(dataset.Users, dataset.Ratings, len(dataset.UserMap)),
+		GlobalMean: data.Mean32(dataset.Ratings),
+		Config:     config,
+	}
+	m.restore()
+	return m, nil
+}
+
+func (m *SlopeOne) restore() {
+	m.rated = data.GroupRatings(m.Dataset.Users, len(m.Dataset.UserMap))
+}
+
+func (m *SlopeOne) Fit(numEpochs int) {
+	d := m.Dataset
+	if m.Config.Verbose {
+		log.Printf("computing deviations of %d items", len(d.ItemMap))
+	}
+	numWorkers := m.Config.NumWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	byItem := data.GroupRatings(d.Items, len(d.ItemMap))
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for a := w; a < len(byItem); a += numWorkers {
+				dev, card := m.Dev.Row(a), m.Card.Row(a)
+				for b := range dev {
+					dev[b], card[b] = 0, 0
+				}
+				for _, idx := range byItem[a] {
+					r := float64(d.Ratings[idx])
+					for _, jdx := range m.rated[d.Users[idx]] {
+						b := d.Items[jdx]
+						dev[b] += r - float64(d.Ratings[jdx])
+						card[b]++
+					}
+				}
+				for b, n := range card {
+					if n > 0 {
+						dev[b] /= n
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func (m *SlopeOne) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *SlopeOne) PredictID(uid, iid int) float64 {
+	d := m.Dataset
+	switch {
+	case uid < 0 && iid < 0:
+		return m.GlobalMean
+	case uid < 0:
+		return d.ItemMeanRating()[iid]
+	case iid < 0:
+		return m.Means[uid]
+	}
+	dev, card := m.Dev.Row(iid), m.Card.Row(iid)
+	var num, den float64
+	for _, idx := range m.rated[uid] {
+		j := d.Items[idx]
+		if j == iid || card[j] == 0 {
+			continue
+		}
+		num += (dev[j] + float64(d.Ratings[idx])) * card[j]
+		den += card[j]
+	}
+	if den == 0 {
+		return m.Means[uid]
+	}
+	return num / den
+}
+
+func (m *SlopeOne) NumParams() int {
+	return len(m.Dev.Data) + len(m.Card.Data) + len(m.Means) + 1
+}
+
+func (m *SlopeOne) Summary() string {
+	return summarize("SlopeOne", m.Dataset, 0, m.NumParams(), *m.Config)
+}
+
+func (m *SlopeOne) GetDataset() *data.Dataset {
+	return m.Dataset
+}
@@ -0,0 +1,15 @@
+package train
+
+import (
+	"fmt"
+
+	"main/colfi/data"
+)
+
+// summarize formats the description shared by the Summary methods. Memory is
+// that of the learned parameters only, see EstimateMemory for the dataset.
+func summarize(name string, d *data.Dataset, numFactors, numParams int, config interface{}) string {
+	return fmt.Sprintf("%s: %d users, %d items, %d factors, %d parameters (%.1f MiB), config %+v",
+		name, len(d.UserMap), len(d.ItemMap), numFactors, numParams,
+		float64(numParams)*8/(1<<20), config)
+}
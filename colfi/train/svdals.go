@@ -0,0 +1,120 @@
+package train
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+
+	"gonum.org/v1/gonum/blas/blas64"
+	"gonum.org/v1/gonum/mat"
+
+	"main/colfi/data"
+)
+
+// SVDSolver selects how SVD.Fit trains the model.
+type SVDSolver int
+
+const (
+	// SGDSolver takes a stochastic gradient step per rating, as in Funk's
+	// original SVD.
+	SGDSolver SVDSolver = iota
+	// ALSSolver alternates between solving every user's bias and factors
+	// exactly with the items held fixed and every item's with the users held
+	// fixed, spreading the rows over NumWorkers goroutines. LR and
+	// InitSVD's refinement do not apply, and SampleRate and BatchSize are
+	// rejected; Reg is scaled by the number of ratings of each row
+	// (ALS-WR), so it usually wants to be larger than for SGD.
+	ALSSolver
+	// DSGDSolver is SGD parallelized by stratified blocks, so that, unlike
+	// Hogwild, its result depends on NumWorkers but not on scheduling; see
+	// fitDSGD.
+	DSGDSolver
+)
+
+func (s SVDSolver) validate() error {
+	if s < SGDSolver || s > DSGDSolver {
+		return fmt.Errorf("unknown SVDSolver %d", s)
+	}
+	return nil
+}
+
+// fitALS trains m for numEpochs of alternating least squares. Each row of
+// either side is solved for x = [b, p₁…p_f] against y = [1, q₁…q_f], with
+// the target of a rating being r minus the global mean and the fixed side's
+// bias.
+func (m *SVD) fitALS(numEpochs int) {
+	d := m.Dataset
+	byUser := data.GroupRatings(d.Users, m.PU.Rows)
+	byItem := data.GroupRatings(d.Items, m.QI.Rows)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d\n", epoch)
+		}
+		timer := startEpoch(m.Config.Instrument)
+		m.solveALSSide(m.PU, *m.BU, m.QI, *m.BI, byUser, d.Items)
+		m.solveALSSide(m.QI, *m.BI, m.PU, *m.BU, byItem, d.Users)
+		timer.done("SVD-ALS", epoch, len(d.Ratings))
+	}
+}
+
+// solveALSSide recomputes every row of x and its bias bx holding y and by
+// fixed. rows maps a row of x to the indices of its ratings and other maps a
+// rating index to the corresponding row of y.
+func (m *SVD) solveALSSide(x *Factors, bx []float64, y *Factors, by []float64, rows [][]int, other []int) {
+	numWorkers := m.Config.NumWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	dim := x.Cols + 1
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			a := mat.NewSymDense(dim, nil)
+			b := mat.NewVecDense(dim, nil)
+			yr := make([]float64, dim)
+			sol := make([]float64, dim)
+			var chol mat.Cholesky
+			var yv, sv mat.VecDense
+			yv.SetRawVector(blas64.Vector{N: dim, Inc: 1, Data: yr})
+			sv.SetRawVector(blas64.Vector{N: dim, Inc: 1, Data: sol})
+			bd := b.RawVector().Data
+			// Rows are striped over the workers so that the heavy rows at
+			// the start of a popularity-ordered dataset are shared out.
+			for r := w; r < len(rows); r += numWorkers {
+				idxs := rows[r]
+				if len(idxs) == 0 {
+					continue
+				}
+				a.Zero()
+				for f := range bd {
+					bd[f] = 0
+				}
+				reg := m.Config.Reg * float64(len(idxs))
+				for f := 0; f < dim; f++ {
+					a.SetSym(f, f, reg)
+				}
+				yr[0] = 1
+				for _, idx := range idxs {
+					o := other[idx]
+					copy(yr[1:], y.Row(o))
+					t := float64(m.Dataset.Ratings[idx]) - m.GlobalMean - by[o]
+					a.SymRankOne(a, 1, &yv)
+					for f, yf := range yr {
+						bd[f] += t * yf
+					}
+				}
+				if !chol.Factorize(a) {
+					log.Printf("ALS: skipping row %d, system is not positive definite", r)
+					continue
+				}
+				chol.SolveVecTo(&sv, b)
+				bx[r] = sol[0]
+				copy(x.Row(r), sol[1:])
+			}
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,120 @@
+package train
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Tracer starts spans, such as those of an OpenTelemetry trace.Tracer,
+// around data loading, training epochs, grid search trials and serving
+// requests. The interface is small so that an adapter to a tracing library
+// is a few lines and colfi does not depend on one; package oteltrace is the
+// one for OpenTelemetry. Spans nest through ctx.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttrs(attrs ...Attr)
+	RecordError(err error)
+	End()
+}
+
+// Attr is a span attribute. Values are strings, ints, float64s or bools.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+type tracerHolder struct{ Tracer }
+
+var tracer atomic.Pointer[tracerHolder]
+
+// SetTracer installs t as the tracer of the process, or removes it if t is
+// nil. Without a tracer, spans cost nothing.
+func SetTracer(t Tracer) {
+	if t == nil {
+		tracer.Store(nil)
+		return
+	}
+	tracer.Store(&tracerHolder{t})
+}
+
+// StartSpan starts a span with the installed tracer, if any, returning ctx
+// unchanged and a no-op span otherwise.
+func StartSpan(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	h := tracer.Load()
+	if h == nil {
+		return ctx, noopSpan{}
+	}
+	return h.Start(ctx, name, attrs...)
+}
+
+func tracing() bool {
+	return tracer.Load() != nil
+}
+
+// LogTracer logs every span with its duration and attributes when it ends,
+// for a quick look at where time goes without a tracing backend.
+type LogTracer struct{}
+
+func (LogTracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	return ctx, &logSpan{name: name, attrs: attrs, start: time.Now()}
+}
+
+type logSpan struct {
+	name  string
+	attrs []Attr
+	err   error
+	start time.Time
+}
+
+func (s *logSpan) SetAttrs(attrs ...Attr) {
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *logSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *logSpan) End() {
+	var b strings.Builder
+	fmt.Fprintf(&b, "span %s: %v", s.name, time.Since(s.start))
+	for _, a := range s.attrs {
+		fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+	}
+	if s.err != nil {
+		fmt.Fprintf(&b, " error=%q", s.err)
+	}
+	log.Print(b.String())
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttrs(...Attr)  {}
+func (noopSpan) RecordError(error) {}
+func (noopSpan) End()              {}
+
+// FitContext trains m for numEpochs inside a colfi.fit span with a
+// colfi.epoch child per epoch. Models are trained one epoch at a time for
+// that, as FitCheckpoints does, so only while a tracer is installed.
+func FitContext(ctx context.Context, m Model, numEpochs int) {
+	if !tracing() {
+		m.Fit(numEpochs)
+		return
+	}
+	ctx, span := StartSpan(ctx, "colfi.fit",
+		Attr{"model", fmt.Sprintf("%T", m)},
+		Attr{"epochs", numEpochs},
+		Attr{"ratings", len(m.GetDataset().Ratings)})
+	defer span.End()
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		_, es := StartSpan(ctx, "colfi.epoch", Attr{"epoch", epoch})
+		m.Fit(1)
+		es.End()
+	}
+}
@@ -0,0 +1,708 @@
+// Package train fits the recommendation models, from SVD and its variants
+// trained with SGD, ALS or DSGD to neighbourhood, factorization machine and
+// ensemble models, and saves them, in full or as the compact models package
+// infer scores.
+package train
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"main/colfi/data"
+	"main/colfi/internal/random"
+)
+
+// ratingBounds returns the configured rating scale, or the one of d if none
+// is set.
+func (c *SVDConfig) ratingBounds(d *data.Dataset) data.Bounds {
+	if c.Bounds != nil {
+		return *c.Bounds
+	}
+	return d.RatingBounds()
+}
+
+type Model interface {
+	Fit(numEpochs int)
+	Predict(u, i string) float64
+	GetDataset() *data.Dataset
+}
+
+// IDPredictor is implemented by models that can score the internal IDs of
+// their own dataset directly, skipping the string lookups done by Predict.
+// A negative ID stands for a user or item that was not seen in training.
+type IDPredictor interface {
+	PredictID(uid, iid int) float64
+}
+
+// PartialFitter is implemented by models that can learn from a single new
+// rating without being retrained from scratch.
+type PartialFitter interface {
+	PartialFit(u, i string, r float32)
+}
+
+// ItemAdder is implemented by models that can take a new item without
+// being retrained, starting from a factor vector derived elsewhere, e.g.
+// from its content.
+type ItemAdder interface {
+	AddItem(i string, vector []float64) error
+}
+
+type ScoredItem struct {
+	Item  string
+	Score float64
+}
+
+type SVD struct {
+	Dataset    *data.Dataset
+	PU         *Factors
+	QI         *Factors
+	BU         *[]float64
+	BI         *[]float64
+	GlobalMean float64
+	Bounds     data.Bounds
+	Config     *SVDConfig
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+}
+
+type SVDConfig struct {
+	NumFactors int
+	InitMean   float64
+	InitStdDev float64
+	LR         float64
+	Reg        float64
+	InitSVD    bool
+	// Init selects the distribution of the initial factors unless InitSVD
+	// is set.
+	Init InitStrategy
+	// InitBiases starts user and item biases from their shrunk mean
+	// deviations in the trainset instead of zero. HashedSVD ignores it.
+	InitBiases bool
+	// SampleRate, if between 0 and 1, trains each epoch on a random sample of
+	// that fraction of the ratings instead of all of them.
+	SampleRate float64
+	// Instrument logs the throughput and heap allocations of every epoch and
+	// publishes them through expvar.
+	Instrument bool
+	// Bounds overrides the rating scale, which is otherwise the range of the
+	// ratings in the trainset.
+	Bounds *data.Bounds
+	// Clip limits predictions to the rating scale.
+	Clip bool
+	// ItemBuckets is the number of item factor rows HashedSVD hashes item IDs
+	// into.
+	ItemBuckets int
+	// Solver selects how SVD is trained; the other models always use SGD.
+	Solver SVDSolver
+	// NumWorkers is how parallel SVD trains, and what zero means depends
+	// on the Solver:
+	//
+	//   - SGDSolver runs on NumWorkers goroutines, one if zero. Above one,
+	//     they run Hogwild style: each takes a share of the ratings and
+	//     updates the shared factors and biases without locks, which sparse
+	//     data keeps from colliding often. The result then depends on
+	//     scheduling, even with a fixed seed, and the race detector reports
+	//     the unsynchronized updates.
+	//   - ALSSolver solves rows on NumWorkers goroutines, runtime.NumCPU()
+	//     if zero.
+	//   - DSGDSolver partitions ratings into NumWorkers blocks per side and
+	//     trains them on as many goroutines, 8 if zero. Its result depends
+	//     on the number of blocks, so this does not follow the CPU count.
+	NumWorkers int
+	// MaxHistory, if set, caps the implicit feedback set of each SVD++ user
+	// at that many items, bounding the cost of a rating of a heavy user. The
+	// user's last ratings in the dataset are kept, which are the most recent
+	// if ratings were appended in time order, or a random sample of them if
+	// RandomHistory is set. All ratings are still trained on.
+	MaxHistory    int
+	RandomHistory bool
+	// BatchSize, if above one, trains SVD with mini-batch SGD, summing the
+	// gradients of that many ratings before each update. It only applies
+	// to SGDSolver and runs on one goroutine, so NumWorkers must not be
+	// above one.
+	BatchSize int
+	// NonNegative keeps the factors of SVD at or above zero, starting them
+	// from the absolute values of their initial draws and projecting them
+	// back after every SGD update, so that they combine additively and read
+	// as parts, as in NMF. Biases are unconstrained. It does not apply to
+	// ALSSolver and the other models ignore it.
+	NonNegative bool
+	// Source, if set, draws the model's initial factors and the ratings SGD
+	// samples instead of the default source of SetRand. A *rand.Rand will
+	// do. The model draws from it while it is built and trained, so it must
+	// not be shared with anything running concurrently. Models keep a copy
+	// of the config without it, which is what they save, so a loaded model
+	// draws from the default source.
+	Source  rand.Source
+	Verbose bool
+}
+
+func NewSVD(dataset *data.Dataset, config *SVDConfig) (Model, error) {
+	if config == nil {
+		config = &SVDConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .02
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	globalMean := data.Mean32(dataset.Ratings)
+	bu, bi := initBiases(dataset, globalMean, config)
+	pu, qi := initFactors(dataset, globalMean, config, random.Or(config.Source))
+	if config.NonNegative {
+		for _, f := range []*Factors{pu, qi} {
+			for k, v := range f.Data {
+				f.Data[k] = math.Abs(v)
+			}
+		}
+	}
+	saved := *config
+	saved.Source = nil
+	svd := &SVD{
+		Dataset:    dataset,
+		PU:         pu,
+		QI:         qi,
+		BU:         &bu,
+		BI:         &bi,
+		GlobalMean: globalMean,
+		Bounds:     config.ratingBounds(dataset),
+		Config:     &saved,
+		src:        config.Source,
+	}
+	return svd, nil
+}
+
+func (m *SVD) Fit(numEpochs int) {
+	if m.Config.Solver == ALSSolver {
+		m.fitALS(numEpochs)
+		return
+	}
+	if m.Config.Solver == DSGDSolver {
+		m.fitDSGD(numEpochs)
+		return
+	}
+	if m.Config.BatchSize > 1 {
+		m.fitMiniBatch(numEpochs)
+		return
+	}
+	numRatings := len(m.Dataset.Ratings)
+	numSamples := epochSamples(numRatings, m.Config.SampleRate)
+	numWorkers := m.Config.NumWorkers
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	rng := random.Or(m.src)
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d\n", epoch)
+		}
+		timer := startEpoch(m.Config.Instrument)
+		if numWorkers == 1 {
+			m.sgdSteps(0, numSamples, numRatings, numSamples, rng.Intn)
+		} else {
+			// Hogwild: every worker takes a contiguous share of the steps
+			// and updates the shared parameters without locking. Workers
+			// that subsample draw from their own source, seeded in turn
+			// from the model's, which is not safe for concurrent use.
+			var wg sync.WaitGroup
+			for w := 0; w < numWorkers; w++ {
+				var intn func(int) int
+				if numSamples != numRatings {
+					intn = rand.New(rand.NewSource(rng.Int63())).Intn
+				}
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					m.sgdSteps(w*numSamples/numWorkers, (w+1)*numSamples/numWorkers, numRatings, numSamples, intn)
+				}(w)
+			}
+			wg.Wait()
+		}
+		timer.done("SVD", epoch, numSamples)
+	}
+}
+
+// sgdSteps takes the SGD steps from to to of an epoch of numSamples steps
+// over numRatings ratings, sampling with intn.
+func (m *SVD) sgdSteps(from, to, numRatings, numSamples int, intn func(int) int) {
+	for n := from; n < to; n++ {
+		m.sgdStep(sampleIndex(n, numRatings, numSamples, intn))
+	}
+}
+
+// sgdStep takes an SGD step on the rating at idx.
+func (m *SVD) sgdStep(idx int) {
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	bu := *m.BU
+	bi := *m.BI
+	u := m.Dataset.Users[idx]
+	i := m.Dataset.Items[idx]
+	r := float64(m.Dataset.Ratings[idx])
+	pr := m.PU.Row(u)
+	qr := m.QI.Row(i)[:len(pr)]
+	dot := float64(0)
+	for f := range pr {
+		dot += pr[f] * qr[f]
+	}
+	err := r - (m.GlobalMean + bu[u] + bi[i] + dot)
+	bu[u] += lr * (err - reg*bu[u])
+	bi[i] += lr * (err - reg*bi[i])
+	for f := range pr {
+		puf := pr[f]
+		qif := qr[f]
+		pr[f] = puf + lr*(err*qif-reg*puf)
+		qr[f] = qif + lr*(err*puf-reg*qif)
+	}
+	if m.Config.NonNegative {
+		clampNegative(pr)
+		clampNegative(qr)
+	}
+}
+
+// PartialFit appends a rating to the model's dataset and takes one SGD step
+// on it, adding factors and biases for a user or item not seen before. It
+// must not run concurrently with Fit or predictions.
+func (m *SVD) PartialFit(u, i string, r float32) {
+	d := m.Dataset
+	d.Append(u, i, r)
+	uid, iid := d.Users[len(d.Users)-1], d.Items[len(d.Items)-1]
+	if uid == m.PU.Rows {
+		m.PU.addRow(m.sampler())
+		*m.BU = append(*m.BU, 0)
+	}
+	if iid == m.QI.Rows {
+		m.QI.addRow(m.sampler())
+		*m.BI = append(*m.BI, 0)
+	}
+
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	bu := *m.BU
+	bi := *m.BI
+	pr := m.PU.Row(uid)
+	qr := m.QI.Row(iid)
+	err := float64(r) - (m.GlobalMean + bu[uid] + bi[iid] + dot(pr, qr))
+	bu[uid] += lr * (err - reg*bu[uid])
+	bi[iid] += lr * (err - reg*bi[iid])
+	for f := range pr {
+		puf := pr[f]
+		qif := qr[f]
+		pr[f] = puf + lr*(err*qif-reg*puf)
+		qr[f] = qif + lr*(err*puf-reg*qif)
+	}
+	if m.Config.NonNegative {
+		clampNegative(pr)
+		clampNegative(qr)
+	}
+}
+
+// sampler draws the factors of a user or item first seen after training.
+func (m *SVD) sampler() func() float64 {
+	draw := m.Config.sampler(random.Or(m.src))
+	if !m.Config.NonNegative {
+		return draw
+	}
+	return func() float64 {
+		return math.Abs(draw())
+	}
+}
+
+// clampNegative sets the negative values of v to zero.
+func clampNegative(v []float64) {
+	for f, x := range v {
+		if x < 0 {
+			v[f] = 0
+		}
+	}
+}
+
+// AddItem registers an item with no ratings, the given factors and a zero
+// bias, so that it can be recommended at once. PartialFit and Fit refine it
+// like any other item as ratings of it arrive. With NonNegative, negative
+// values of the vector are taken as zero. A nil vector draws the
+// factors as for an item first seen by PartialFit. Like PartialFit, it must
+// not run concurrently with Fit or predictions.
+func (m *SVD) AddItem(i string, vector []float64) error {
+	if _, ok := m.Dataset.ItemMap[i]; ok {
+		return fmt.Errorf("item %q already exists", i)
+	}
+	if vector != nil && len(vector) != m.QI.Cols {
+		return fmt.Errorf("item vector has %d factors, want %d", len(vector), m.QI.Cols)
+	}
+	m.Dataset.AddItem(i)
+	if vector == nil {
+		m.QI.addRow(m.sampler())
+	} else {
+		m.QI.appendRow(vector)
+		if m.Config.NonNegative {
+			clampNegative(m.QI.Row(m.QI.Rows - 1))
+		}
+	}
+	*m.BI = append(*m.BI, 0)
+	return nil
+}
+
+func (m *SVD) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *SVD) PredictID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		p += (*m.BI)[iid]
+	}
+	if uid >= 0 && iid >= 0 {
+		p += dot(m.PU.Row(uid), m.QI.Row(iid))
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+// biasesID is PredictID without the latent factors.
+func (m *SVD) biasesID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		p += (*m.BI)[iid]
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+func (m *SVD) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data) + len(*m.BU) + len(*m.BI) + 1
+}
+
+func (m *SVD) Summary() string {
+	return summarize("SVD", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *SVD) GetDataset() *data.Dataset {
+	return m.Dataset
+}
+
+func (m *SVD) userVector(uid int) []float64 {
+	return m.PU.Row(uid)
+}
+
+func (m *SVD) itemVectors() (*Factors, []float64) {
+	return m.QI, *m.BI
+}
+
+type SVDpp struct {
+	Dataset    *data.Dataset
+	PU         *Factors
+	QI         *Factors
+	YJ         *Factors
+	BU         *[]float64
+	BI         *[]float64
+	IU         map[int][]int
+	GlobalMean float64
+	Bounds     data.Bounds
+	Config     *SVDConfig
+	// src is the Source of the config, nil after Load.
+	src rand.Source
+	// scratch pools the implicit feedback buffers used by concurrent
+	// predictions.
+	scratch sync.Pool
+}
+
+func NewSVDpp(dataset *data.Dataset, config *SVDConfig) (Model, error) {
+	if config == nil {
+		config = &SVDConfig{}
+	}
+	if config.NumFactors == 0 {
+		config.NumFactors = 50
+	}
+	if config.InitStdDev == 0 {
+		config.InitStdDev = .1
+	}
+	if config.LR == 0 {
+		config.LR = .005
+	}
+	if config.Reg == 0 {
+		config.Reg = .02
+	}
+	if err := dataset.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.Verbose {
+		log.Println("caching user ratings")
+	}
+	iu := make(map[int][]int, len(dataset.UserMap))
+	avgNum := len(dataset.Ratings) / len(dataset.Users)
+	for idx := range dataset.Ratings {
+		uid := dataset.Users[idx]
+		if _, ok := iu[uid]; !ok {
+			iu[uid] = make([]int, 0, avgNum)
+		}
+		iu[uid] = append(iu[uid], dataset.Items[idx])
+	}
+	rng := random.Or(config.Source)
+	if config.MaxHistory > 0 {
+		// In user order rather than map order, so that seeded runs agree.
+		for uid := 0; uid < len(dataset.UserMap); uid++ {
+			iu[uid] = truncateHistory(iu[uid], config.MaxHistory, config.RandomHistory, rng)
+		}
+	}
+
+	globalMean := data.Mean32(dataset.Ratings)
+	bu, bi := initBiases(dataset, globalMean, config)
+	pu, qi := initFactors(dataset, globalMean, config, rng)
+	saved := *config
+	saved.Source = nil
+	svd := &SVDpp{
+		Dataset:    dataset,
+		PU:         pu,
+		QI:         qi,
+		YJ:         config.randFactors(rng, len(dataset.ItemMap)),
+		BU:         &bu,
+		BI:         &bi,
+		IU:         iu,
+		GlobalMean: globalMean,
+		Bounds:     config.ratingBounds(dataset),
+		Config:     &saved,
+		src:        config.Source,
+	}
+	return svd, nil
+}
+
+// truncateHistory returns the last k of items, or k of them drawn from rng
+// at random, in a new slice so that the full history can be freed.
+func truncateHistory(items []int, k int, atRandom bool, rng *rand.Rand) []int {
+	if len(items) <= k {
+		return items
+	}
+	kept := make([]int, k)
+	if !atRandom {
+		copy(kept, items[len(items)-k:])
+		return kept
+	}
+	for n, idx := range rng.Perm(len(items))[:k] {
+		kept[n] = items[idx]
+	}
+	return kept
+}
+
+func (m *SVDpp) Fit(numEpochs int) {
+	numRatings := len(m.Dataset.Ratings)
+	numFactors := m.Config.NumFactors
+	reg := m.Config.Reg
+	lr := m.Config.LR
+	pu := m.PU
+	qi := m.QI
+	yj := m.YJ
+	bu := *m.BU
+	bi := *m.BI
+	iu := m.IU
+	globalMean := m.GlobalMean
+	numSamples := epochSamples(numRatings, m.Config.SampleRate)
+	rng := random.Or(m.src)
+	uImpFdb := make([]float64, numFactors)
+	errQ := make([]float64, numFactors)
+
+	for epoch := 0; epoch < numEpochs; epoch++ {
+		if m.Config.Verbose {
+			log.Printf("running epoch %d", epoch)
+		}
+		timer := startEpoch(m.Config.Instrument)
+		for n := 0; n < numSamples; n++ {
+			idx := sampleIndex(n, numRatings, numSamples, rng.Intn)
+			u := m.Dataset.Users[idx]
+			i := m.Dataset.Items[idx]
+			r := float64(m.Dataset.Ratings[idx])
+
+			for f := range uImpFdb {
+				uImpFdb[f] = 0
+			}
+			sqrtU := math.Sqrt(float64(len(iu[u])))
+			for _, item := range iu[u] {
+				yr := yj.Row(item)[:len(uImpFdb)]
+				for f := range uImpFdb {
+					uImpFdb[f] += yr[f] / sqrtU
+				}
+			}
+
+			pr := pu.Row(u)[:numFactors]
+			qr := qi.Row(i)[:numFactors]
+			dot := float64(0)
+			for f := range pr {
+				dot += (pr[f] + uImpFdb[f]) * qr[f]
+			}
+			err := r - (globalMean + bu[u] + bi[i] + dot)
+			bu[u] += lr * (err - reg*bu[u])
+			bi[i] += lr * (err - reg*bi[i])
+
+			for f := range pr {
+				puf := pr[f]
+				qif := qr[f]
+				pr[f] = puf + lr*(err*qif-reg*puf)
+				qr[f] = qif + lr*(err*(puf+uImpFdb[f])-reg*qif)
+				errQ[f] = err * qif / sqrtU
+			}
+			for _, item := range iu[u] {
+				yr := yj.Row(item)[:len(errQ)]
+				for f := range errQ {
+					yr[f] += lr * (errQ[f] - reg*yr[f])
+				}
+			}
+		}
+		timer.done("SVDpp", epoch, numSamples)
+	}
+}
+
+func (m *SVDpp) Predict(u, i string) float64 {
+	return m.PredictID(m.Dataset.LookupIDs(u, i))
+}
+
+func (m *SVDpp) PredictID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		p += (*m.BI)[iid]
+	}
+	if uid >= 0 && iid >= 0 {
+		buf := m.getScratch()
+		uImp := *buf
+		for f := range uImp {
+			uImp[f] = 0
+		}
+		for _, item := range m.IU[uid] {
+			for f, y := range m.YJ.Row(item) {
+				uImp[f] += y
+			}
+		}
+		norm := 1.0 / math.Sqrt(float64(len(m.IU[uid])))
+		pr := m.PU.Row(uid)
+		for f, q := range m.QI.Row(iid) {
+			p += pr[f] * (uImp[f]*norm + q)
+		}
+		m.scratch.Put(buf)
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+// biasesID is PredictID without the latent factors.
+func (m *SVDpp) biasesID(uid, iid int) float64 {
+	p := m.GlobalMean
+	if uid >= 0 {
+		p += (*m.BU)[uid]
+	}
+	if iid >= 0 {
+		p += (*m.BI)[iid]
+	}
+	if m.Config.Clip {
+		p = m.Bounds.Clip(p)
+	}
+	return p
+}
+
+func (m *SVDpp) getScratch() *[]float64 {
+	if buf, ok := m.scratch.Get().(*[]float64); ok {
+		return buf
+	}
+	buf := make([]float64, m.Config.NumFactors)
+	return &buf
+}
+
+func (m *SVDpp) NumParams() int {
+	return len(m.PU.Data) + len(m.QI.Data) + len(m.YJ.Data) + len(*m.BU) + len(*m.BI) + 1
+}
+
+func (m *SVDpp) Summary() string {
+	return summarize("SVD++", m.Dataset, m.Config.NumFactors, m.NumParams(), *m.Config)
+}
+
+func (m *SVDpp) GetDataset() *data.Dataset {
+	return m.Dataset
+}
+
+func (m *SVDpp) userVector(uid int) []float64 {
+	uImp := make([]float64, m.Config.NumFactors)
+	for _, item := range m.IU[uid] {
+		for f, y := range m.YJ.Row(item) {
+			uImp[f] += y
+		}
+	}
+	norm := 1.0 / math.Sqrt(float64(len(m.IU[uid])))
+	for f, p := range m.PU.Row(uid) {
+		uImp[f] = uImp[f]*norm + p
+	}
+	return uImp
+}
+
+func (m *SVDpp) itemVectors() (*Factors, []float64) {
+	return m.QI, *m.BI
+}
+
+func initFactors(d *data.Dataset, globalMean float64, config *SVDConfig, rng *rand.Rand) (*Factors, *Factors) {
+	if config.InitSVD {
+		if config.Verbose {
+			log.Println("initializing factors from truncated SVD")
+		}
+		return truncatedSVD(d, globalMean, config.NumFactors, rng)
+	}
+	return config.randFactors(rng, len(d.UserMap)), config.randFactors(rng, len(d.ItemMap))
+}
+
+func epochSamples(numRatings int, rate float64) int {
+	if rate > 0 && rate < 1 {
+		return int(math.Ceil(rate * float64(numRatings)))
+	}
+	return numRatings
+}
+
+// sampleIndex returns the rating to visit at step n of an epoch: ratings are
+// visited in order when the whole dataset is used and drawn uniformly at
+// random by intn when it is subsampled.
+func sampleIndex(n, numRatings, numSamples int, intn func(int) int) int {
+	if numSamples == numRatings {
+		return n
+	}
+	return intn(numRatings)
+}
+
+func topN(s []ScoredItem, n int) []ScoredItem {
+	sort.Slice(s, func(a, b int) bool {
+		return s[a].Score > s[b].Score
+	})
+	if n > 0 && n < len(s) {
+		s = s[:n]
+	}
+	return s
+}
@@ -0,0 +1,147 @@
+package train
+
+import (
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+
+	"main/colfi/data"
+)
+
+const (
+	tsvdOversample = 10
+	tsvdPowerIters = 2
+)
+
+// truncatedSVD computes a rank-k randomized SVD (Halko et al.) of the sparse
+// rating matrix centered on globalMean, with missing entries treated as zero.
+// It returns user and item factors scaled by the square root of the singular
+// values so that their dot products approximate the centered ratings.
+func truncatedSVD(d *data.Dataset, globalMean float64, k int, rng *rand.Rand) (*Factors, *Factors) {
+	nUsers := len(d.UserMap)
+	nItems := len(d.ItemMap)
+	l := k + tsvdOversample
+	if l > nUsers {
+		l = nUsers
+	}
+	if l > nItems {
+		l = nItems
+	}
+
+	omega := randFactors(rng, 0, 1, nItems, l).dense()
+	y := mat.NewDense(nUsers, l, nil)
+	sparseMul(d, globalMean, omega, y)
+	orthonormalize(y)
+	z := mat.NewDense(nItems, l, nil)
+	for q := 0; q < tsvdPowerIters; q++ {
+		sparseMulT(d, globalMean, y, z)
+		orthonormalize(z)
+		y.Zero()
+		sparseMul(d, globalMean, z, y)
+		orthonormalize(y)
+	}
+
+	// B = QᵀA is l x nItems; computed as (AᵀQ)ᵀ.
+	sparseMulT(d, globalMean, y, z)
+	var svd mat.SVD
+	if !svd.Factorize(z.T(), mat.SVDThin) {
+		return randFactors(rng, 0, .1, nUsers, k), randFactors(rng, 0, .1, nItems, k)
+	}
+	var ub, v mat.Dense
+	svd.UTo(&ub)
+	svd.VTo(&v)
+	s := svd.Values(nil)
+
+	var u mat.Dense
+	u.Mul(y, &ub)
+	pu := newFactors(nUsers, k)
+	qi := newFactors(nItems, k)
+	for f := 0; f < k && f < len(s); f++ {
+		scale := math.Sqrt(s[f])
+		for r := 0; r < nUsers; r++ {
+			pu.Row(r)[f] = u.At(r, f) * scale
+		}
+		for r := 0; r < nItems; r++ {
+			qi.Row(r)[f] = v.At(r, f) * scale
+		}
+	}
+	// Any factors beyond the attainable rank get small random values so SGD
+	// can still make use of them.
+	for f := len(s); f < k; f++ {
+		for r := 0; r < nUsers; r++ {
+			pu.Row(r)[f] = rng.NormFloat64() * .01
+		}
+		for r := 0; r < nItems; r++ {
+			qi.Row(r)[f] = rng.NormFloat64() * .01
+		}
+	}
+	return pu, qi
+}
+
+// sparseMul computes dst = A * x where A is the centered user x item rating matrix.
+func sparseMul(d *data.Dataset, globalMean float64, x, dst *mat.Dense) {
+	for idx, r := range d.Ratings {
+		a := float64(r) - globalMean
+		xr := x.RawRowView(d.Items[idx])
+		dr := dst.RawRowView(d.Users[idx])
+		for c := range dr {
+			dr[c] += a * xr[c]
+		}
+	}
+}
+
+// sparseMulT computes dst = Aᵀ * x.
+func sparseMulT(d *data.Dataset, globalMean float64, x, dst *mat.Dense) {
+	dst.Zero()
+	for idx, r := range d.Ratings {
+		a := float64(r) - globalMean
+		xr := x.RawRowView(d.Users[idx])
+		dr := dst.RawRowView(d.Items[idx])
+		for c := range dr {
+			dr[c] += a * xr[c]
+		}
+	}
+}
+
+// orthonormalize replaces the columns of m with an orthonormal basis of their
+// span using Gram-Schmidt with reorthogonalization, walking rows so that the
+// tall matrices involved are read contiguously. Columns that turn out to be
+// linearly dependent are set to zero.
+func orthonormalize(m *mat.Dense) {
+	rows, cols := m.Dims()
+	dots := make([]float64, cols)
+	for c := 0; c < cols; c++ {
+		for pass := 0; pass < 2; pass++ {
+			for p := range dots[:c] {
+				dots[p] = 0
+			}
+			for r := 0; r < rows; r++ {
+				row := m.RawRowView(r)
+				for p := 0; p < c; p++ {
+					dots[p] += row[c] * row[p]
+				}
+			}
+			for r := 0; r < rows; r++ {
+				row := m.RawRowView(r)
+				for p := 0; p < c; p++ {
+					row[c] -= dots[p] * row[p]
+				}
+			}
+		}
+		var norm float64
+		for r := 0; r < rows; r++ {
+			v := m.At(r, c)
+			norm += v * v
+		}
+		norm = math.Sqrt(norm)
+		for r := 0; r < rows; r++ {
+			row := m.RawRowView(r)
+			if norm > 1e-10 {
+				row[c] /= norm
+			} else {
+				row[c] = 0
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package train
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"main/colfi/data"
+	"main/colfi/infer"
+	"main/colfi/internal/random"
+)
+
+// CandidateGenerator cheaply proposes up to n items worth scoring for a user.
+type CandidateGenerator interface {
+	Candidates(u string, n int) []string
+}
+
+// factorizer is implemented by models whose scores are (up to a user
+// constant) the dot product of a user vector and an item vector plus an item
+// bias, which is what the ANN candidate generator indexes.
+type factorizer interface {
+	userVector(uid int) []float64
+	itemVectors() (*Factors, []float64)
+}
+
+type PopularityCandidates struct {
+	items []string
+}
+
+func NewPopularityCandidates(dataset *data.Dataset) *PopularityCandidates {
+	counts := dataset.ItemCounts()
+	items := append([]string(nil), dataset.ItemIDs...)
+	sort.Slice(items, func(a, b int) bool {
+		return counts[dataset.ItemMap[items[a]]] > counts[dataset.ItemMap[items[b]]]
+	})
+	return &PopularityCandidates{items}
+}
+
+func (g *PopularityCandidates) Candidates(u string, n int) []string {
+	if n > len(g.items) {
+		n = len(g.items)
+	}
+	return g.items[:n]
+}
+
+// ANNCandidates finds items with a large inner product with the user vector
+// of a factor model using random-hyperplane LSH. Buckets at Hamming distance
+// one from the query are probed too, and the items found are ranked exactly.
+type ANNCandidates struct {
+	Config  *ANNConfig
+	model   factorizer
+	dataset *data.Dataset
+	index   *infer.Index
+}
+
+type ANNConfig struct {
+	NumTables int
+	NumBits   int
+	// Source, if set, draws the random planes instead of the default
+	// source of SetRand. Items ANNCandidates samples to make up for
+	// too few collisions are drawn from the default source, as candidates
+	// are generated concurrently.
+	Source rand.Source
+}
+
+func NewANNCandidates(m Model, config *ANNConfig) (*ANNCandidates, error) {
+	f, ok := m.(factorizer)
+	if !ok {
+		return nil, fmt.Errorf("%T does not expose user and item factors", m)
+	}
+	config = annDefaults(config)
+	qi, bi := f.itemVectors()
+	return &ANNCandidates{
+		Config:  config,
+		model:   f,
+		dataset: m.GetDataset(),
+		index:   buildIndex(qi, bi, config),
+	}, nil
+}
+
+func annDefaults(config *ANNConfig) *ANNConfig {
+	if config == nil {
+		config = &ANNConfig{}
+	}
+	if config.NumTables == 0 {
+		config.NumTables = 8
+	}
+	if config.NumBits == 0 {
+		config.NumBits = 12
+	}
+	return config
+}
+
+// buildIndex hashes the item vectors qi, with biases bi if not nil, into an
+// LSH index with random planes.
+func buildIndex(qi *Factors, bi []float64, config *ANNConfig) *infer.Index {
+	rng := random.Or(config.Source)
+	planes := make([]*infer.Factors, config.NumTables)
+	for t := range planes {
+		planes[t] = inferFactors(randFactors(rng, 0, 1, config.NumBits, qi.Cols+1))
+	}
+	index := infer.NewIndex(planes)
+	for i := 0; i < qi.Rows; i++ {
+		var b float64
+		if bi != nil {
+			b = bi[i]
+		}
+		index.Insert(i, qi.Row(i), b)
+	}
+	return index
+}
+
+func (g *ANNCandidates) Candidates(u string, n int) []string {
+	uid, ok := g.dataset.UserMap[u]
+	if !ok {
+		return nil
+	}
+	pu := g.model.userVector(uid)
+	seen := make(map[int]bool)
+	for _, i := range g.index.Probe(pu) {
+		seen[i] = true
+	}
+	// Too few collisions: fall back to a random sample so that callers
+	// always get something to rank.
+	for len(seen) < n && len(seen) < len(g.dataset.ItemIDs) {
+		seen[random.Or(nil).Intn(len(g.dataset.ItemIDs))] = true
+	}
+
+	qi, bi := g.model.itemVectors()
+	scores := make([]ScoredItem, 0, len(seen))
+	for i := range seen {
+		s := dot(pu, qi.Row(i))
+		if bi != nil {
+			s += bi[i]
+		}
+		scores = append(scores, ScoredItem{g.dataset.ItemIDs[i], s})
+	}
+	scores = topN(scores, n)
+	out := make([]string, len(scores))
+	for k, s := range scores {
+		out[k] = s.Item
+	}
+	return out
+}
+
+// TwoStage serves top-N lists by asking a fast generator for candidates and
+// scoring only those with a slower, more accurate ranker.
+type TwoStage struct {
+	Generator CandidateGenerator
+	Ranker    Model
+	Config    *TwoStageConfig
+	seen      map[int]map[int]bool
+}
+
+type TwoStageConfig struct {
+	NumCandidates int
+	// ExcludeSeen drops items the user rated in the ranker's training data.
+	ExcludeSeen bool
+}
+
+func NewTwoStage(generator CandidateGenerator, ranker Model, config *TwoStageConfig) *TwoStage {
+	if config == nil {
+		config = &TwoStageConfig{}
+	}
+	if config.NumCandidates == 0 {
+		config.NumCandidates = 500
+	}
+	ts := &TwoStage{
+		Generator: generator,
+		Ranker:    ranker,
+		Config:    config,
+	}
+	if config.ExcludeSeen {
+		d := ranker.GetDataset()
+		ts.seen = make(map[int]map[int]bool, len(d.UserMap))
+		for idx, u := range d.Users {
+			if ts.seen[u] == nil {
+				ts.seen[u] = make(map[int]bool)
+			}
+			ts.seen[u][d.Items[idx]] = true
+		}
+	}
+	return ts
+}
+
+func (ts *TwoStage) Recommend(u string, n int) []ScoredItem {
+	d := ts.Ranker.GetDataset()
+	uid, uok := d.UserMap[u]
+	candidates := ts.Generator.Candidates(u, ts.Config.NumCandidates)
+	scores := make([]ScoredItem, 0, len(candidates))
+	for _, item := range candidates {
+		if ts.seen != nil && uok {
+			if iid, ok := d.ItemMap[item]; ok && ts.seen[uid][iid] {
+				continue
+			}
+		}
+		scores = append(scores, ScoredItem{item, ts.Ranker.Predict(u, item)})
+	}
+	return topN(scores, n)
+}
@@ -0,0 +1,234 @@
+package train
+
+import (
+	"fmt"
+	"math"
+)
+
+type param struct {
+	name  string
+	value float64
+}
+
+func checkNonNegative(params ...param) error {
+	for _, p := range params {
+		if math.IsNaN(p.value) || math.IsInf(p.value, 0) || p.value < 0 {
+			return fmt.Errorf("%s must be a non-negative number, got %v", p.name, p.value)
+		}
+	}
+	return nil
+}
+
+func (c *SVDConfig) validate() error {
+	if err := c.Init.validate(); err != nil {
+		return err
+	}
+	if err := c.Solver.validate(); err != nil {
+		return err
+	}
+	if c.NonNegative && c.Solver == ALSSolver {
+		return fmt.Errorf("NonNegative needs SGDSolver or DSGDSolver")
+	}
+	if c.Solver == SGDSolver && c.BatchSize > 1 && c.NumWorkers > 1 {
+		return fmt.Errorf("BatchSize cannot be combined with NumWorkers: mini-batch SGD runs on one goroutine")
+	}
+	if c.Solver == ALSSolver && (c.BatchSize > 1 || c.SampleRate > 0 && c.SampleRate < 1) {
+		return fmt.Errorf("ALSSolver does not support BatchSize or SampleRate")
+	}
+	if c.Solver == DSGDSolver && (c.BatchSize > 1 || c.SampleRate > 0 && c.SampleRate < 1) {
+		return fmt.Errorf("DSGDSolver does not support BatchSize or SampleRate")
+	}
+	if c.Bounds != nil {
+		if err := c.Bounds.Validate(); err != nil {
+			return err
+		}
+	}
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+		param{"ItemBuckets", float64(c.ItemBuckets)},
+		param{"NumWorkers", float64(c.NumWorkers)},
+		param{"MaxHistory", float64(c.MaxHistory)},
+		param{"BatchSize", float64(c.BatchSize)},
+	)
+}
+
+func (c *EALSConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"Reg", c.Reg},
+		param{"W", c.W},
+		param{"C0", c.C0},
+		param{"Alpha", c.Alpha},
+	)
+}
+
+func (c *ImplicitALSConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"Reg", c.Reg},
+		param{"Alpha", c.Alpha},
+		param{"CGSteps", float64(c.CGSteps)},
+	)
+}
+
+func (c *NMFConfig) validate() error {
+	if c.InitHigh <= c.InitLow {
+		return fmt.Errorf("InitHigh must be above InitLow, got %v and %v", c.InitHigh, c.InitLow)
+	}
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitLow", c.InitLow},
+		param{"InitHigh", c.InitHigh},
+		param{"RegU", c.RegU},
+		param{"RegI", c.RegI},
+	)
+}
+
+func (c *BPRConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+		param{"MaxSampled", float64(c.MaxSampled)},
+	)
+}
+
+func (c *FFMConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+	)
+}
+
+func (c *FMConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+	)
+}
+
+func (c *LogisticMFConfig) validate() error {
+	if c.Threshold != nil && (math.IsNaN(*c.Threshold) || math.IsInf(*c.Threshold, 0)) {
+		return fmt.Errorf("Threshold must be finite, got %v", *c.Threshold)
+	}
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+	)
+}
+
+func (c *IntegratedConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+		param{"NeighborLR", c.NeighborLR},
+		param{"NeighborReg", c.NeighborReg},
+		param{"K", float64(c.K)},
+		param{"MinSupport", float64(c.MinSupport)},
+		param{"NumWorkers", float64(c.NumWorkers)},
+	)
+}
+
+func (c *EASEConfig) validate() error {
+	return checkNonNegative(param{"Reg", c.Reg})
+}
+
+func (c *NCFConfig) validate() error {
+	for l, n := range c.Layers {
+		if n <= 0 {
+			return fmt.Errorf("Layers[%d] must be positive, got %d", l, n)
+		}
+	}
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+	)
+}
+
+func (c *Item2VecConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"LR", c.LR},
+		param{"Window", float64(c.Window)},
+		param{"NumNegatives", float64(c.NumNegatives)},
+		param{"HistoryLen", float64(c.HistoryLen)},
+		param{"Decay", c.Decay},
+	)
+}
+
+func (c *EnsembleConfig) validate() error {
+	return checkNonNegative(
+		param{"Reg", c.Reg},
+		param{"MinSegmentSize", float64(c.MinSegmentSize)},
+	)
+}
+
+func (c *KNNConfig) validate() error {
+	if err := c.Similarity.validate(); err != nil {
+		return err
+	}
+	return checkNonNegative(
+		param{"K", float64(c.K)},
+		param{"MinSupport", float64(c.MinSupport)},
+		param{"NumWorkers", float64(c.NumWorkers)},
+	)
+}
+
+func (c *SlopeOneConfig) validate() error {
+	return checkNonNegative(param{"NumWorkers", float64(c.NumWorkers)})
+}
+
+func (c *BaselineConfig) validate() error {
+	if err := c.Solver.validate(); err != nil {
+		return err
+	}
+	return checkNonNegative(
+		param{"LR", c.LR},
+		param{"Reg", c.Reg},
+		param{"RegU", c.RegU},
+		param{"RegI", c.RegI},
+	)
+}
+
+func (c *ExploreConfig) validate() error {
+	if err := c.Policy.validate(); err != nil {
+		return err
+	}
+	if c.Epsilon > 1 {
+		return fmt.Errorf("Epsilon must be at most 1, got %g", c.Epsilon)
+	}
+	return checkNonNegative(
+		param{"Epsilon", c.Epsilon},
+		param{"StdDev", c.StdDev},
+		param{"Samples", float64(c.Samples)},
+	)
+}
+
+func (c *PMFConfig) validate() error {
+	return checkNonNegative(
+		param{"NumFactors", float64(c.NumFactors)},
+		param{"InitStdDev", c.InitStdDev},
+		param{"NoisePrecision", c.NoisePrecision},
+		param{"PriorPrecision", c.PriorPrecision},
+		param{"BurnIn", float64(c.BurnIn)},
+		param{"Samples", float64(c.Samples)},
+		param{"NumWorkers", float64(c.NumWorkers)},
+	)
+}
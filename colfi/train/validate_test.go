@@ -0,0 +1,33 @@
+package train
+
+import "testing"
+
+func TestSVDConfigRejectsIgnoredOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config SVDConfig
+	}{
+		{"mini-batch Hogwild", SVDConfig{BatchSize: 32, NumWorkers: 4}},
+		{"mini-batch ALS", SVDConfig{Solver: ALSSolver, BatchSize: 32}},
+		{"subsampled ALS", SVDConfig{Solver: ALSSolver, SampleRate: .5}},
+		{"mini-batch DSGD", SVDConfig{Solver: DSGDSolver, BatchSize: 32}},
+		{"subsampled DSGD", SVDConfig{Solver: DSGDSolver, SampleRate: .5}},
+	} {
+		if err := tc.config.validate(); err == nil {
+			t.Errorf("%s: accepted %+v", tc.name, tc.config)
+		}
+	}
+	for _, tc := range []struct {
+		name   string
+		config SVDConfig
+	}{
+		{"mini-batch", SVDConfig{BatchSize: 32, NumWorkers: 1}},
+		{"Hogwild", SVDConfig{BatchSize: 1, NumWorkers: 4}},
+		{"parallel ALS", SVDConfig{Solver: ALSSolver, NumWorkers: 4}},
+		{"DSGD blocks", SVDConfig{Solver: DSGDSolver, NumWorkers: 4}},
+	} {
+		if err := tc.config.validate(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
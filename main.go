@@ -2,16 +2,24 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/olekukonko/tablewriter"
 
-	"main/colfi"
+	"main/colfi/data"
+	"main/colfi/eval"
+	"main/colfi/train"
+	"main/serve"
 )
 
 type Prediction struct {
@@ -20,36 +28,709 @@ type Prediction struct {
 }
 
 func main() {
-	u, i, r := loadRatings("host="+os.Getenv("PGHOST"), 10000000)
-	trainset, testset, err := colfi.DatasetsFromSlices(u, i, r, 0.2)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "train":
+		runTrain(os.Args[2:])
+	case "gridsearch":
+		runGridSearch(os.Args[2:])
+	case "golden":
+		runGolden(os.Args[2:])
+	case "evaluate":
+		runEvaluate(os.Args[2:])
+	case "compare":
+		runCompare(os.Args[2:])
+	case "serve":
+		runServe(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s train|gridsearch|compare|golden|evaluate|serve [flags]\n", os.Args[0])
+	os.Exit(2)
+}
+
+func runTrain(args []string) {
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	limit := fs.Int("limit", 10000000, "maximum number of ratings to load")
+	numEpochs := fs.Int("epochs", 20, "number of training epochs")
+	numFactors := fs.Int("factors", 20, "number of latent factors")
+	dropShills := fs.Bool("drop-shills", false, "exclude users flagged by shill detection")
+	out := fs.String("o", "", "write the trained model to `file`")
+	compact := fs.String("compact", "", "write the compact model for inference-only builds to `file`")
+	bf16 := fs.Bool("bf16", false, "store the factors of the compact model and bundle as bfloat16")
+	bundle := fs.String("bundle", "", "write the compact model with a prebuilt ANN index over its items to `file`")
+	jsonOut := fs.Bool("json", false, "print the result as JSON")
+	dryRun := fs.Float64("dry-run", 0, "instead of training, time one epoch on this `share` of the ratings and print the expected runtime and memory")
+	seed := fs.Int64("seed", 0, "seed for all random draws, 0 for a random run")
+	als := fs.Bool("als", false, "train with alternating least squares instead of SGD")
+	dsgd := fs.Bool("dsgd", false, "train with SGD on stratified blocks of ratings, reproducibly for a given -workers")
+	batchSize := fs.Int("batch-size", 1, "ratings per SGD update")
+	workers := fs.Int("workers", 0, "goroutines SGD runs on without locks (Hogwild), ALS on or DSGD partitions into, 0 for one for SGD, one per CPU for ALS and 8 for DSGD")
+	objective := fs.Bool("objective", false, "report the data loss and regularization terms of the objective after every epoch")
+	prof := addProfileFlags(fs)
+	fs.Parse(args)
+	defer prof.start()()
+	if *seed != 0 {
+		train.Seed(*seed)
+	}
+
+	ctx, span := train.StartSpan(context.Background(), "train")
+	defer span.End()
+	u, i, r := loadRatings(ctx, "host="+os.Getenv("PGHOST"), *limit)
+	dataset := data.NewDataset()
+	for idx := range r {
+		dataset.Append(u[idx], i[idx], r[idx])
+	}
+	shills := data.DetectShills(dataset, nil)
+	if len(shills) > 0 {
+		log.Printf("%d users flagged as shills, the most active with %d ratings", len(shills), shills[0].Ratings)
+		if *dropShills {
+			dataset = dataset.WithoutUsers(shills)
+		}
+	}
+	config := &train.SVDConfig{
+		NumFactors: *numFactors,
+		BatchSize:  *batchSize,
+		NumWorkers: *workers,
+		Instrument: true,
+		Verbose:    true,
+	}
+	if *als {
+		config.Solver = train.ALSSolver
+	}
+	if *dsgd {
+		config.Solver = train.DSGDSolver
+	}
+	if *dryRun > 0 {
+		e, err := eval.DryRun(train.NewSVD, dataset, config, *numEpochs, *dryRun)
+		if err != nil {
+			log.Fatalf("dry run failed: %v", err)
+		}
+		if *jsonOut {
+			printJSON(dryRunResult{
+				Ratings:        e.Ratings,
+				SampledRatings: e.SampledRatings,
+				SetupSeconds:   e.Setup.Seconds(),
+				EpochSeconds:   e.Epoch.Seconds(),
+				TotalSeconds:   e.Total.Seconds(),
+				MemoryBytes:    e.Memory,
+			})
+		} else {
+			fmt.Println(e)
+		}
+		return
+	}
+	m, err := train.NewSVD(dataset, config)
+	if err != nil {
+		log.Fatalf("error creating model: %v", err)
+	}
+	start := time.Now()
+	var objectives []train.Objective
+	if *objective {
+		if objectives, err = train.FitObjective(m, *numEpochs); err != nil {
+			log.Fatalf("error training model: %v", err)
+		}
+		for _, o := range objectives {
+			log.Print(o)
+		}
+	} else {
+		train.FitContext(ctx, m, *numEpochs)
+	}
+	trainedAt := time.Now().UTC()
+	elapsed := trainedAt.Sub(start)
+	log.Printf("training took %s", elapsed)
+
+	if *out != "" {
+		if err := train.SaveFileMetadata(*out, m, train.Metadata{TrainedAt: trainedAt}); err != nil {
+			log.Fatalf("error writing model: %v", err)
+		}
+	}
+	if *compact != "" {
+		c, err := train.NewCompact(m)
+		if err != nil {
+			log.Fatalf("error compacting model: %v", err)
+		}
+		if *bf16 {
+			c.ToBF16()
+		}
+		f, err := os.Create(*compact)
+		if err != nil {
+			log.Fatalf("error writing compact model: %v", err)
+		}
+		if err := train.SaveCompact(f, c); err != nil {
+			log.Fatalf("error writing compact model: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("error writing compact model: %v", err)
+		}
+	}
+	if *bundle != "" {
+		b, err := train.NewBundle(m, nil)
+		if err != nil {
+			log.Fatalf("error bundling model: %v", err)
+		}
+		if *bf16 {
+			b.Model.ToBF16()
+		}
+		f, err := os.Create(*bundle)
+		if err != nil {
+			log.Fatalf("error writing bundle: %v", err)
+		}
+		if err := train.SaveBundle(f, b); err != nil {
+			log.Fatalf("error writing bundle: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("error writing bundle: %v", err)
+		}
+	}
+	if *jsonOut {
+		r := trainResult{
+			Epochs:         *numEpochs,
+			Factors:        *numFactors,
+			Users:          len(dataset.UserMap),
+			Items:          len(dataset.ItemMap),
+			Ratings:        len(dataset.Ratings),
+			FlaggedShills:  len(shills),
+			DroppedShills:  *dropShills,
+			RuntimeSeconds: elapsed.Seconds(),
+			Model:          *out,
+			Compact:        *compact,
+			Bundle:         *bundle,
+		}
+		for _, o := range objectives {
+			r.Objective = append(r.Objective, objectiveResult{
+				Epoch:     o.Epoch,
+				Total:     o.Total(),
+				DataLoss:  o.DataLoss,
+				BiasReg:   o.BiasReg,
+				FactorReg: o.FactorReg,
+			})
+		}
+		printJSON(r)
+	}
+}
+
+type trainResult struct {
+	Epochs         int               `json:"epochs"`
+	Factors        int               `json:"factors"`
+	Users          int               `json:"users"`
+	Items          int               `json:"items"`
+	Ratings        int               `json:"ratings"`
+	FlaggedShills  int               `json:"flagged_shills"`
+	DroppedShills  bool              `json:"dropped_shills"`
+	RuntimeSeconds float64           `json:"runtime_seconds"`
+	Model          string            `json:"model,omitempty"`
+	Compact        string            `json:"compact,omitempty"`
+	Bundle         string            `json:"bundle,omitempty"`
+	Objective      []objectiveResult `json:"objective,omitempty"`
+}
+
+type objectiveResult struct {
+	Epoch     int     `json:"epoch"`
+	Total     float64 `json:"total"`
+	DataLoss  float64 `json:"data_loss"`
+	BiasReg   float64 `json:"bias_reg"`
+	FactorReg float64 `json:"factor_reg"`
+}
+
+type dryRunResult struct {
+	Ratings        int     `json:"ratings"`
+	SampledRatings int     `json:"sampled_ratings"`
+	SetupSeconds   float64 `json:"setup_seconds"`
+	EpochSeconds   float64 `json:"epoch_seconds"`
+	TotalSeconds   float64 `json:"total_seconds"`
+	MemoryBytes    int64   `json:"memory_bytes"`
+}
+
+// evalResult is the JSON form of eval.EvalResult.
+type evalResult struct {
+	RMSE         float64 `json:"rmse"`
+	RMSEKnown    float64 `json:"rmse_known"`
+	N            int     `json:"n"`
+	UnknownUsers int     `json:"unknown_users"`
+	UnknownItems int     `json:"unknown_items"`
+	Unseen       int     `json:"unseen"`
+}
+
+func newEvalResult(e eval.EvalResult) evalResult {
+	return evalResult{
+		RMSE:         e.All,
+		RMSEKnown:    e.Known,
+		N:            e.Stats.N,
+		UnknownUsers: e.Stats.UnknownUsers,
+		UnknownItems: e.Stats.UnknownItems,
+		Unseen:       e.Stats.Unseen,
+	}
+}
+
+// offPolicyResult reports the estimates of evaluate -logged. SNIPS is
+// absent if no logged item was in the model's lists.
+type offPolicyResult struct {
+	SNIPSRMSE float64  `json:"snips_rmse"`
+	Events    int      `json:"events"`
+	Listed    int      `json:"listed"`
+	Matches   int      `json:"matches"`
+	IPS       float64  `json:"ips"`
+	SNIPS     *float64 `json:"snips,omitempty"`
+}
+
+func newOffPolicyResult(snipsRMSE float64, v eval.PolicyValue) *offPolicyResult {
+	r := &offPolicyResult{SNIPSRMSE: snipsRMSE, Events: v.Events, Listed: v.Listed, Matches: v.Matches, IPS: v.IPS}
+	if !math.IsNaN(v.SNIPS) {
+		r.SNIPS = &v.SNIPS
+	}
+	return r
+}
+
+func formatOptional(v *float64) string {
+	if v == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.4f", *v)
+}
+
+// printJSON writes v to stdout as a single line of JSON, for pipelines to
+// parse.
+func printJSON(v interface{}) {
+	if err := json.NewEncoder(os.Stdout).Encode(v); err != nil {
+		log.Fatalf("error writing JSON: %v", err)
+	}
+}
+
+func runGridSearch(args []string) {
+	fs := flag.NewFlagSet("gridsearch", flag.ExitOnError)
+	limit := fs.Int("limit", 10000000, "maximum number of ratings to load")
+	jsonOut := fs.Bool("json", false, "print the results as JSON instead of a table")
+	seed := fs.Int64("seed", 0, "seed for all random draws, 0 for a random run")
+	workers := fs.Int("workers", 1, "goroutines every trial's SGD runs on without locks (Hogwild)")
+	prof := addProfileFlags(fs)
+	fs.Parse(args)
+	defer prof.start()()
+	if *seed != 0 {
+		train.Seed(*seed)
+	}
+
+	ctx, span := train.StartSpan(context.Background(), "gridsearch")
+	defer span.End()
+	u, i, r := loadRatings(ctx, "host="+os.Getenv("PGHOST"), *limit)
+	trainset, testset, err := data.DatasetsFromSlices(u, i, r, 0.2, nil)
 	if err != nil {
 		log.Fatalf("error loading datasets: %v", err)
 	}
-	testParams := colfi.GridSearchParams{
+	testParams := eval.GridSearchParams{
 		NumEpochs:  []int{20},
 		NumFactors: []int{25, 35, 45},
 		Reg:        []float64{0.02},
 		LR:         []float64{0.01},
 		InitStdDev: []float64{0.1},
+		FitWorkers: *workers,
 	}
-	results := colfi.GridSearch(trainset, testset, testParams)
-	var data [][]string
+	results := eval.GridSearchContext(ctx, trainset, testset, testParams)
+	if *jsonOut {
+		out := make([]gridSearchResult, len(results))
+		for k, r := range results {
+			out[k] = gridSearchResult{
+				Epochs:         r.NumEpochs,
+				Factors:        r.NumFactors,
+				Reg:            r.Reg,
+				LR:             r.LR,
+				InitStdDev:     r.InitStdDev,
+				Loss:           r.Loss,
+				Eval:           newEvalResult(r.Eval),
+				RuntimeSeconds: r.Runtime.Seconds(),
+			}
+		}
+		printJSON(out)
+		return
+	}
+	var rows [][]string
 	for _, r := range results {
-		row := []string{strconv.Itoa(r.NumEpochs), strconv.Itoa(r.NumFactors), fmt.Sprintf("%.3f", r.Reg), fmt.Sprintf("%.3f", r.LR), fmt.Sprintf("%.1f", r.InitStdDev), fmt.Sprintf("%.4f", r.Loss), fmt.Sprintf("%v", r.Runtime)}
-		data = append(data, row)
+		row := []string{strconv.Itoa(r.NumEpochs), strconv.Itoa(r.NumFactors), fmt.Sprintf("%.3f", r.Reg), fmt.Sprintf("%.3f", r.LR), fmt.Sprintf("%.1f", r.InitStdDev), fmt.Sprintf("%.4f", r.Eval.All), fmt.Sprintf("%.4f", r.Eval.Known), strconv.Itoa(r.Eval.Stats.Unseen), fmt.Sprintf("%v", r.Runtime)}
+		rows = append(rows, row)
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"NumEpochs", "NumFactors", "Reg", "LR", "InitStdDev", "Loss", "Runtime"})
+	table.SetHeader([]string{"NumEpochs", "NumFactors", "Reg", "LR", "InitStdDev", "Loss", "LossKnown", "Unseen", "Runtime"})
 
-	for _, v := range data {
+	for _, v := range rows {
 		table.Append(v)
 	}
 	table.Render()
 }
 
-func loadRatings(connString string, limit int) ([]string, []string, []float32) {
-	ctx := context.Background()
+type gridSearchResult struct {
+	Epochs         int        `json:"epochs"`
+	Factors        int        `json:"factors"`
+	Reg            float64    `json:"reg"`
+	LR             float64    `json:"lr"`
+	InitStdDev     float64    `json:"init_std_dev"`
+	Loss           float64    `json:"loss"`
+	Eval           evalResult `json:"eval"`
+	RuntimeSeconds float64    `json:"runtime_seconds"`
+}
+
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	limit := fs.Int("limit", 10000000, "maximum number of ratings to load")
+	models := fs.String("models", "svd,svdpp", "comma-separated model families to compare, of svd, svdpp, asvd, hashsvd, als and itemknn")
+	numEpochs := fs.Int("epochs", 20, "training epochs of each family's final run")
+	state := fs.String("state", "", "save finished families to `file` and skip those already in it; needs -seed, since another split starts over")
+	jsonOut := fs.Bool("json", false, "print the results as JSON instead of a table")
+	seed := fs.Int64("seed", 0, "seed for all random draws, 0 for a random run")
+	prof := addProfileFlags(fs)
+	fs.Parse(args)
+	defer prof.start()()
+	if *seed != 0 {
+		train.Seed(*seed)
+	}
+
+	ctx, span := train.StartSpan(context.Background(), "compare")
+	defer span.End()
+	u, i, r := loadRatings(ctx, "host="+os.Getenv("PGHOST"), *limit)
+	trainset, testset, err := data.DatasetsFromSlices(u, i, r, 0.2, nil)
+	if err != nil {
+		log.Fatalf("error loading datasets: %v", err)
+	}
+	results, err := eval.Compare(trainset, testset, strings.Split(*models, ","), &eval.CompareConfig{
+		NumEpochs: *numEpochs,
+		State:     *state,
+		Verbose:   true,
+	})
+	if err != nil {
+		log.Fatalf("compare failed: %v", err)
+	}
+	base, err := eval.BaselineEval(trainset, testset, 0, eval.NewRMSE)
+	if err != nil {
+		log.Fatalf("error evaluating baseline: %v", err)
+	}
+	if *jsonOut {
+		out := make([]compareResult, len(results))
+		for k, r := range results {
+			lift := r.Eval.LiftOver(base)
+			out[k] = compareResult{
+				Family:         r.Family,
+				Params:         r.Params,
+				TuneLoss:       r.TuneLoss,
+				Eval:           newEvalResult(r.Eval),
+				Lift:           lift.All,
+				LiftKnown:      lift.Known,
+				RuntimeSeconds: r.Runtime.Seconds(),
+			}
+		}
+		printJSON(struct {
+			Baseline evalResult      `json:"baseline"`
+			Results  []compareResult `json:"results"`
+		}{newEvalResult(base), out})
+		return
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Model", "Params", "TuneLoss", "Loss", "LossKnown", "Lift", "Unseen", "Runtime"})
+	table.Append([]string{"baseline", "", "", fmt.Sprintf("%.4f", base.All), fmt.Sprintf("%.4f", base.Known), "", strconv.Itoa(base.Stats.Unseen), ""})
+	for _, r := range results {
+		table.Append([]string{r.Family, r.Params.String(), fmt.Sprintf("%.4f", r.TuneLoss), fmt.Sprintf("%.4f", r.Eval.All), fmt.Sprintf("%.4f", r.Eval.Known), fmt.Sprintf("%+.1f%%", 100*r.Eval.LiftOver(base).All), strconv.Itoa(r.Eval.Stats.Unseen), fmt.Sprintf("%v", r.Runtime)})
+	}
+	table.Render()
+}
+
+type compareResult struct {
+	Family         string             `json:"family"`
+	Params         map[string]float64 `json:"params"`
+	TuneLoss       float64            `json:"tune_loss"`
+	Eval           evalResult         `json:"eval"`
+	Lift           float64            `json:"lift"`
+	LiftKnown      float64            `json:"lift_known"`
+	RuntimeSeconds float64            `json:"runtime_seconds"`
+}
+
+// exitGateFailed is the exit status of evaluate when the model is worse than
+// a -fail-if threshold, distinct from the status 1 of other errors.
+const exitGateFailed = 3
+
+func runEvaluate(args []string) {
+	fs := flag.NewFlagSet("evaluate", flag.ExitOnError)
+	modelFile := fs.String("model", "model.gob", "model written by train -o")
+	testFile := fs.String("test", "", "CSV `file` of user,item,rating rows without a header to evaluate on")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of evaluation workers")
+	jsonOut := fs.Bool("json", false, "print the result as JSON")
+	maxRMSE := fs.Float64("fail-if-rmse-above", 0, "exit with status 3 if the RMSE exceeds this, 0 for no limit")
+	maxKnownRMSE := fs.Float64("fail-if-known-rmse-above", 0, "exit with status 3 if the RMSE over seen users and items exceeds this, 0 for no limit")
+	maxUnseen := fs.Float64("fail-if-unseen-above", 0, "exit with status 3 if the share of test ratings with an unseen user or item exceeds this, 0 for no limit")
+	lift := fs.Bool("lift", false, "also report the lift over a BaselineOnly model fitted on the model's trainset")
+	logged := fs.Bool("logged", false, "the -test rows have a fourth column with the propensity the item was shown with; also report off-policy estimates")
+	policyN := fs.Int("n", 10, "length of the lists whose value is estimated with -logged")
+	precision := fs.String("precision", "float64", "precision predictions are scored at, float64 or float32 to match the stored ratings")
+	fs.Parse(args)
+
+	if *testFile == "" {
+		log.Fatal("missing -test")
+	}
+	prec, err := eval.ParsePrecision(*precision)
+	if err != nil {
+		log.Fatalf("-precision: %v", err)
+	}
+	m, err := train.LoadFile(*modelFile)
+	if err != nil {
+		log.Fatalf("error loading model: %v", err)
+	}
+	load := loadRatingsFromCSV
+	if *logged {
+		load = loadLoggedFromCSV
+	}
+	testset, err := load(*testFile)
+	if err != nil {
+		log.Fatalf("error loading testset: %v", err)
+	}
+	if err := data.CheckScales(m.GetDataset(), testset); err != nil {
+		log.Printf("warning: %v", err)
+	}
+	res := eval.EvaluatePrecision(m, testset, *workers, eval.NewRMSE, prec)
+	var off *offPolicyResult
+	if *logged {
+		snips := eval.EvaluatePrecision(m, testset, *workers, eval.NewSNIPS(testset, eval.SquaredError), prec)
+		v, err := eval.EstimatePolicyValue(context.Background(), m, testset, *policyN, nil)
+		if err != nil {
+			log.Fatalf("error estimating policy value: %v", err)
+		}
+		off = newOffPolicyResult(math.Sqrt(snips.All), v)
+	}
+	var base *eval.EvalResult
+	if *lift {
+		b, err := eval.BaselineEval(m.GetDataset(), testset, *workers, eval.NewRMSE)
+		if err != nil {
+			log.Fatalf("error evaluating baseline: %v", err)
+		}
+		base = &b
+	}
+
+	var failures []string
+	gate := func(name string, value, limit float64) {
+		// An empty testset gives NaN, which must not pass.
+		if limit > 0 && !(value <= limit) {
+			failures = append(failures, fmt.Sprintf("%s %.4f above %.4f", name, value, limit))
+		}
+	}
+	gate("RMSE", res.All, *maxRMSE)
+	gate("known RMSE", res.Known, *maxKnownRMSE)
+	gate("unseen share", float64(res.Stats.Unseen)/float64(res.Stats.N), *maxUnseen)
+
+	if *jsonOut {
+		out := struct {
+			evalResult
+			Baseline  *evalResult      `json:"baseline,omitempty"`
+			Lift      *float64         `json:"lift,omitempty"`
+			LiftKnown *float64         `json:"lift_known,omitempty"`
+			OffPolicy *offPolicyResult `json:"off_policy,omitempty"`
+			Passed    bool             `json:"passed"`
+			Failures  []string         `json:"failures,omitempty"`
+		}{evalResult: newEvalResult(res), OffPolicy: off, Passed: len(failures) == 0, Failures: failures}
+		if base != nil {
+			b, l := newEvalResult(*base), res.LiftOver(*base)
+			out.Baseline, out.Lift, out.LiftKnown = &b, &l.All, &l.Known
+		}
+		printJSON(out)
+	} else {
+		fmt.Printf("RMSE %.4f (known %.4f) on %d ratings, %d unseen\n", res.All, res.Known, res.Stats.N, res.Stats.Unseen)
+		if base != nil {
+			l := res.LiftOver(*base)
+			fmt.Printf("baseline RMSE %.4f (known %.4f), lift %+.1f%% (known %+.1f%%)\n", base.All, base.Known, 100*l.All, 100*l.Known)
+		}
+		if off != nil {
+			fmt.Printf("SNIPS RMSE %.4f; top-%d reward per item IPS %.4f, SNIPS %s from %d of %d logged events\n",
+				off.SNIPSRMSE, *policyN, off.IPS, formatOptional(off.SNIPS), off.Matches, off.Events)
+		}
+	}
+	if len(failures) > 0 {
+		log.Printf("evaluation gate failed: %s", strings.Join(failures, ", "))
+		os.Exit(exitGateFailed)
+	}
+}
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	modelFile := fs.String("model", "model.gob", "model written by train -o")
+	addr := fs.String("addr", ":8080", "listen address")
+	featuresFile := fs.String("features", "", "JSON lines of item metadata to filter on")
+	tenantsFile := fs.String("tenants", "", "JSON `file` mapping tenant names to models, served under /tenants/<name>/ instead of -model")
+	maxAge := fs.Duration("max-age", 0, "model age beyond which /readyz fails, 0 for no limit")
+	drainDelay := fs.Duration("drain-delay", 5*time.Second, "time between failing /readyz and closing the listener on SIGTERM")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "time given to in-flight requests on shutdown")
+	spans := fs.Bool("spans", false, "log the duration of every request")
+	timeout := fs.Duration("timeout", 10*time.Second, "deadline of every request, 0 for none")
+	maxConcurrent := fs.Int("max-concurrent", runtime.NumCPU(), "requests handled at once, 0 for no limit")
+	maxQueue := fs.Int("max-queue", 64, "requests waiting for a slot before more are shed with 429")
+	challenger := fs.String("challenger", "", "model `file` to run in shadow mode on /recommend, logging how its lists compare with the served ones")
+	ingest := fs.Bool("ingest", false, "accept new ratings on POST /ratings and apply them with PartialFit")
+	ingestBatch := fs.Int("ingest-batch", 1, "ratings buffered before they are applied to the model")
+	ingestFlush := fs.Duration("ingest-flush", time.Second, "time after which a partial batch of ratings is applied")
+	ingestQueue := fs.String("ingest-queue", "", "CSV `file` that ingested ratings are appended to for the next retrain")
+	weights := fs.String("weights", "", "comma-separated attr:weight pairs blending served scores with numeric item features, e.g. relevance:1,margin:0.3")
+	explore := fs.String("explore", "", "exploration policy of /recommend, epsilon or thompson, logging the propensity of every item served")
+	epsilon := fs.Float64("epsilon", .1, "share of the slots the epsilon policy explores with")
+	clip := fs.Bool("clip", false, "clip served scores to the rating scale stored in the model")
+	availFile := fs.String("availability", "", "`file` listing one available item per line; other items are never served")
+	availQuery := fs.String("availability-query", "", "Postgres `query` returning the IDs of available items, instead of -availability")
+	availEvery := fs.Duration("availability-every", 5*time.Minute, "interval between reloads of the item availability")
+	fs.Parse(args)
+	if *spans {
+		train.SetTracer(train.LogTracer{})
+	}
+
+	var h serve.Drainer
+
+	if *tenantsFile != "" {
+		configs, err := serve.ReadTenants(*tenantsFile)
+		if err != nil {
+			log.Fatalf("error reading tenants: %v", err)
+		}
+		reg := serve.NewRegistry()
+		reg.MaxAge = *maxAge
+		for name, config := range configs {
+			if err := reg.Add(name, config); err != nil {
+				log.Fatal(err)
+			}
+		}
+		log.Printf("serving tenants %s on %s", strings.Join(reg.Names(), ", "), *addr)
+		h = reg
+	} else {
+		s, err := serve.Load(*modelFile, *featuresFile)
+		if err != nil {
+			log.Fatalf("error loading model: %v", err)
+		}
+		s.MaxAge = *maxAge
+		if *weights != "" {
+			if s.Weights, err = train.ParseWeights(strings.Split(*weights, ",")); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *clip {
+			b, ok := train.ModelBounds(s.Model)
+			if !ok {
+				b = s.Model.GetDataset().RatingBounds()
+			}
+			if err := b.Validate(); err != nil {
+				log.Fatalf("-clip: no rating scale for %T: %v", s.Model, err)
+			}
+			s.PostProcess = train.Chain{train.Clip(b)}
+		}
+		switch *explore {
+		case "":
+		case "epsilon":
+			s.Explore = &train.ExploreConfig{Policy: train.EpsilonGreedy, Epsilon: *epsilon}
+		case "thompson":
+			s.Explore = &train.ExploreConfig{Policy: train.Thompson}
+		default:
+			log.Fatalf("unknown exploration policy %q", *explore)
+		}
+		if *challenger != "" {
+			c, err := train.LoadFile(*challenger)
+			if err != nil {
+				log.Fatalf("error loading challenger: %v", err)
+			}
+			s.SetChallenger(c)
+		}
+		if *ingest {
+			config := serve.IngestConfig{BatchSize: *ingestBatch, FlushInterval: *ingestFlush}
+			if *ingestQueue != "" {
+				f, err := os.OpenFile(*ingestQueue, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+				if err != nil {
+					log.Fatalf("error opening ingestion queue: %v", err)
+				}
+				defer f.Close()
+				config.Queue = f
+			}
+			if err := s.EnableIngest(config); err != nil {
+				log.Fatal(err)
+			}
+		}
+		var load serve.AvailabilityLoader
+		switch {
+		case *availQuery != "":
+			load = pgAvailability("host="+os.Getenv("PGHOST"), *availQuery)
+		case *availFile != "":
+			load = serve.AvailabilityFile(*availFile)
+		}
+		if load != nil {
+			if err := s.RefreshAvailability(context.Background(), load, *availEvery); err != nil {
+				log.Fatalf("error loading item availability: %v", err)
+			}
+		}
+		log.Printf("serving %s, trained %s, on %s", *modelFile, s.ModelTime.Format(time.RFC3339), *addr)
+		h = s
+	}
+	h = serve.Limit(h, serve.Limits{Timeout: *timeout, MaxConcurrent: *maxConcurrent, MaxQueue: *maxQueue})
+	if err := serve.ListenAndServe(*addr, h, *drainDelay, *shutdownTimeout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runGolden trains a model on synthetic data with a fixed seed and either
+// records the outcome or checks it against an earlier recording.
+func runGolden(args []string) {
+	fs := flag.NewFlagSet("golden", flag.ExitOnError)
+	model := fs.String("model", "svd", "model to train")
+	numEpochs := fs.Int("epochs", 20, "number of training epochs")
+	seed := fs.Int64("seed", 1, "random seed")
+	record := fs.String("record", "", "write the outcome to `file`")
+	check := fs.String("check", "", "compare the outcome with `file`")
+	tol := fs.Float64("tol", eval.GoldenTolerance, "relative tolerance for -check")
+	jsonOut := fs.Bool("json", false, "print the outcome as JSON")
+	prof := addProfileFlags(fs)
+	fs.Parse(args)
+	defer prof.start()()
+
+	newModel, ok := eval.GoldenModels[*model]
+	if !ok {
+		log.Fatalf("unknown model %q", *model)
+	}
+	g, err := eval.GoldenRun(newModel, *numEpochs, *seed)
+	if err != nil {
+		log.Fatalf("golden run failed: %v", err)
+	}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			log.Fatalf("could not create golden file: %v", err)
+		}
+		defer f.Close()
+		if err := eval.WriteGolden(f, g); err != nil {
+			log.Fatalf("could not write golden file: %v", err)
+		}
+	}
+	if *check != "" {
+		f, err := os.Open(*check)
+		if err != nil {
+			log.Fatalf("could not open golden file: %v", err)
+		}
+		defer f.Close()
+		want, err := eval.ReadGolden(f)
+		if err != nil {
+			log.Fatalf("could not read golden file: %v", err)
+		}
+		if err := g.Check(want, *tol); err != nil {
+			log.Fatalf("golden check failed for %s: %v", *model, err)
+		}
+		log.Printf("golden check passed for %s", *model)
+	}
+	if *jsonOut {
+		printJSON(struct {
+			Model   string  `json:"model"`
+			Loss    float64 `json:"loss"`
+			Epochs  int     `json:"epochs"`
+			Checked bool    `json:"checked"`
+		}{*model, g.Loss, g.NumEpochs, *check != ""})
+		return
+	}
+	fmt.Printf("%s: loss %.6f after %d epochs\n", *model, g.Loss, g.NumEpochs)
+}
+
+func loadRatings(ctx context.Context, connString string, limit int) ([]string, []string, []float32) {
+	ctx, span := train.StartSpan(ctx, "postgres.load", train.Attr{Key: "limit", Value: limit})
+	defer span.End()
 	conn, err := pgx.Connect(ctx, connString)
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v\n", err)
@@ -68,22 +749,72 @@ func loadRatings(connString string, limit int) ([]string, []string, []float32) {
 	if err != nil {
 		log.Fatalf("Unable to get ratings: %v\n", err)
 	}
-	j := 0
+	us, is, rs, err := data.ReadSlices(&pgSource{rows: rows})
+	if err != nil {
+		log.Fatalf("Unable to get ratings: %v\n", err)
+	}
+	span.SetAttrs(train.Attr{Key: "rows", Value: len(rs)})
+	return us, is, rs
+}
+
+// pgAvailability returns a loader running query, which must return one
+// column of item IDs.
+func pgAvailability(connString, query string) serve.AvailabilityLoader {
+	return func(ctx context.Context, d *data.Dataset) (*data.Availability, error) {
+		conn, err := pgx.Connect(ctx, connString)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close(ctx)
+		rows, err := conn.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		var items []string
+		for rows.Next() {
+			var i string
+			if err := rows.Scan(&i); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			items = append(items, i)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return data.NewAvailability(d, items), nil
+	}
+}
+
+// pgSource is a data.RatingSource over rows of user, item and rating.
+type pgSource struct {
+	rows pgx.Rows
+	n    int
+	err  error
+}
+
+func (s *pgSource) Next() (string, string, float32, bool) {
+	if s.err != nil || !s.rows.Next() {
+		return "", "", 0, false
+	}
+	if s.n%1000000 == 0 {
+		log.Printf("loaded %d rows", s.n)
+	}
+	s.n++
 	var u, i string
 	var r float64
-	var us, is []string
-	var rs []float32
-	for rows.Next() {
-		if j%1000000 == 0 {
-			log.Printf("loaded %d rows", j)
-		}
-		rows.Scan(&u, &i, &r)
-		us = append(us, u)
-		is = append(is, i)
-		rs = append(rs, float32(r))
-		j++
+	if s.err = s.rows.Scan(&u, &i, &r); s.err != nil {
+		s.rows.Close()
+		return "", "", 0, false
 	}
-	return us, is, rs
+	return u, i, float32(r), true
+}
+
+func (s *pgSource) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.rows.Err()
 }
 
 /*func main() {
@@ -143,18 +874,20 @@ func loadRatings(dataset *colfi.Dataset, connString string, limit int) {
 	}
 }*/
 
-func loadRatingsFromCSV(fileName string) *colfi.Dataset {
-	f, _ := os.Open(fileName)
+func loadRatingsFromCSV(fileName string) (*data.Dataset, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
 	defer f.Close()
-	r := csv.NewReader(f)
-	dataset := colfi.NewDataset()
-	for {
-		record, err := r.Read()
-		if err != nil {
-			break
-		}
-		rating, _ := strconv.ParseFloat(record[2], 32)
-		dataset.Append(record[0], record[1], float32(rating))
+	return data.ReadCSV(f, false)
+}
+
+func loadLoggedFromCSV(fileName string) (*data.Dataset, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
 	}
-	return dataset
+	defer f.Close()
+	return data.ReadLoggedCSV(f, false)
 }
@@ -0,0 +1,110 @@
+// Package mobile wraps a compact colfi model for gomobile, so that Android
+// and iOS apps can score on device, e.g. to re-rank cached candidates. Build
+// the bindings with
+//
+//	gomobile bind -target=android ./mobile
+//	gomobile bind -target=ios ./mobile
+//
+// gomobile cannot pass slices of strings or structs, so lists of items go
+// through ItemList.
+package mobile
+
+import (
+	"bytes"
+	"sort"
+
+	"main/colfi/infer"
+)
+
+type Model struct {
+	c *infer.Model
+}
+
+// LoadModel reads a model written by train -compact.
+func LoadModel(data []byte) (*Model, error) {
+	c, err := infer.Load(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &Model{c}, nil
+}
+
+func (m *Model) Predict(user, item string) float64 {
+	return m.c.Predict(user, item)
+}
+
+// Recommend returns the n highest scoring items of the whole catalog for
+// user, leaving out those in exclude, which may be nil.
+func (m *Model) Recommend(user string, n int, exclude *ItemList) *ItemList {
+	var skip []string
+	if exclude != nil {
+		skip = exclude.items
+	}
+	l := &ItemList{}
+	for _, s := range m.c.Recommend(user, n, skip) {
+		l.items = append(l.items, s.Item)
+		l.scores = append(l.scores, s.Score)
+	}
+	return l
+}
+
+// Rerank scores candidates for user and returns them in decreasing order of
+// score. Items unknown to the model are kept, scored by the user's bias. A
+// nil candidates list gives an empty list.
+func (m *Model) Rerank(user string, candidates *ItemList) *ItemList {
+	if candidates == nil {
+		return &ItemList{}
+	}
+	l := &ItemList{
+		items:  append([]string(nil), candidates.items...),
+		scores: make([]float64, len(candidates.items)),
+	}
+	for k, item := range l.items {
+		l.scores[k] = m.c.Predict(user, item)
+	}
+	sort.Stable(byScore{l})
+	return l
+}
+
+// ItemList is a list of item IDs with optional scores.
+type ItemList struct {
+	items  []string
+	scores []float64
+}
+
+func NewItemList() *ItemList {
+	return &ItemList{}
+}
+
+// Add appends an item with score 0.
+func (l *ItemList) Add(item string) {
+	l.items = append(l.items, item)
+	l.scores = append(l.scores, 0)
+}
+
+func (l *ItemList) Len() int {
+	return len(l.items)
+}
+
+func (l *ItemList) Item(k int) string {
+	return l.items[k]
+}
+
+func (l *ItemList) Score(k int) float64 {
+	return l.scores[k]
+}
+
+// byScore orders a list by decreasing score. Its methods are kept off
+// ItemList so they do not end up in the bindings.
+type byScore struct {
+	*ItemList
+}
+
+func (l byScore) Less(a, b int) bool {
+	return l.scores[a] > l.scores[b]
+}
+
+func (l byScore) Swap(a, b int) {
+	l.items[a], l.items[b] = l.items[b], l.items[a]
+	l.scores[a], l.scores[b] = l.scores[b], l.scores[a]
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"main/colfi/train"
+)
+
+type profileFlags struct {
+	cpuProfile string
+	memProfile string
+	trace      string
+	spans      bool
+}
+
+func addProfileFlags(fs *flag.FlagSet) *profileFlags {
+	p := &profileFlags{}
+	fs.StringVar(&p.cpuProfile, "cpuprofile", "", "write a CPU profile to `file`")
+	fs.StringVar(&p.memProfile, "memprofile", "", "write a heap profile to `file` on exit")
+	fs.StringVar(&p.trace, "trace", "", "write an execution trace to `file`")
+	fs.BoolVar(&p.spans, "spans", false, "log the duration of loading, training and grid search steps")
+	return p
+}
+
+// start begins any requested CPU profile and execution trace. The returned
+// function stops them and writes the heap profile, and must be called before
+// the command returns.
+func (p *profileFlags) start() func() {
+	var stops []func()
+	if p.spans {
+		train.SetTracer(train.LogTracer{})
+	}
+	if p.cpuProfile != "" {
+		f, err := os.Create(p.cpuProfile)
+		if err != nil {
+			log.Fatalf("could not create CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatalf("could not start CPU profile: %v", err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		})
+	}
+	if p.trace != "" {
+		f, err := os.Create(p.trace)
+		if err != nil {
+			log.Fatalf("could not create trace: %v", err)
+		}
+		if err := trace.Start(f); err != nil {
+			log.Fatalf("could not start trace: %v", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			f.Close()
+		})
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+		if p.memProfile != "" {
+			f, err := os.Create(p.memProfile)
+			if err != nil {
+				log.Fatalf("could not create heap profile: %v", err)
+			}
+			defer f.Close()
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				log.Fatalf("could not write heap profile: %v", err)
+			}
+		}
+	}
+}
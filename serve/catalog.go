@@ -0,0 +1,86 @@
+package serve
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"main/colfi/data"
+)
+
+// AvailabilityLoader returns the current availability of the items of d,
+// e.g. read from a file or queried from the catalog database. d holds a copy
+// of the model's items and no ratings.
+type AvailabilityLoader func(ctx context.Context, d *data.Dataset) (*data.Availability, error)
+
+// AvailabilityFile returns a loader reading path with
+// data.ReadAvailability.
+func AvailabilityFile(path string) AvailabilityLoader {
+	return func(ctx context.Context, d *data.Dataset) (*data.Availability, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		a, err := data.ReadAvailability(d, f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return a, nil
+	}
+}
+
+// SetAvailability replaces the snapshot of available items. Requests in
+// flight keep the one they started with; nil makes every item available.
+func (s *Server) SetAvailability(a *data.Availability) {
+	s.available.Store(a)
+}
+
+// RefreshAvailability loads the availability snapshot with load, then again
+// every interval until ctx is done. The first load must succeed; a later
+// failure is logged and the previous snapshot kept, so that a catalog outage
+// does not empty recommendations. load runs without the model's lock, on a
+// copy of its items, so that a slow catalog does not hold up ingestion.
+func (s *Server) RefreshAvailability(ctx context.Context, load AvailabilityLoader, interval time.Duration) error {
+	refresh := func() error {
+		s.mu.RLock()
+		d := itemsOf(s.Model.GetDataset())
+		s.mu.RUnlock()
+		a, err := load(ctx, d)
+		if err != nil {
+			return err
+		}
+		s.SetAvailability(a)
+		return nil
+	}
+	if err := refresh(); err != nil {
+		return err
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := refresh(); err != nil {
+					log.Printf("keeping previous item availability: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// itemsOf returns a dataset holding the items of d under the same internal
+// IDs, without any ratings.
+func itemsOf(d *data.Dataset) *data.Dataset {
+	items := data.NewDataset()
+	for _, i := range d.ItemIDs {
+		items.AddItem(i)
+	}
+	return items
+}
@@ -0,0 +1,148 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"main/colfi/data"
+)
+
+// scriptedLoader is an AvailabilityLoader that hands every dataset it is
+// called with to the test and answers with the items or error it gets back.
+type scriptedLoader struct {
+	calls   chan *data.Dataset
+	replies chan loaderReply
+}
+
+type loaderReply struct {
+	items []string
+	err   error
+}
+
+func newScriptedLoader() *scriptedLoader {
+	return &scriptedLoader{make(chan *data.Dataset), make(chan loaderReply)}
+}
+
+func (l *scriptedLoader) load(ctx context.Context, d *data.Dataset) (*data.Availability, error) {
+	l.calls <- d
+	r := <-l.replies
+	if r.err != nil {
+		return nil, r.err
+	}
+	return data.NewAvailability(d, r.items), nil
+}
+
+// next waits for the loader's next call. As the refresh loop only calls it
+// again once the previous snapshot is stored, this also means that one is.
+func (l *scriptedLoader) next(t *testing.T) *data.Dataset {
+	t.Helper()
+	select {
+	case d := <-l.calls:
+		return d
+	case <-time.After(10 * time.Second):
+		t.Fatal("the loader was not called")
+		return nil
+	}
+}
+
+func TestRefreshAvailability(t *testing.T) {
+	m := testModel(t)
+	s := New(m)
+	l := newScriptedLoader()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- s.RefreshAvailability(ctx, l.load, time.Millisecond) }()
+
+	d := l.next(t)
+	if !reflect.DeepEqual(d.ItemIDs, m.Dataset.ItemIDs) || len(d.Ratings) != 0 {
+		t.Errorf("loader got %d items and %d ratings, want the model's %d items and no ratings", len(d.ItemIDs), len(d.Ratings), len(m.Dataset.ItemIDs))
+	}
+	if d == m.Dataset {
+		t.Error("loader got the model's own dataset")
+	}
+	l.replies <- loaderReply{items: []string{"i1", "i2"}}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if got := recommended(t, s, "u1"); !reflect.DeepEqual(got, []string{"i1", "i2"}) {
+		t.Errorf("after the first load: got %v, want [i1 i2]", got)
+	}
+
+	l.next(t)
+	l.replies <- loaderReply{items: []string{"i3"}}
+	l.next(t)
+	if got := recommended(t, s, "u1"); !reflect.DeepEqual(got, []string{"i3"}) {
+		t.Errorf("after a refresh: got %v, want [i3]", got)
+	}
+	l.replies <- loaderReply{err: errors.New("catalog down")}
+	l.next(t)
+	if got := recommended(t, s, "u1"); !reflect.DeepEqual(got, []string{"i3"}) {
+		t.Errorf("after a failed refresh: got %v, want the previous [i3]", got)
+	}
+	cancel()
+	l.replies <- loaderReply{items: []string{"i4"}}
+}
+
+func TestRefreshAvailabilityFirstLoadFails(t *testing.T) {
+	s := New(testModel(t))
+	calls := 0
+	err := s.RefreshAvailability(context.Background(), func(ctx context.Context, d *data.Dataset) (*data.Availability, error) {
+		calls++
+		return nil, errors.New("catalog down")
+	}, time.Millisecond)
+	if err == nil || err.Error() != "catalog down" {
+		t.Fatalf("got %v, want the loader's error", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if calls != 1 {
+		t.Errorf("loader called %d times after the first load failed, want 1", calls)
+	}
+	if got := recommended(t, s, "u1"); len(got) != 30 {
+		t.Errorf("got %d items without a snapshot, want all 30", len(got))
+	}
+}
+
+func TestRefreshAvailabilityDoesNotHoldModel(t *testing.T) {
+	m := testModel(t)
+	s := New(m)
+	if err := s.EnableIngest(IngestConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	l := newScriptedLoader()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- s.RefreshAvailability(ctx, l.load, time.Hour) }()
+	d := l.next(t)
+
+	// Adding an item takes the model's lock exclusively, which must not
+	// wait for the loader.
+	added := make(chan int, 1)
+	go func() {
+		w := post(s, "/items", `{"item": "new", "vector": [0, 0, 0, 0]}`)
+		added <- w.Code
+	}()
+	select {
+	case code := <-added:
+		if code != http.StatusOK {
+			t.Fatalf("POST /items: status %d", code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("POST /items waited for the availability loader")
+	}
+	if _, ok := d.ItemMap["new"]; ok {
+		t.Error("the loader's copy of the items changed under it")
+	}
+	l.replies <- loaderReply{items: []string{"i1"}}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Dataset.ItemMap["new"]; !ok {
+		t.Error("the item was not added to the model")
+	}
+}
@@ -0,0 +1,64 @@
+package serve
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"main/colfi/train"
+)
+
+// Impression records a list /recommend served under exploration, with the
+// propensity of every item, so that the feedback it gets can be weighted by
+// inverse propensity when evaluating or retraining offline.
+type Impression struct {
+	User         string    `json:"user"`
+	Items        []string  `json:"items"`
+	Propensities []float64 `json:"propensities"`
+	Explored     []bool    `json:"explored"`
+}
+
+type exploredItem struct {
+	Item       string  `json:"item"`
+	Score      float64 `json:"score"`
+	Propensity float64 `json:"propensity"`
+	Explored   bool    `json:"explored"`
+}
+
+// logImpression writes imp as a JSON line, the default for
+// Server.OnImpression.
+func logImpression(imp Impression) {
+	b, _ := json.Marshal(imp)
+	log.Printf("impression %s", b)
+}
+
+// writeExplored writes items with their propensities and reports the
+// impression.
+func (s *Server) writeExplored(w http.ResponseWriter, user string, items []train.ExploredItem) {
+	out := make([]exploredItem, len(items))
+	imp := Impression{
+		User:         user,
+		Items:        make([]string, len(items)),
+		Propensities: make([]float64, len(items)),
+		Explored:     make([]bool, len(items)),
+	}
+	for k, it := range items {
+		out[k] = exploredItem{it.Item, it.Score, it.Propensity, it.Explored}
+		imp.Items[k], imp.Propensities[k], imp.Explored[k] = it.Item, it.Propensity, it.Explored
+	}
+	writeJSON(w, out)
+	if s.OnImpression != nil {
+		s.OnImpression(imp)
+	} else {
+		logImpression(imp)
+	}
+}
+
+// scoredItems drops the propensities of items.
+func scoredItems(items []train.ExploredItem) []train.ScoredItem {
+	recs := make([]train.ScoredItem, len(items))
+	for k, it := range items {
+		recs[k] = it.ScoredItem
+	}
+	return recs
+}
@@ -0,0 +1,115 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Drainer is a handler that can be told the process is shutting down, after
+// which its readiness check fails so that load balancers stop routing to it
+// while in-flight requests finish.
+type Drainer interface {
+	http.Handler
+	Drain()
+}
+
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+// Drain fails the readiness checks of the registry and of every loaded
+// tenant.
+func (reg *Registry) Drain() {
+	reg.draining.Store(true)
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, t := range reg.tenants {
+		if s := t.server.Load(); s != nil {
+			s.Drain()
+		}
+	}
+}
+
+// ready returns why the server cannot take traffic, or nil if it can.
+func (s *Server) ready() error {
+	if s.draining.Load() {
+		return errors.New("shutting down")
+	}
+	if s.Model == nil {
+		return errors.New("no model loaded")
+	}
+	if age := time.Since(s.ModelTime); s.MaxAge > 0 && !s.ModelTime.IsZero() && age > s.MaxAge {
+		return fmt.Errorf("model is %v old, more than %v", age.Round(time.Second), s.MaxAge)
+	}
+	return nil
+}
+
+// ready fails if the registry is shutting down or a loaded tenant is not
+// ready. Tenants not loaded yet do not count, as they load on demand.
+func (reg *Registry) ready() error {
+	if reg.draining.Load() {
+		return errors.New("shutting down")
+	}
+	for _, name := range reg.Names() {
+		t := reg.lookup(name)
+		if t == nil {
+			continue
+		}
+		if s := t.server.Load(); s != nil {
+			if err := s.ready(); err != nil {
+				return fmt.Errorf("tenant %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// healthz reports that the process is up, whatever the state of its models.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Status string `json:"status"`
+	}{"ok"})
+}
+
+func writeReady(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, struct {
+		Status string `json:"status"`
+	}{"ready"})
+}
+
+// ListenAndServe serves h on addr until SIGINT or SIGTERM. It then drains
+// h, waits drainDelay for load balancers to notice the failing readiness
+// check, and shuts down, giving in-flight requests up to shutdownTimeout to
+// finish.
+func ListenAndServe(addr string, h Drainer, drainDelay, shutdownTimeout time.Duration) error {
+	srv := &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	log.Printf("shutting down, draining for %v", drainDelay)
+	h.Drain()
+	time.Sleep(drainDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,93 @@
+package serve
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"main/colfi/train"
+)
+
+func TestServerReadiness(t *testing.T) {
+	if w := get(New(nil), "/readyz"); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "no model loaded") {
+		t.Errorf("without a model: got %d %s, want 503", w.Code, w.Body)
+	}
+
+	s := New(testModel(t))
+	s.MaxAge = time.Hour
+	// A model without a training time never counts as stale.
+	wantReady(t, s, "")
+	s.ModelTime = time.Now().Add(-time.Minute)
+	wantReady(t, s, "")
+	s.ModelTime = time.Now().Add(-2 * time.Hour)
+	wantReady(t, s, "more than 1h0m0s")
+	s.MaxAge = 0
+	wantReady(t, s, "")
+
+	s.Drain()
+	wantReady(t, s, "shutting down")
+	if w := get(s, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("/healthz while draining: got status %d, want 200", w.Code)
+	}
+	// Requests in flight or still arriving are served until shutdown.
+	if w := get(s, "/predict?user=u1&item=i1"); w.Code != http.StatusOK {
+		t.Errorf("/predict while draining: got status %d, want 200", w.Code)
+	}
+}
+
+func TestRegistryReadiness(t *testing.T) {
+	dir := t.TempDir()
+	m := testModel(t)
+	fresh, stale := filepath.Join(dir, "fresh.gob"), filepath.Join(dir, "stale.gob")
+	if err := train.SaveFileMetadata(fresh, m, train.Metadata{TrainedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := train.SaveFileMetadata(stale, m, train.Metadata{TrainedAt: time.Now().Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry()
+	reg.MaxAge = time.Hour
+	for name, path := range map[string]string{"fresh": fresh, "stale": stale} {
+		if err := reg.Add(name, TenantConfig{Model: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tenants only count once loaded.
+	wantReady(t, reg, "")
+	get(reg, "/tenants/fresh/predict?user=u1&item=i1")
+	wantReady(t, reg, "")
+	get(reg, "/tenants/stale/predict?user=u1&item=i1")
+	wantReady(t, reg, "tenant stale: model is")
+	reg.Remove("stale")
+	wantReady(t, reg, "")
+
+	reg.Drain()
+	wantReady(t, reg, "shutting down")
+	if s := reg.lookup("fresh").server.Load(); s == nil || s.ready() == nil {
+		t.Error("Drain did not reach the loaded tenant")
+	}
+	if w := get(reg, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("/healthz while draining: got status %d, want 200", w.Code)
+	}
+}
+
+// wantReady checks that /readyz on h succeeds if reason is empty, or fails
+// with an error containing reason.
+func wantReady(t *testing.T, h http.Handler, reason string) {
+	t.Helper()
+	w := get(h, "/readyz")
+	if reason == "" {
+		if w.Code != http.StatusOK {
+			t.Errorf("/readyz: got %d %s, want 200", w.Code, w.Body)
+		}
+		return
+	}
+	var out struct{ Error string }
+	decode(t, w, &out)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(out.Error, reason) {
+		t.Errorf("/readyz: got %d %q, want 503 with %q", w.Code, out.Error, reason)
+	}
+}
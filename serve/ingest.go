@@ -0,0 +1,184 @@
+package serve
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// maxIngestBytes bounds the body of a POST /ratings request.
+const maxIngestBytes = 8 << 20
+
+// IngestConfig configures POST /ratings, which takes one
+// {"user": ..., "item": ..., "rating": ...} object per line, as
+// data.ReadJSONL does, and rejects the whole request if any is invalid.
+type IngestConfig struct {
+	// BatchSize is the number of ratings buffered before they are applied
+	// to the model with PartialFit, all at once. Applying a batch blocks
+	// requests for its duration, so larger batches trade freshness for
+	// fewer pauses. Zero or one applies every request immediately.
+	BatchSize int
+	// FlushInterval, if set, applies a partial batch once its oldest
+	// rating has waited this long.
+	FlushInterval time.Duration
+	// Queue, if set, receives every accepted rating as a user,item,rating
+	// CSV row, to be appended to the trainset of the next full retrain.
+	Queue io.Writer
+}
+
+type ingester struct {
+	config IngestConfig
+	fitter train.PartialFitter
+	// apply applies the buffered ratings, when a batch fills up or its
+	// flush interval elapses.
+	apply   func()
+	mu      sync.Mutex
+	queue   *csv.Writer
+	pending []*data.Dataset
+	size    int
+	timer   *time.Timer
+}
+
+// EnableIngest serves POST /ratings, which feeds new ratings to the model
+// through PartialFit. The model must support it. If it is also a
+// train.ItemAdder, POST /items takes {"item": ..., "vector": [...]} and adds
+// a new item with those factors, recommendable at once; with an
+// availability snapshot set, only once the snapshot lists it. Items added
+// so are not queued, so a full retrain only keeps those rated since. While
+// ingestion is enabled, requests that read the model take a read lock that
+// applying a batch or adding an item takes exclusively.
+func (s *Server) EnableIngest(config IngestConfig) error {
+	pf, ok := s.Model.(train.PartialFitter)
+	if !ok {
+		return fmt.Errorf("%T does not support PartialFit", s.Model)
+	}
+	ing := &ingester{config: config, fitter: pf, apply: s.applyRatings}
+	if config.Queue != nil {
+		ing.queue = csv.NewWriter(config.Queue)
+	}
+	s.ingest = ing
+	s.mux.HandleFunc("/ratings", s.postRatings)
+	if _, ok := s.Model.(train.ItemAdder); ok {
+		s.mux.HandleFunc("/items", s.postItem)
+	}
+	return nil
+}
+
+func (s *Server) postItem(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req struct {
+		Item   string    `json:"item"`
+		Vector []float64 `json:"vector"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Item == "" {
+		writeError(w, http.StatusBadRequest, "missing item")
+		return
+	}
+	s.mu.Lock()
+	err := s.Model.(train.ItemAdder).AddItem(req.Item, req.Vector)
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, struct {
+		Item string `json:"item"`
+	}{req.Item})
+}
+
+func (s *Server) postRatings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	d, err := data.ReadJSONL(http.MaxBytesReader(w, r.Body, maxIngestBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.ingest.add(d); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if s.ingest.full() {
+		s.ingest.apply()
+	}
+	writeJSON(w, struct {
+		Accepted int `json:"accepted"`
+	}{len(d.Ratings)})
+}
+
+// add queues the ratings of d for retraining and buffers them for
+// PartialFit.
+func (ing *ingester) add(d *data.Dataset) error {
+	ing.mu.Lock()
+	defer ing.mu.Unlock()
+	if ing.queue != nil {
+		for k, r := range d.Ratings {
+			ing.queue.Write([]string{d.UserIDs[d.Users[k]], d.ItemIDs[d.Items[k]], strconv.FormatFloat(float64(r), 'g', -1, 32)})
+		}
+		ing.queue.Flush()
+		if err := ing.queue.Error(); err != nil {
+			return fmt.Errorf("queueing ratings for retraining: %w", err)
+		}
+	}
+	ing.pending = append(ing.pending, d)
+	ing.size += len(d.Ratings)
+	return nil
+}
+
+// full reports whether the buffered ratings fill a batch, starting the
+// flush timer otherwise.
+func (ing *ingester) full() bool {
+	ing.mu.Lock()
+	defer ing.mu.Unlock()
+	if ing.size >= ing.config.BatchSize {
+		return true
+	}
+	if ing.config.FlushInterval > 0 && ing.timer == nil {
+		ing.timer = time.AfterFunc(ing.config.FlushInterval, ing.apply)
+	}
+	return false
+}
+
+// take empties the buffer and returns the ratings it held.
+func (ing *ingester) take() []*data.Dataset {
+	ing.mu.Lock()
+	defer ing.mu.Unlock()
+	batch := ing.pending
+	ing.pending, ing.size = nil, 0
+	if ing.timer != nil {
+		ing.timer.Stop()
+		ing.timer = nil
+	}
+	return batch
+}
+
+// applyRatings applies the buffered ratings to the model with PartialFit.
+func (s *Server) applyRatings() {
+	// Taking the batch under the lock keeps batches applied in order.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.ingest.take() {
+		for k, r := range d.Ratings {
+			s.ingest.fitter.PartialFit(d.UserIDs[d.Users[k]], d.ItemIDs[d.Items[k]], r)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package serve
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"main/colfi/train"
+)
+
+// TestIngestConcurrent posts ratings while other requests read the model.
+// Run it with -race.
+func TestIngestConcurrent(t *testing.T) {
+	for _, config := range []IngestConfig{
+		{BatchSize: 1},
+		{BatchSize: 7, FlushInterval: 5 * time.Millisecond},
+	} {
+		t.Run(fmt.Sprintf("batch%d", config.BatchSize), func(t *testing.T) {
+			m := testModel(t)
+			before := len(m.Dataset.Ratings)
+			s := New(m)
+			var queue bytes.Buffer
+			config.Queue = &queue
+			if err := s.EnableIngest(config); err != nil {
+				t.Fatal(err)
+			}
+
+			const writers, posts = 4, 25
+			done := make(chan struct{})
+			var readers sync.WaitGroup
+			for k := 0; k < 4; k++ {
+				readers.Add(1)
+				go func(k int) {
+					defer readers.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+						}
+						for _, target := range []string{
+							fmt.Sprintf("/predict?user=u%d&item=i%d", k, k),
+							fmt.Sprintf("/recommend?user=u%d&n=5", k),
+							fmt.Sprintf("/similar?item=i%d&n=5", k),
+						} {
+							if w := get(s, target); w.Code != http.StatusOK {
+								t.Errorf("%s: got %d %s", target, w.Code, w.Body)
+								return
+							}
+						}
+						// Users being added may or may not be known yet.
+						if w := get(s, fmt.Sprintf("/recommend?user=w%d-0&n=5", k)); w.Code >= 500 {
+							t.Errorf("recommending for a new user: got %d %s", w.Code, w.Body)
+							return
+						}
+					}
+				}(k)
+			}
+
+			var wg sync.WaitGroup
+			for g := 0; g < writers; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for n := 0; n < posts; n++ {
+						body := fmt.Sprintf("{\"user\":\"u%d\",\"item\":\"i1\",\"rating\":4}\n{\"user\":\"w%d-%d\",\"item\":\"n%d\",\"rating\":2}\n", n%50, g, n, g)
+						if w := post(s, "/ratings", body); w.Code != http.StatusOK {
+							t.Errorf("POST /ratings: got %d %s", w.Code, w.Body)
+							return
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+
+			// The last, partial batch is applied once its flush interval elapses.
+			want := before + 2*writers*posts
+			deadline := time.Now().Add(5 * time.Second)
+			for applied(s) < want && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			close(done)
+			readers.Wait()
+			if got := applied(s); got != want {
+				t.Fatalf("applied %d ratings, want %d", got, want)
+			}
+			d := m.Dataset
+			for g := 0; g < writers; g++ {
+				if _, ok := d.ItemMap[fmt.Sprintf("n%d", g)]; !ok {
+					t.Errorf("item n%d was not added", g)
+				}
+				for n := 0; n < posts; n++ {
+					if _, ok := d.UserMap[fmt.Sprintf("w%d-%d", g, n)]; !ok {
+						t.Errorf("user w%d-%d was not added", g, n)
+					}
+				}
+			}
+			if got := strings.Count(queue.String(), "\n"); got != 2*writers*posts {
+				t.Errorf("queued %d ratings, want %d", got, 2*writers*posts)
+			}
+		})
+	}
+}
+
+func TestIngestUnsupported(t *testing.T) {
+	m, err := train.NewBaselineOnly(testModel(t).Dataset, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(m).EnableIngest(IngestConfig{}); err == nil {
+		t.Error("EnableIngest accepted a model without PartialFit")
+	}
+}
+
+// applied returns the number of ratings in the model's dataset.
+func applied(s *Server) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.Model.(*train.SVD).Dataset.Ratings)
+}
@@ -0,0 +1,77 @@
+package serve
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Limits bounds the work a handler takes on at once. Health and readiness
+// checks are exempt, so that probes keep working under load.
+type Limits struct {
+	// Timeout is the deadline of every request. Requests still waiting for
+	// a slot when it passes are answered with 503, and so are /recommend
+	// and /similar if it passes while they score items, which they then
+	// stop, and /predict if it passes before it gets hold of the model.
+	// Ingestion requests run to completion. 0 means no deadline.
+	Timeout time.Duration
+	// MaxConcurrent is the number of requests handled at once. 0 means no
+	// limit.
+	MaxConcurrent int
+	// MaxQueue is the number of requests waiting for one of MaxConcurrent
+	// slots. Requests beyond it are shed with 429 immediately. Queued
+	// requests wait until their Timeout, or for as long as it takes if
+	// there is none.
+	MaxQueue int
+}
+
+type limiter struct {
+	Drainer
+	limits  Limits
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+// Limit wraps h to enforce l.
+func Limit(h Drainer, l Limits) Drainer {
+	lim := &limiter{Drainer: h, limits: l}
+	if l.MaxConcurrent > 0 {
+		lim.slots = make(chan struct{}, l.MaxConcurrent)
+	}
+	return lim
+}
+
+func (lim *limiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+		lim.Drainer.ServeHTTP(w, r)
+		return
+	}
+	if lim.limits.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), lim.limits.Timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	if lim.slots != nil {
+		select {
+		case lim.slots <- struct{}{}:
+		default:
+			if lim.waiting.Add(1) > int64(lim.limits.MaxQueue) {
+				lim.waiting.Add(-1)
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusTooManyRequests, "too many requests")
+				return
+			}
+			select {
+			case lim.slots <- struct{}{}:
+				lim.waiting.Add(-1)
+			case <-r.Context().Done():
+				lim.waiting.Add(-1)
+				writeError(w, http.StatusServiceUnavailable, "timed out waiting: "+r.Context().Err().Error())
+				return
+			}
+		}
+		defer func() { <-lim.slots }()
+	}
+	lim.Drainer.ServeHTTP(w, r)
+}
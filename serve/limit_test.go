@@ -0,0 +1,103 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blocking is a Drainer whose requests, other than /healthz, wait until
+// released after saying they started.
+type blocking struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlocking() *blocking {
+	return &blocking{make(chan struct{}, 10), make(chan struct{})}
+}
+
+func (b *blocking) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		healthz(w, r)
+		return
+	}
+	b.started <- struct{}{}
+	<-b.release
+	writeJSON(w, "done")
+}
+
+func (b *blocking) Drain() {}
+
+// occupy starts a request on h that holds its slot until b is released,
+// and returns once it does.
+func occupy(t *testing.T, h http.Handler, b *blocking) chan *httptest.ResponseRecorder {
+	t.Helper()
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- get(h, "/recommend?user=u1") }()
+	select {
+	case <-b.started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the first request never started")
+	}
+	return done
+}
+
+func TestLimitShedsBeyondQueue(t *testing.T) {
+	b := newBlocking()
+	h := Limit(b, Limits{MaxConcurrent: 1})
+	done := occupy(t, h, b)
+
+	w := get(h, "/recommend?user=u2")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+	// Probes are exempt from the limits.
+	if w := get(h, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("/healthz: got status %d, want 200", w.Code)
+	}
+	close(b.release)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Errorf("first request: got status %d, want 200", w.Code)
+	}
+}
+
+func TestLimitTimesOutQueued(t *testing.T) {
+	b := newBlocking()
+	h := Limit(b, Limits{MaxConcurrent: 1, MaxQueue: 1, Timeout: 50 * time.Millisecond})
+	done := occupy(t, h, b)
+
+	w := get(h, "/recommend?user=u2")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want 503", w.Code)
+	}
+	close(b.release)
+	<-done
+	// The queue is empty again: the next request waits and gets the slot.
+	go func() { <-b.started }()
+	if w := get(h, "/recommend?user=u3"); w.Code != http.StatusOK {
+		t.Errorf("after the timeout: got status %d, want 200", w.Code)
+	}
+}
+
+func TestLimitTimesOutComputation(t *testing.T) {
+	// The deadline passes before the handlers get to work, so they must
+	// notice it rather than answer.
+	h := Limit(New(testModel(t)), Limits{Timeout: time.Nanosecond})
+	for _, target := range []string{
+		"/recommend?user=u1",
+		"/similar?item=i1",
+		"/predict?user=u1&item=i1",
+	} {
+		if w := get(h, target); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: got status %d, want 503: %s", target, w.Code, w.Body)
+		}
+	}
+	if w := get(h, "/readyz"); w.Code != http.StatusOK {
+		t.Errorf("/readyz: got status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,316 @@
+// Package serve exposes a trained colfi model over HTTP with JSON responses:
+//
+//	GET /recommend?user=u&n=10&min_support=5&exclude=i1&exclude=i2&filter=genre=sci-fi&filter=year>=2000&bias_only_below=5&weight=margin:0.3&max_stddev=1
+//	GET /predict?user=u&item=i&bias_only_below=5&weight=margin:0.3
+//	GET /similar?item=i&n=10&min_support=5&exclude=i1&filter=genre=sci-fi
+//	POST /ratings, if enabled by EnableIngest
+//	POST /items, if enabled by EnableIngest and supported by the model
+//	GET /healthz
+//	GET /readyz
+//
+// Filters are conditions on the item features attached to the server, as
+// parsed by data.ParseItemCondition; an item must meet all of them. Users
+// with fewer than bias_only_below training ratings are scored by the model's
+// biases alone, as train.PredictGated does. Scores of /recommend and
+// /predict are blended with numeric item features by the server's Weights,
+// which weight parameters override one by one, as train.Blend does, and
+// then pass through the server's PostProcess chain. Items missing from the server's
+// availability snapshot, if one is set, are never returned. With a
+// challenger set, /recommend also runs it in shadow mode. With Explore set,
+// /recommend mixes in exploratory items and returns every item's propensity
+// and whether it was explored. For models that are
+// train.UncertainPredictors, /predict also returns the standard deviation of
+// the prediction and max_stddev leaves out items from /recommend whose
+// predictions are less certain.
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+const defaultN = 10
+
+type Server struct {
+	Model train.Model
+	// Features, if set, is the item metadata filters are evaluated against.
+	Features data.ItemFeatures
+	// Weights, if set, blends the scores served with numeric attributes of
+	// Features, as train.Blend does.
+	Weights map[string]float64
+	// PostProcess, if set, transforms every score served, e.g. to clip it
+	// to the rating scale.
+	PostProcess train.Chain
+	// ModelTime is when the model was trained, as set by Load from its
+	// metadata, or from the file's modification time for models saved
+	// without.
+	ModelTime time.Time
+	// MaxAge, if set, is the age of the model beyond which /readyz fails.
+	MaxAge time.Duration
+	// Explore, if set, makes /recommend explore with its policy, as
+	// train.RecommendExplore does, returning the propensity of every item
+	// and reporting each list served to OnImpression.
+	Explore *train.ExploreConfig
+	// OnImpression, if set, receives the lists served under exploration
+	// instead of the log.
+	OnImpression func(Impression)
+	// OnShadow, if set, receives the comparisons made in shadow mode
+	// instead of the log. It is called from background goroutines.
+	OnShadow    func(ShadowResult)
+	mux         *http.ServeMux
+	draining    atomic.Bool
+	available   atomic.Pointer[data.Availability]
+	challenger  atomic.Pointer[train.Model]
+	shadowSlots chan struct{}
+	// mu guards the model against PartialFit while ingestion is enabled.
+	mu     sync.RWMutex
+	ingest *ingester
+}
+
+func New(m train.Model) *Server {
+	s := &Server{Model: m, mux: http.NewServeMux(), shadowSlots: make(chan struct{}, runtime.NumCPU())}
+	s.mux.HandleFunc("/recommend", s.recommend)
+	s.mux.HandleFunc("/predict", s.predict)
+	s.mux.HandleFunc("/similar", s.similar)
+	s.mux.HandleFunc("/healthz", healthz)
+	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeReady(w, s.ready())
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := train.StartSpan(r.Context(), "serve.request", train.Attr{Key: "path", Value: r.URL.Path})
+	defer span.End()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.mux.ServeHTTP(rec, r.WithContext(ctx))
+	span.SetAttrs(train.Attr{Key: "status", Value: rec.status})
+	if rec.status >= 500 {
+		span.RecordError(fmt.Errorf("status %d", rec.status))
+	}
+}
+
+type scoredItem struct {
+	Item  string  `json:"item"`
+	Score float64 `json:"score"`
+}
+
+func (s *Server) recommend(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	user := q.Get("user")
+	if user == "" {
+		writeError(w, http.StatusBadRequest, "missing user")
+		return
+	}
+	n, opts, ok := s.itemOptions(w, q)
+	if !ok {
+		return
+	}
+	biasOnlyBelow, err := intParam(q.Get("bias_only_below"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bias_only_below: "+err.Error())
+		return
+	}
+	opts.BiasOnlyBelow = biasOnlyBelow
+	if v := q.Get("max_stddev"); v != "" {
+		if opts.MaxStdDev, err = strconv.ParseFloat(v, 64); err != nil || opts.MaxStdDev < 0 {
+			writeError(w, http.StatusBadRequest, "max_stddev: must be a non-negative number")
+			return
+		}
+	}
+	if opts.PostProcess, ok = s.postProcess(w, q); !ok {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.Explore != nil {
+		items, err := train.RecommendExplore(r.Context(), s.Model, user, n, opts, s.Explore)
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		s.writeExplored(w, user, items)
+		s.shadow(user, n, opts, scoredItems(items))
+		return
+	}
+	recs, err := train.RecommendContext(r.Context(), s.Model, user, n, opts)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeItems(w, recs)
+	s.shadow(user, n, opts, recs)
+}
+
+func (s *Server) similar(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	item := q.Get("item")
+	if item == "" {
+		writeError(w, http.StatusBadRequest, "missing item")
+		return
+	}
+	n, opts, ok := s.itemOptions(w, q)
+	if !ok {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items, err := train.SimilarItemsContext(r.Context(), s.Model, item, n, opts)
+	if err != nil {
+		code := http.StatusBadRequest
+		if r.Context().Err() != nil {
+			code = http.StatusServiceUnavailable
+		}
+		writeError(w, code, err.Error())
+		return
+	}
+	writeItems(w, items)
+}
+
+// itemOptions parses the parameters that select items, shared by /recommend
+// and /similar, and returns n and the options. On a bad parameter it writes
+// the error and returns false.
+func (s *Server) itemOptions(w http.ResponseWriter, q url.Values) (int, *train.RecommendOptions, bool) {
+	n, err := intParam(q.Get("n"), defaultN)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "n: "+err.Error())
+		return 0, nil, false
+	}
+	minSupport, err := intParam(q.Get("min_support"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "min_support: "+err.Error())
+		return 0, nil, false
+	}
+	opts := &train.RecommendOptions{
+		Exclude:    q["exclude"],
+		MinSupport: minSupport,
+		Available:  s.available.Load(),
+	}
+	if filters := q["filter"]; len(filters) > 0 {
+		if s.Features == nil {
+			writeError(w, http.StatusBadRequest, "filter: no item features loaded")
+			return 0, nil, false
+		}
+		conds := make([]data.ItemCondition, len(filters))
+		for k, f := range filters {
+			if conds[k], err = data.ParseItemCondition(f); err != nil {
+				writeError(w, http.StatusBadRequest, "filter: "+err.Error())
+				return 0, nil, false
+			}
+		}
+		opts.Filter = func(item string) bool {
+			return s.Features.Match(item, conds)
+		}
+	}
+	return n, opts, true
+}
+
+// postProcess returns the chain scores pass through: the blend of the
+// server's Weights overridden by the request's weight parameters, if any,
+// followed by PostProcess. On a bad parameter it writes the error and
+// returns false.
+func (s *Server) postProcess(w http.ResponseWriter, q url.Values) (train.Chain, bool) {
+	overrides, err := train.ParseWeights(q["weight"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "weight: "+err.Error())
+		return nil, false
+	}
+	if len(s.Weights) == 0 && len(overrides) == 0 {
+		return s.PostProcess, true
+	}
+	if s.Features == nil {
+		writeError(w, http.StatusBadRequest, "weight: no item features loaded")
+		return nil, false
+	}
+	weights := make(map[string]float64, len(s.Weights)+len(overrides))
+	for k, v := range s.Weights {
+		weights[k] = v
+	}
+	for k, v := range overrides {
+		weights[k] = v
+	}
+	return append(train.Chain{train.Blend{Features: s.Features, Weights: weights}}, s.PostProcess...), true
+}
+
+func writeItems(w http.ResponseWriter, items []train.ScoredItem) {
+	out := make([]scoredItem, len(items))
+	for k, it := range items {
+		out[k] = scoredItem{it.Item, it.Score}
+	}
+	writeJSON(w, out)
+}
+
+func (s *Server) predict(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	user, item := q.Get("user"), q.Get("item")
+	if user == "" || item == "" {
+		writeError(w, http.StatusBadRequest, "missing user or item")
+		return
+	}
+	biasOnlyBelow, err := intParam(q.Get("bias_only_below"), 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bias_only_below: "+err.Error())
+		return
+	}
+	chain, ok := s.postProcess(w, q)
+	if !ok {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// A single prediction is quick, but waiting for the lock while a batch
+	// of ratings is applied may not be.
+	if err := r.Context().Err(); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	out := struct {
+		Score  float64  `json:"score"`
+		StdDev *float64 `json:"stddev,omitempty"`
+	}{Score: chain.Process(user, item, train.PredictGated(s.Model, user, item, biasOnlyBelow))}
+	if up, ok := s.Model.(train.UncertainPredictor); ok {
+		sd := math.Sqrt(up.PredictVariance(user, item))
+		out.StdDev = &sd
+	}
+	writeJSON(w, out)
+}
+
+// intParam parses a non-negative integer query parameter, returning def if
+// it is absent.
+func intParam(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("must not be negative, got %d", n)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
@@ -0,0 +1,73 @@
+package serve
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// testModel returns an SVD trained briefly on synthetic ratings of items
+// i0 to i29 by users u0 to u49, the same on every call.
+func testModel(t *testing.T) *train.SVD {
+	t.Helper()
+	u, i, r, err := data.SyntheticRatings(1, 50, 30, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _, err := data.DatasetsFromSlices(u, i, r, 0, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := train.NewSVD(d, &train.SVDConfig{NumFactors: 4, Source: rand.New(rand.NewSource(1))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Fit(5)
+	return m.(*train.SVD)
+}
+
+// get serves a GET of target by h and returns the response.
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+// post serves a POST of body to target by h and returns the response.
+func post(h http.Handler, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+	return w
+}
+
+// decode decodes the JSON body of w into v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+// recommended returns the items /recommend serves user u from h.
+func recommended(t *testing.T, h http.Handler, u string) []string {
+	t.Helper()
+	w := get(h, "/recommend?n=100&user="+u)
+	if w.Code != http.StatusOK {
+		t.Fatalf("/recommend: status %d: %s", w.Code, w.Body)
+	}
+	var items []scoredItem
+	decode(t, w, &items)
+	ids := make([]string, len(items))
+	for k, it := range items {
+		ids[k] = it.Item
+	}
+	sort.Strings(ids)
+	return ids
+}
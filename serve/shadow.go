@@ -0,0 +1,100 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"main/colfi/train"
+)
+
+// ShadowResult compares the lists the champion served and the challenger
+// would have served for one /recommend request.
+type ShadowResult struct {
+	User       string   `json:"user"`
+	Champion   []string `json:"champion"`
+	Challenger []string `json:"challenger"`
+	// Overlap counts the items in both lists and Jaccard divides it by the
+	// number of items in either.
+	Overlap int     `json:"overlap"`
+	Jaccard float64 `json:"jaccard"`
+	// SameTop reports whether both lists start with the same item.
+	SameTop bool `json:"same_top"`
+}
+
+func newShadowResult(user string, champion, challenger []train.ScoredItem) ShadowResult {
+	res := ShadowResult{User: user, Champion: itemNames(champion), Challenger: itemNames(challenger)}
+	in := make(map[string]bool, len(champion))
+	for _, i := range res.Champion {
+		in[i] = true
+	}
+	for _, i := range res.Challenger {
+		if in[i] {
+			res.Overlap++
+		}
+	}
+	if union := len(champion) + len(challenger) - res.Overlap; union > 0 {
+		res.Jaccard = float64(res.Overlap) / float64(union)
+	}
+	res.SameTop = len(champion) > 0 && len(challenger) > 0 && champion[0].Item == challenger[0].Item
+	return res
+}
+
+func itemNames(items []train.ScoredItem) []string {
+	names := make([]string, len(items))
+	for k, it := range items {
+		names[k] = it.Item
+	}
+	return names
+}
+
+// logShadow writes res as a JSON line, the default for Server.OnShadow.
+func logShadow(res ShadowResult) {
+	b, _ := json.Marshal(res)
+	log.Printf("shadow %s", b)
+}
+
+// SetChallenger runs c in shadow mode: every /recommend request is also
+// answered by c, after the champion's list has been served, and the two
+// lists are passed to OnShadow, which logs them by default. Shadow requests
+// beyond one per CPU are dropped rather than queued, so the challenger
+// never slows down or fails live traffic. A nil c stops shadowing.
+func (s *Server) SetChallenger(c train.Model) {
+	if c == nil {
+		s.challenger.Store(nil)
+		return
+	}
+	s.challenger.Store(&c)
+}
+
+// shadow compares recs, served by the champion, with the challenger's list
+// for the same request in the background.
+func (s *Server) shadow(user string, n int, opts *train.RecommendOptions, recs []train.ScoredItem) {
+	c := s.challenger.Load()
+	if c == nil {
+		return
+	}
+	select {
+	case s.shadowSlots <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-s.shadowSlots }()
+		// The challenger's dataset may differ from the champion's, so
+		// gating and post-processing are kept but availability, which is a
+		// bitmap over the champion's items, is not.
+		o := *opts
+		o.Available = nil
+		alt, err := train.RecommendContext(context.Background(), *c, user, n, &o)
+		if err != nil {
+			log.Printf("shadow: %v", err)
+			return
+		}
+		onShadow := s.OnShadow
+		if onShadow == nil {
+			onShadow = logShadow
+		}
+		onShadow(newShadowResult(user, recs, alt))
+	}()
+}
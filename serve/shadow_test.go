@@ -0,0 +1,130 @@
+package serve
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+func TestNewShadowResult(t *testing.T) {
+	items := func(ids ...string) []train.ScoredItem {
+		s := make([]train.ScoredItem, len(ids))
+		for k, i := range ids {
+			s[k] = train.ScoredItem{Item: i}
+		}
+		return s
+	}
+	for _, tc := range []struct {
+		champion, challenger []train.ScoredItem
+		overlap              int
+		jaccard              float64
+		sameTop              bool
+	}{
+		{items("a", "b", "c"), items("a", "b", "c"), 3, 1, true},
+		{items("a", "b", "c"), items("c", "d"), 1, .25, false},
+		{items("a"), items("b"), 0, 0, false},
+		{nil, nil, 0, 0, false},
+	} {
+		res := newShadowResult("u", tc.champion, tc.challenger)
+		if res.Overlap != tc.overlap || res.Jaccard != tc.jaccard || res.SameTop != tc.sameTop {
+			t.Errorf("%v vs %v: got overlap %d, Jaccard %v, same top %v, want %d, %v, %v",
+				res.Champion, res.Challenger, res.Overlap, res.Jaccard, res.SameTop, tc.overlap, tc.jaccard, tc.sameTop)
+		}
+	}
+}
+
+func TestShadowRecommend(t *testing.T) {
+	m := testModel(t)
+	challenger, err := train.NewBaselineOnly(m.Dataset, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenger.Fit(5)
+	s := New(m)
+	s.SetAvailability(data.NewAvailability(m.Dataset, []string{"i1", "i2", "i3"}))
+	results := make(chan ShadowResult, 10)
+	s.OnShadow = func(res ShadowResult) { results <- res }
+	s.SetChallenger(challenger)
+
+	w := get(s, "/recommend?user=u1&n=5")
+	var served []train.ScoredItem
+	decode(t, w, &served)
+	var res ShadowResult
+	select {
+	case res = <-results:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no shadow result")
+	}
+	// The availability snapshot is over the champion's items, so the
+	// challenger ranks all of its own.
+	want := newShadowResult("u1", served, train.Recommend(challenger, "u1", 5, nil))
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got %+v, want %+v", res, want)
+	}
+	if len(res.Champion) != 3 || len(res.Challenger) != 5 {
+		t.Errorf("got %d champion and %d challenger items, want 3 available and 5", len(res.Champion), len(res.Challenger))
+	}
+
+	// Without a challenger, nothing is compared.
+	s.SetChallenger(nil)
+	get(s, "/recommend?user=u2&n=5")
+	select {
+	case res := <-results:
+		t.Errorf("got a shadow result for %s without a challenger", res.User)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestShadowLogs(t *testing.T) {
+	var buf lockedBuffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	m := testModel(t)
+	s := New(m)
+	s.SetChallenger(m)
+	get(s, "/recommend?user=u1&n=3")
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(buf.String(), "shadow {") {
+		if time.Now().After(deadline) {
+			t.Fatalf("no shadow line logged, got %q", buf.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	line := buf.String()
+	var res ShadowResult
+	if err := json.Unmarshal([]byte(line[strings.Index(line, "{"):]), &res); err != nil {
+		t.Fatal(err)
+	}
+	// A model shadowing itself agrees with itself.
+	if res.User != "u1" || res.Overlap != 3 || res.Jaccard != 1 || !res.SameTop {
+		t.Errorf("got %+v, want u1's three items in both lists", res)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for the logger to write to while the
+// test reads it.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,237 @@
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"main/colfi/data"
+	"main/colfi/train"
+)
+
+// TenantConfig locates the files of one tenant's model and sets the weights
+// its scores are blended with item features by, see Server.Weights.
+type TenantConfig struct {
+	Model    string             `json:"model"`
+	Features string             `json:"features,omitempty"`
+	Weights  map[string]float64 `json:"weights,omitempty"`
+}
+
+// Load reads a model written by train.SaveFile and, if featuresFile is not
+// empty, the item features to filter on, and returns a Server for them.
+func Load(modelFile, featuresFile string) (*Server, error) {
+	m, meta, err := train.LoadFileMetadata(modelFile)
+	if err != nil {
+		return nil, err
+	}
+	s := New(m)
+	s.ModelTime = meta.TrainedAt
+	if fi, err := os.Stat(modelFile); err == nil && s.ModelTime.IsZero() {
+		s.ModelTime = fi.ModTime()
+	}
+	if featuresFile != "" {
+		f, err := os.Open(featuresFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if s.Features, err = data.ReadItemFeatures(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", featuresFile, err)
+		}
+	}
+	return s, nil
+}
+
+// Registry serves several independent models, such as regional catalogs,
+// from one process. Each tenant's endpoints are those of Server under
+// /tenants/<name>/, e.g. /tenants/eu/recommend?user=u. A tenant's model is
+// loaded on its first request; if loading fails, the request gets a 503 and
+// the next one tries again. GET /metrics reports per-tenant counters, and
+// /healthz and /readyz the state of the process as a whole.
+type Registry struct {
+	// MaxAge, if set, is applied to the Server of every tenant.
+	MaxAge   time.Duration
+	mu       sync.RWMutex
+	tenants  map[string]*tenant
+	draining atomic.Bool
+}
+
+type tenant struct {
+	config TenantConfig
+	// mu serializes loading; server is read without it so that metrics and
+	// requests do not wait for a load in progress once loaded.
+	mu     sync.Mutex
+	server atomic.Pointer[Server]
+
+	requests atomic.Int64
+	errors   atomic.Int64
+	nanos    atomic.Int64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tenants: make(map[string]*tenant)}
+}
+
+// ReadTenants reads a JSON object mapping tenant names to their configs, e.g.
+//
+//	{"eu": {"model": "eu.gob", "features": "eu.jsonl", "weights": {"margin": 0.3}}, "us": {"model": "us.gob"}}
+func ReadTenants(path string) (map[string]TenantConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs map[string]TenantConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// Add registers a tenant, replacing any loaded model of the same name.
+func (reg *Registry) Add(name string, config TenantConfig) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid tenant name %q", name)
+	}
+	if config.Model == "" {
+		return fmt.Errorf("tenant %s: missing model", name)
+	}
+	reg.mu.Lock()
+	reg.tenants[name] = &tenant{config: config}
+	reg.mu.Unlock()
+	return nil
+}
+
+// Remove unregisters a tenant, releasing its model.
+func (reg *Registry) Remove(name string) {
+	reg.mu.Lock()
+	delete(reg.tenants, name)
+	reg.mu.Unlock()
+}
+
+func (reg *Registry) lookup(name string) *tenant {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return reg.tenants[name]
+}
+
+// load returns the tenant's server, loading it if this is the first
+// successful request. Requests for other tenants are not held up.
+func (t *tenant) load(maxAge time.Duration) (*Server, error) {
+	if s := t.server.Load(); s != nil {
+		return s, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if s := t.server.Load(); s != nil {
+		return s, nil
+	}
+	s, err := Load(t.config.Model, t.config.Features)
+	if err != nil {
+		return nil, err
+	}
+	s.MaxAge = maxAge
+	s.Weights = t.config.Weights
+	t.server.Store(s)
+	return s, nil
+}
+
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/metrics":
+		reg.metrics(w, r)
+		return
+	case "/healthz":
+		healthz(w, r)
+		return
+	case "/readyz":
+		writeReady(w, reg.ready())
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/tenants/") {
+		http.NotFound(w, r)
+		return
+	}
+	name, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/tenants/"), "/")
+	t := reg.lookup(name)
+	if t == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown tenant %q", name))
+		return
+	}
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if s, err := t.load(reg.MaxAge); err != nil {
+		writeError(rec, http.StatusServiceUnavailable, fmt.Sprintf("loading tenant %s: %v", name, err))
+	} else {
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = "/" + path
+		r2.URL = &u
+		s.ServeHTTP(rec, r2)
+	}
+	t.requests.Add(1)
+	if rec.status >= 400 {
+		t.errors.Add(1)
+	}
+	t.nanos.Add(int64(time.Since(start)))
+}
+
+// TenantMetrics are the counters of one tenant since it was added.
+type TenantMetrics struct {
+	Loaded        bool    `json:"loaded"`
+	Requests      int64   `json:"requests"`
+	Errors        int64   `json:"errors"`
+	MeanLatencyMS float64 `json:"mean_latency_ms"`
+}
+
+// Metrics returns the counters of every tenant by name.
+func (reg *Registry) Metrics() map[string]TenantMetrics {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	out := make(map[string]TenantMetrics, len(reg.tenants))
+	for name, t := range reg.tenants {
+		m := TenantMetrics{
+			Loaded:   t.server.Load() != nil,
+			Requests: t.requests.Load(),
+			Errors:   t.errors.Load(),
+		}
+		if m.Requests > 0 {
+			m.MeanLatencyMS = float64(t.nanos.Load()) / float64(m.Requests) / 1e6
+		}
+		out[name] = m
+	}
+	return out
+}
+
+// Names returns the registered tenants in order.
+func (reg *Registry) Names() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	names := make([]string, 0, len(reg.tenants))
+	for name := range reg.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (reg *Registry) metrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, reg.Metrics())
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
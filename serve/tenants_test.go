@@ -0,0 +1,115 @@
+package serve
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"main/colfi/train"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	eu := testModel(t)
+	us, err := train.NewBaselineOnly(eu.Dataset, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.Fit(5)
+	euFile, usFile, lateFile := filepath.Join(dir, "eu.gob"), filepath.Join(dir, "us.gob"), filepath.Join(dir, "late.gob")
+	for path, m := range map[string]train.Model{euFile: eu, usFile: us} {
+		if err := train.SaveFile(path, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reg := NewRegistry()
+	for name, config := range map[string]TenantConfig{
+		"eu":   {Model: euFile},
+		"us":   {Model: usFile},
+		"late": {Model: lateFile},
+	} {
+		if err := reg.Add(name, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"", "a/b"} {
+		if err := reg.Add(name, TenantConfig{Model: euFile}); err == nil {
+			t.Errorf("Add accepted the name %q", name)
+		}
+	}
+	if err := reg.Add("none", TenantConfig{}); err == nil {
+		t.Error("Add accepted a tenant without a model")
+	}
+	if got := reg.Names(); !reflect.DeepEqual(got, []string{"eu", "late", "us"}) {
+		t.Errorf("Names: got %v", got)
+	}
+	for name, m := range reg.Metrics() {
+		if m.Loaded {
+			t.Errorf("%s loaded before its first request", name)
+		}
+	}
+
+	// Each tenant is routed to its own model.
+	predict := func(tenant string) (float64, int) {
+		w := get(reg, "/tenants/"+tenant+"/predict?user=u1&item=i1")
+		if w.Code != http.StatusOK {
+			return 0, w.Code
+		}
+		var out struct{ Score float64 }
+		decode(t, w, &out)
+		return out.Score, w.Code
+	}
+	for tenant, m := range map[string]train.Model{"eu": eu, "us": us} {
+		if got, code := predict(tenant); code != http.StatusOK || got != m.Predict("u1", "i1") {
+			t.Errorf("%s: got %v with status %d, want %v", tenant, got, code, m.Predict("u1", "i1"))
+		}
+	}
+	if eu.Predict("u1", "i1") == us.Predict("u1", "i1") {
+		t.Fatal("the tenants' models agree, so routing is not tested")
+	}
+	for _, target := range []string{"/tenants/nowhere/predict?user=u1&item=i1", "/predict?user=u1&item=i1"} {
+		if w := get(reg, target); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want 404", target, w.Code)
+		}
+	}
+
+	// A tenant whose model cannot be loaded fails until it can.
+	if _, code := predict("late"); code != http.StatusServiceUnavailable {
+		t.Errorf("late before its file exists: got status %d, want 503", code)
+	}
+	if err := train.SaveFile(lateFile, eu); err != nil {
+		t.Fatal(err)
+	}
+	if _, code := predict("late"); code != http.StatusOK {
+		t.Errorf("late once its file exists: got status %d, want 200", code)
+	}
+	metrics := reg.Metrics()
+	if got, want := metrics["late"], (TenantMetrics{Loaded: true, Requests: 2, Errors: 1}); got.Loaded != want.Loaded || got.Requests != want.Requests || got.Errors != want.Errors {
+		t.Errorf("late metrics: got %+v, want %+v", got, want)
+	}
+	if got := metrics["eu"]; !got.Loaded || got.Requests != 1 || got.Errors != 0 {
+		t.Errorf("eu metrics: got %+v", got)
+	}
+
+	// Adding a tenant again replaces its loaded model.
+	if err := reg.Add("eu", TenantConfig{Model: usFile}); err != nil {
+		t.Fatal(err)
+	}
+	if reg.Metrics()["eu"].Loaded {
+		t.Error("eu still loaded after being replaced")
+	}
+	if got, _ := predict("eu"); got != us.Predict("u1", "i1") {
+		t.Errorf("eu after being replaced: got %v, want %v", got, us.Predict("u1", "i1"))
+	}
+
+	// A removed tenant is gone.
+	reg.Remove("us")
+	if _, code := predict("us"); code != http.StatusNotFound {
+		t.Errorf("us after Remove: got status %d, want 404", code)
+	}
+	if _, ok := reg.Metrics()["us"]; ok {
+		t.Error("us still has metrics after Remove")
+	}
+}
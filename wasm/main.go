@@ -0,0 +1,112 @@
+//go:build js && wasm
+
+// Command wasm exposes a compact colfi model to JavaScript, so that
+// personalized demos can score entirely in the browser. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o colfi.wasm ./wasm
+//
+// and load it with the wasm_exec.js shipped in $(go env GOROOT)/lib/wasm
+// (misc/wasm before Go 1.24).
+// It defines a global colfi object with
+//
+//	colfi.load(bytes)                    // Uint8Array written by train -compact
+//	colfi.predict(user, item)            // number
+//	colfi.recommend(user, n, [exclude])  // [{item, score}, ...]
+//
+// Go panics cannot cross into JavaScript, so failures are returned instead of
+// thrown: all three return an Error for missing or mistyped arguments, load
+// for a malformed model, and predict and recommend if no model has been
+// loaded.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"syscall/js"
+
+	"main/colfi/infer"
+)
+
+var model *infer.Model
+
+var errNoModel = errors.New("colfi: no model loaded")
+
+func main() {
+	js.Global().Set("colfi", js.ValueOf(map[string]interface{}{
+		"load":      js.FuncOf(load),
+		"predict":   js.FuncOf(predict),
+		"recommend": js.FuncOf(recommend),
+	}))
+	select {}
+}
+
+func load(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 || !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+		return jsError(errors.New("colfi.load: argument 1 is not a Uint8Array"))
+	}
+	b := make([]byte, args[0].Length())
+	js.CopyBytesToGo(b, args[0])
+	c, err := infer.Load(bytes.NewReader(b))
+	if err != nil {
+		return jsError(err)
+	}
+	model = c
+	return nil
+}
+
+func predict(this js.Value, args []js.Value) interface{} {
+	if err := checkArgs("predict", args, js.TypeString, js.TypeString); err != nil {
+		return jsError(err)
+	}
+	if model == nil {
+		return jsError(errNoModel)
+	}
+	return model.Predict(args[0].String(), args[1].String())
+}
+
+func recommend(this js.Value, args []js.Value) interface{} {
+	if err := checkArgs("recommend", args, js.TypeString, js.TypeNumber); err != nil {
+		return jsError(err)
+	}
+	if model == nil {
+		return jsError(errNoModel)
+	}
+	var exclude []string
+	if len(args) > 2 && !args[2].IsUndefined() {
+		if !js.Global().Get("Array").Call("isArray", args[2]).Bool() {
+			return jsError(errors.New("colfi.recommend: argument 3 is not an array"))
+		}
+		for k := 0; k < args[2].Length(); k++ {
+			v := args[2].Index(k)
+			if v.Type() != js.TypeString {
+				return jsError(fmt.Errorf("colfi.recommend: excluded item %d is a %v, want a string", k, v.Type()))
+			}
+			exclude = append(exclude, v.String())
+		}
+	}
+	recs := model.Recommend(args[0].String(), args[1].Int(), exclude)
+	out := make([]interface{}, len(recs))
+	for k, r := range recs {
+		out[k] = map[string]interface{}{"item": r.Item, "score": r.Score}
+	}
+	return out
+}
+
+// checkArgs returns an error unless args starts with values of the given
+// types, for the function called name.
+func checkArgs(name string, args []js.Value, types ...js.Type) error {
+	if len(args) < len(types) {
+		return fmt.Errorf("colfi.%s: takes %d arguments, got %d", name, len(types), len(args))
+	}
+	for k, t := range types {
+		if args[k].Type() != t {
+			return fmt.Errorf("colfi.%s: argument %d is a %v, want a %v", name, k+1, args[k].Type(), t)
+		}
+	}
+	return nil
+}
+
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}